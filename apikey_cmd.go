@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/casanera/DlugoshSolutions/internal/auth"
+	"github.com/casanera/DlugoshSolutions/internal/models"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+const apiKeyUsage = "использование: apikey create -name ИМЯ [-scopes a,b] [-ttl 720h] | apikey list | apikey revoke ID"
+
+// runAPIKeyCommand выполняет подкоманду apikey: create, list или revoke.
+// Результат пишется в out (открытый ключ выводится только здесь и только один раз)
+func runAPIKeyCommand(ctx context.Context, keys storage.APIKeyStorage, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(apiKeyUsage)
+	}
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+		name := fs.String("name", "", "кому или для чего выдается ключ (обязательно)")
+		scopes := fs.String("scopes", "", "разрешения через запятую, например users:read,users:write")
+		ttl := fs.Duration("ttl", 0, "срок действия ключа (0 - бессрочный)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *name == "" || *ttl < 0 {
+			return fmt.Errorf("apikey create: нужно указать -name, -ttl не может быть отрицательным")
+		}
+
+		raw, prefix, hash, err := auth.GenerateAPIKey()
+		if err != nil {
+			return err
+		}
+		key := &models.APIKey{Name: *name, Prefix: prefix, Scopes: auth.ParseScopes(*scopes)}
+		if *ttl > 0 {
+			expires := time.Now().Add(*ttl)
+			key.ExpiresAt = &expires
+		}
+		if _, err := keys.CreateAPIKey(ctx, key, hash); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Создан API-ключ %d (%s). Сохраните его - повторно он показан не будет:\n%s\n", key.ID, key.Name, raw)
+	case "list":
+		list, err := keys.ListAPIKeys(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tПРЕФИКС\tИМЯ\tРАЗРЕШЕНИЯ\tСОЗДАН\tИСПОЛЬЗОВАН\tИСТЕКАЕТ\tСОСТОЯНИЕ")
+		for _, k := range list {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Prefix, k.Name, strings.Join(k.Scopes, ","),
+				formatTime(&k.CreatedAt), formatTime(k.LastUsedAt), formatTime(k.ExpiresAt), apiKeyState(k))
+		}
+		return tw.Flush()
+	case "revoke":
+		if len(args) < 2 {
+			return errors.New(apiKeyUsage)
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("apikey revoke: некорректный ID %q", args[1])
+		}
+		if err := keys.RevokeAPIKey(ctx, id); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "API-ключ %d отозван\n", id)
+	default:
+		return fmt.Errorf("неизвестная подкоманда apikey %q: %s", args[0], apiKeyUsage)
+	}
+	return nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func apiKeyState(k models.APIKey) string {
+	switch {
+	case k.RevokedAt != nil:
+		return "отозван"
+	case k.ExpiresAt != nil && !time.Now().Before(*k.ExpiresAt):
+		return "истек"
+	}
+	return "действует"
+}
@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1; -- номер версии записи, увеличивается при каждом изменении (оптимистичная блокировка)
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,               -- кому или для чего выдан ключ
+    prefix VARCHAR(16) NOT NULL,              -- начало ключа, чтобы узнать его в списке; сам ключ не хранится
+    key_hash CHAR(64) NOT NULL UNIQUE,        -- SHA-256 ключа в hex
+    scopes TEXT[] NOT NULL DEFAULT '{}',      -- разрешения, например users:read
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ,                   -- NULL - бессрочный
+    revoked_at TIMESTAMPTZ                    -- NOT NULL - ключ отозван
+);
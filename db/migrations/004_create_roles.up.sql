@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS roles (
+    name VARCHAR(50) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    permissions TEXT[] NOT NULL DEFAULT '{}'  -- разрешения роли; суффикс :self - только над собственной записью
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role VARCHAR(50) NOT NULL REFERENCES roles (name) ON UPDATE CASCADE,
+    granted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, role)
+);
+
+INSERT INTO roles (name, description, permissions) VALUES
+    ('admin', 'Полный доступ к пользователям', '{users:read,users:write,users:delete}'),
+    ('operator', 'Только просмотр пользователей', '{users:read}'),
+    ('user', 'Просмотр и изменение собственной записи', '{users:read:self,users:write:self}')
+ON CONFLICT (name) DO NOTHING;
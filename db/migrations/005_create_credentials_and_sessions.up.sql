@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS user_credentials (
+    user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    password_hash TEXT NOT NULL,                 -- $argon2id$... или $2b$... (bcrypt)
+    failed_attempts INTEGER NOT NULL DEFAULT 0,  -- неудачные попытки входа подряд
+    locked_until TIMESTAMPTZ,                    -- вход заблокирован до этого момента
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id_hash CHAR(64) PRIMARY KEY,                -- SHA-256 идентификатора из cookie; сам идентификатор не хранится
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    csrf_token VARCHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(), -- для истечения по бездействию
+    expires_at TIMESTAMPTZ NOT NULL                  -- абсолютный срок жизни
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS sessions_expires_at_idx ON sessions (expires_at);
@@ -0,0 +1,3 @@
+UPDATE roles SET permissions = array_remove(permissions, 'audit:read') WHERE name = 'admin';
+
+DROP TABLE IF EXISTS audit_events;
@@ -0,0 +1,21 @@
+-- Журнал аудита: изменения пользователей пишутся в той же транзакции, что и
+-- сами изменения; сюда же попадают отказы в доступе и попытки входа.
+-- Внешнего ключа на users нет: история должна пережить удаление пользователя
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    actor TEXT NOT NULL DEFAULT '',       -- субъект вида api_key:3; пусто - команда администратора
+    request_id TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,                 -- например users.update
+    resource TEXT NOT NULL,               -- например users/42
+    outcome TEXT NOT NULL,                -- success или denied
+    reason TEXT NOT NULL DEFAULT '',
+    before JSONB,                         -- состояние до изменения
+    after JSONB                           -- состояние после изменения
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_resource_idx ON audit_events (resource, id);
+CREATE INDEX IF NOT EXISTS audit_events_occurred_at_idx ON audit_events (occurred_at);
+
+UPDATE roles SET permissions = array_append(permissions, 'audit:read')
+WHERE name = 'admin' AND NOT 'audit:read' = ANY (permissions);
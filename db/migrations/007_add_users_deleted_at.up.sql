@@ -0,0 +1,9 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ; -- NOT NULL - пользователь удален и будет окончательно удален после срока хранения
+
+-- Email уникален среди неудаленных пользователей: адрес удаленного можно занять
+-- снова, а восстановить удаленного с занятым адресом нельзя
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_active_key ON users (email) WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,8 @@
+// Package migrations встраивает SQL-миграции схемы БД в бинарный файл.
+// Файлы именуются как NNN_описание.up.sql / NNN_описание.down.sql
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/casanera/DlugoshSolutions/internal/importer"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+const importUsage = "использование: import [-format csv|ndjson] [-delimiter ;] [-name-column name] [-email-column email] [-dry-run] ФАЙЛ|-"
+
+// runImportCommand загружает пользователей из файла (или stdin при "-") и
+// печатает отчет: сколько создано, пропущено и какие строки не прошли проверку
+func runImportCommand(ctx context.Context, store storage.Transactor, args []string, in io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "csv или ndjson (по умолчанию - по расширению файла, для stdin - csv)")
+	delimiter := fs.String("delimiter", "", "разделитель CSV: один символ или tab (по умолчанию запятая)")
+	nameColumn := fs.String("name-column", "", "колонка CSV или ключ NDJSON с именем (по умолчанию name)")
+	emailColumn := fs.String("email-column", "", "колонка CSV или ключ NDJSON с email (по умолчанию email)")
+	dryRun := fs.Bool("dry-run", false, "проверить файл, ничего не сохраняя")
+	batchSize := fs.Int("batch-size", importer.DefaultBatchSize, "пользователей в одной транзакции")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New(importUsage)
+	}
+	opts := importer.Options{
+		Format:      *format,
+		NameColumn:  *nameColumn,
+		EmailColumn: *emailColumn,
+		DryRun:      *dryRun,
+		BatchSize:   *batchSize,
+	}
+	var err error
+	if opts.Delimiter, err = importer.ParseDelimiter(*delimiter); err != nil {
+		return err
+	}
+
+	name := fs.Arg(0)
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	if opts.Format == "" {
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".ndjson", ".jsonl":
+			opts.Format = importer.FormatNDJSON
+		default:
+			opts.Format = importer.FormatCSV
+		}
+	}
+
+	report, err := importer.Run(ctx, store, in, opts)
+	if report != nil {
+		printImportReport(out, report)
+	}
+	return err
+}
+
+func printImportReport(out io.Writer, report *importer.Report) {
+	if report.DryRun {
+		fmt.Fprintln(out, "Пробный импорт: изменения не сохранены")
+	}
+	fmt.Fprintf(out, "Строк: %d, создано: %d, пропущено: %d, с ошибками: %d\n",
+		report.Rows, report.Created, report.Skipped, report.Invalid)
+	for _, rows := range []struct {
+		title string
+		rows  []importer.RowError
+	}{{"Пропущены (email уже используется):", report.SkippedRows}, {"Ошибки:", report.InvalidRows}} {
+		if len(rows.rows) == 0 {
+			continue
+		}
+		fmt.Fprintln(out, rows.title)
+		for _, r := range rows.rows {
+			fmt.Fprintf(out, "  строка %d: ", r.Line)
+			if r.Field != "" {
+				fmt.Fprintf(out, "%s: ", r.Field)
+			}
+			fmt.Fprintln(out, r.Message)
+		}
+	}
+	if report.Truncated {
+		fmt.Fprintf(out, "Показаны первые %d строк каждого списка\n", importer.MaxReportRows)
+	}
+}
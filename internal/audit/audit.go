@@ -0,0 +1,86 @@
+// Package audit записывает журнал аудита: кто, что и над чем пытался
+// сделать и чем это закончилось
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Исходы операций
+const (
+	OutcomeSuccess = "success"
+	OutcomeDenied  = "denied"
+)
+
+// Event - запись журнала аудита. ID и Time заполняет хранилище событий
+type Event struct {
+	ID        int64     `json:"id"`
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor"` // субъект в виде вид:ID, например api_key:3; пусто - анонимный запрос
+	RequestID string    `json:"request_id,omitempty"`
+	Action    string    `json:"action"`           // операция, например users.delete
+	Resource  string    `json:"resource"`         // объект операции, например users/42
+	Outcome   string    `json:"outcome"`          // OutcomeSuccess или OutcomeDenied
+	Reason    string    `json:"reason,omitempty"` // пояснение, например недостающее разрешение
+	// Состояние объекта до и после изменения; null - объекта не было (создание)
+	// или не стало (удаление)
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+type actorKey struct{}
+
+// WithActor возвращает контекст с субъектом запроса в виде вид:ID. Так
+// хранилище узнает, от чьего имени вносится изменение
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext возвращает субъект запроса или "", если его нет
+// (например, изменение внесено командой администратора)
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// Recorder сохраняет события аудита
+type Recorder interface {
+	Record(ctx context.Context, e Event) error
+}
+
+// Multi передает событие каждому журналу по очереди. Сбой одного журнала не
+// мешает записи в остальные; возвращаются все ошибки
+type Multi []Recorder
+
+func (m Multi) Record(ctx context.Context, e Event) error {
+	var errs []error
+	for _, r := range m {
+		if err := r.Record(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LogRecorder пишет события аудита в журнал приложения
+type LogRecorder struct {
+	Logger *slog.Logger
+}
+
+func NewLogRecorder(logger *slog.Logger) *LogRecorder {
+	return &LogRecorder{Logger: logger}
+}
+
+func (r *LogRecorder) Record(ctx context.Context, e Event) error {
+	r.Logger.LogAttrs(ctx, slog.LevelInfo, "событие аудита",
+		slog.String("actor", e.Actor),
+		slog.String("action", e.Action),
+		slog.String("resource", e.Resource),
+		slog.String("outcome", e.Outcome),
+		slog.String("reason", e.Reason))
+	return nil
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/casanera/DlugoshSolutions/internal/logging"
+	"github.com/casanera/DlugoshSolutions/internal/middleware"
+	"github.com/casanera/DlugoshSolutions/internal/problem"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+// APIKeyHeader - заголовок, в котором клиент передает API-ключ
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyPrefix отличает ключи этого сервиса от других секретов (например, при поиске утечек)
+const apiKeyPrefix = "dk_"
+
+// visiblePrefixLength - сколько символов ключа сохраняется открыто для опознания
+const visiblePrefixLength = len(apiKeyPrefix) + 8
+
+// GenerateAPIKey создает новый ключ из 256 случайных бит. Возвращает сам ключ
+// (показывается один раз), его открытый префикс и хеш для хранения
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", "", "", fmt.Errorf("auth: генерация ключа: %w", err)
+	}
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b[:])
+	return key, key[:visiblePrefixLength], HashAPIKey(key), nil
+}
+
+// HashAPIKey возвращает SHA-256 ключа в hex. Медленный хеш не нужен:
+// ключ случайный и длинный, подбирать его по словарю бессмысленно
+func HashAPIKey(key string) string {
+	return hashToken(key)
+}
+
+// hashToken возвращает SHA-256 случайного секрета (ключа, идентификатора сессии) в hex
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseScopes разбирает список разрешений через запятую
+func ParseScopes(s string) []string {
+	scopes := []string{}
+	for _, scope := range strings.Split(s, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// unauthorized отвечает 401 с подсказкой, как аутентифицироваться: API-ключом
+// или bearer-токеном. bearerError - код ошибки токена по RFC 6750, если
+// клиент передал негодный токен
+func unauthorized(w http.ResponseWriter, r *http.Request, detail, bearerError string) {
+	bearer := `Bearer realm="api"`
+	if bearerError != "" {
+		bearer += `, error="` + bearerError + `"`
+	}
+	w.Header().Add("WWW-Authenticate", `ApiKey header="`+APIKeyHeader+`"`)
+	w.Header().Add("WWW-Authenticate", bearer)
+	problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, detail)
+}
+
+// RequireAPIKey пропускает только запросы с действующим ключом в заголовке
+// X-API-Key и кладет в контекст Principal с разрешениями ключа.
+// Ключ проверяется по хранилищу при каждом запросе, поэтому отзыв действует сразу
+func RequireAPIKey(keys storage.APIKeyStorage, logger *slog.Logger) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw := r.Header.Get(APIKeyHeader)
+			if raw == "" {
+				unauthorized(w, r, "Не передан API-ключ (заголовок "+APIKeyHeader+") или bearer-токен", "")
+				return
+			}
+			key, err := keys.AuthenticateAPIKey(r.Context(), HashAPIKey(raw))
+			if err != nil {
+				attrs := []slog.Attr{slog.String("method", r.Method), slog.String("path", r.URL.Path), logging.Err(err)}
+				switch {
+				case errors.Is(err, context.Canceled):
+				case errors.Is(err, storage.ErrAPIKeyRevoked):
+					logger.LogAttrs(r.Context(), slog.LevelInfo, "запрос с отозванным API-ключом", attrs...)
+					unauthorized(w, r, "API-ключ отозван", "")
+				case errors.Is(err, storage.ErrAPIKeyExpired):
+					logger.LogAttrs(r.Context(), slog.LevelInfo, "запрос с просроченным API-ключом", attrs...)
+					unauthorized(w, r, "Срок действия API-ключа истек", "")
+				case errors.Is(err, storage.ErrAPIKeyNotFound):
+					logger.LogAttrs(r.Context(), slog.LevelInfo, "запрос с неизвестным API-ключом", attrs...)
+					unauthorized(w, r, "Недействительный API-ключ", "")
+				default:
+					logger.LogAttrs(r.Context(), slog.LevelError, "ошибка проверки API-ключа", attrs...)
+					problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Не удалось проверить API-ключ")
+				}
+				return
+			}
+
+			p := &Principal{Kind: KindAPIKey, ID: strconv.FormatInt(key.ID, 10), Name: key.Name, Scopes: key.Scopes}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/casanera/DlugoshSolutions/internal/models"
+	"github.com/casanera/DlugoshSolutions/internal/problem"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// issue выпускает ключ в мок-хранилище и возвращает его открытое значение
+func issue(t *testing.T, keys *storage.MockAPIKeyStorage, k *models.APIKey) string {
+	t.Helper()
+	raw, prefix, hash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Prefix = prefix
+	if _, err := keys.CreateAPIKey(context.Background(), k, hash); err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, hash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, apiKeyPrefix) || !strings.HasPrefix(key, prefix) || len(prefix) != visiblePrefixLength {
+		t.Errorf("Неожиданный формат: ключ %q, префикс %q", key, prefix)
+	}
+	if hash != HashAPIKey(key) || len(hash) != 64 {
+		t.Errorf("Хеш %q не соответствует ключу", hash)
+	}
+	other, _, _, _ := GenerateAPIKey()
+	if other == key {
+		t.Error("Два ключа совпали")
+	}
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	keys := storage.NewMockAPIKeyStorage()
+	valid := issue(t, keys, &models.APIKey{Name: "ci", Scopes: []string{"users:read"}})
+	past := time.Now().Add(-time.Hour)
+	expired := issue(t, keys, &models.APIKey{Name: "old", ExpiresAt: &past})
+	revoked := issue(t, keys, &models.APIKey{Name: "leaked"})
+	if err := keys.RevokeAPIKey(context.Background(), 3); err != nil {
+		t.Fatal(err)
+	}
+
+	var got *Principal
+	h := RequireAPIKey(keys, discardLogger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = PrincipalFromContext(r.Context())
+	}))
+
+	testCases := []struct {
+		name           string
+		key            string
+		storageErr     error
+		expectedStatus int
+		expectedDetail string
+	}{
+		{"Без ключа", "", nil, http.StatusUnauthorized, "Не передан"},
+		{"Неизвестный ключ", "dk_unknown", nil, http.StatusUnauthorized, "Недействительный"},
+		{"Просроченный ключ", expired, nil, http.StatusUnauthorized, "истек"},
+		{"Отозванный ключ", revoked, nil, http.StatusUnauthorized, "отозван"},
+		{"Ошибка хранилища", valid, errors.New("connection refused"), http.StatusInternalServerError, ""},
+		{"Действующий ключ", valid, nil, http.StatusOK, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got = nil
+			keys.ReturnError = tc.storageErr
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+			if tc.key != "" {
+				req.Header.Set(APIKeyHeader, tc.key)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Статус %d, ожидался %d. Тело: %s", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			if tc.expectedStatus == http.StatusUnauthorized {
+				if rr.Header().Get("WWW-Authenticate") == "" || rr.Header().Get("Content-Type") != problem.ContentType {
+					t.Errorf("Ответ 401 без WWW-Authenticate или не problem+json: %v", rr.Header())
+				}
+				if !strings.Contains(rr.Body.String(), tc.expectedDetail) {
+					t.Errorf("В ответе нет %q: %s", tc.expectedDetail, rr.Body.String())
+				}
+			}
+			if tc.expectedStatus == http.StatusOK {
+				if got == nil || got.Kind != KindAPIKey || got.Name != "ci" || !got.HasScope("users:read") {
+					t.Errorf("Неожиданный субъект: %+v", got)
+				}
+			} else if got != nil {
+				t.Error("Запрос без действующего ключа дошел до обработчика")
+			}
+		})
+	}
+}
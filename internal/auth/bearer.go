@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/casanera/DlugoshSolutions/internal/logging"
+	"github.com/casanera/DlugoshSolutions/internal/middleware"
+)
+
+// bearerToken извлекает токен из заголовка Authorization: Bearer.
+// Схема сравнивается без учета регистра (RFC 7235)
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// RequireBearer пропускает только запросы с действующим JWT в заголовке
+// Authorization: Bearer и кладет в контекст Principal с subject и
+// разрешениями из поля scope
+func RequireBearer(tokens *Verifier, logger *slog.Logger) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw, ok := bearerToken(r)
+			if !ok {
+				unauthorized(w, r, "Не передан bearer-токен (заголовок Authorization)", "")
+				return
+			}
+			claims, err := tokens.Verify(raw)
+			if err != nil {
+				logger.LogAttrs(r.Context(), slog.LevelInfo, "отклонен bearer-токен",
+					slog.String("method", r.Method), slog.String("path", r.URL.Path), logging.Err(err))
+				detail := "Недействительный токен"
+				if errors.Is(err, ErrTokenExpired) {
+					detail = "Срок действия токена истек"
+				}
+				unauthorized(w, r, detail, "invalid_token")
+				return
+			}
+
+			name := claims.Name
+			if name == "" {
+				name = claims.Subject
+			}
+			p := &Principal{Kind: KindToken, ID: claims.Subject, Name: name, Scopes: claims.Scopes(), UserID: claims.UserID}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// Authenticate выбирает способ проверки по учетным данным запроса: заголовок
+// Authorization: Bearer - JWT, заголовок X-API-Key - API-ключ, cookie
+// сессии - сессия браузера. Запрос без учетных данных проверяется как
+// запрос с API-ключом и получает 401
+func Authenticate(keys, tokens, sessions middleware.Middleware) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		viaKey, viaToken, viaSession := keys(next), tokens(next), sessions(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, hasBearer := bearerToken(r)
+			switch {
+			case hasBearer:
+				viaToken.ServeHTTP(w, r)
+			case r.Header.Get(APIKeyHeader) == "" && SessionHash(r) != "":
+				viaSession.ServeHTTP(w, r)
+			default:
+				viaKey.ServeHTTP(w, r)
+			}
+		})
+	}
+}
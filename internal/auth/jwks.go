@@ -0,0 +1,315 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+)
+
+// Поддерживаемые алгоритмы подписи токенов
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// minRSABits - минимальный размер RSA-ключа; короче считаются небезопасными
+const minRSABits = 2048
+
+// Key - ключ подписи токенов из JWKS. У ключей других сервисов есть только
+// открытая часть; у собственных ключей сервиса - еще и закрытая
+type Key struct {
+	ID      string
+	Alg     string // AlgRS256 или AlgEdDSA
+	Public  crypto.PublicKey
+	private crypto.Signer
+}
+
+// CanSign сообщает, есть ли у ключа закрытая часть
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+// GenerateKey создает собственный ключ сервиса для алгоритма alg.
+// Если kid пустой, идентификатором становится отпечаток ключа (RFC 7638)
+func GenerateKey(alg, kid string) (*Key, error) {
+	var signer crypto.Signer
+	var err error
+	switch alg {
+	case AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	case AlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, minRSABits)
+	default:
+		return nil, fmt.Errorf("auth: неподдерживаемый алгоритм ключа %q (ожидается %s или %s)", alg, AlgRS256, AlgEdDSA)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("auth: генерация ключа %s: %w", alg, err)
+	}
+	k := &Key{ID: kid, Alg: alg, Public: signer.Public(), private: signer}
+	if k.ID == "" {
+		k.ID = k.thumbprint()
+	}
+	return k, nil
+}
+
+// KeySet - набор ключей из JWKS-файла
+type KeySet struct {
+	Keys []*Key
+}
+
+// Lookup возвращает ключи, подходящие для проверки подписи с алгоритмом alg
+// и идентификатором kid. Без kid подходят все ключи этого алгоритма
+func (ks *KeySet) Lookup(alg, kid string) []*Key {
+	if ks == nil {
+		return nil
+	}
+	var found []*Key
+	for _, k := range ks.Keys {
+		if k.Alg == alg && (kid == "" || k.ID == kid) {
+			found = append(found, k)
+		}
+	}
+	return found
+}
+
+// SigningKey возвращает ключ для выпуска токенов: последний из ключей с
+// закрытой частью, чтобы при ротации новый ключ добавлялся в конец файла,
+// а старые оставались для проверки ранее выпущенных токенов
+func (ks *KeySet) SigningKey() *Key {
+	if ks == nil {
+		return nil
+	}
+	for i := len(ks.Keys) - 1; i >= 0; i-- {
+		if ks.Keys[i].CanSign() {
+			return ks.Keys[i]
+		}
+	}
+	return nil
+}
+
+// jwk - представление ключа в JSON (RFC 7517, 7518, 8037)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// OKP (Ed25519)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	// RSA
+	N  string `json:"n,omitempty"`
+	E  string `json:"e,omitempty"`
+	P  string `json:"p,omitempty"`
+	Q  string `json:"q,omitempty"`
+	DP string `json:"dp,omitempty"`
+	DQ string `json:"dq,omitempty"`
+	QI string `json:"qi,omitempty"`
+	// Закрытая часть: seed для Ed25519, приватная экспонента для RSA
+	D string `json:"d,omitempty"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// LoadKeySet читает JWKS из файла
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: чтение JWKS: %w", err)
+	}
+	ks, err := ParseKeySet(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w (файл %s)", err, path)
+	}
+	return ks, nil
+}
+
+// ParseKeySet разбирает JWKS. Ключи шифрования (use=enc) пропускаются,
+// ключи неподдерживаемых типов считаются ошибкой
+func ParseKeySet(data []byte) (*KeySet, error) {
+	var set jwkSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("auth: разбор JWKS: %w", err)
+	}
+	ks := &KeySet{}
+	for i, j := range set.Keys {
+		if j.Use == "enc" {
+			continue
+		}
+		k, err := j.key()
+		if err != nil {
+			return nil, fmt.Errorf("auth: ключ %d (kid %q): %w", i, j.Kid, err)
+		}
+		ks.Keys = append(ks.Keys, k)
+	}
+	return ks, nil
+}
+
+func (j *jwk) key() (*Key, error) {
+	switch j.Kty {
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, fmt.Errorf("неподдерживаемая кривая %q", j.Crv)
+		}
+		if j.Alg != "" && j.Alg != AlgEdDSA {
+			return nil, fmt.Errorf("алгоритм %q не подходит для Ed25519", j.Alg)
+		}
+		x, err := decodeSegment(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("некорректный открытый ключ Ed25519 (x)")
+		}
+		k := &Key{ID: j.Kid, Alg: AlgEdDSA, Public: ed25519.PublicKey(x)}
+		if j.D != "" {
+			seed, err := decodeSegment(j.D)
+			if err != nil || len(seed) != ed25519.SeedSize {
+				return nil, errors.New("некорректный закрытый ключ Ed25519 (d)")
+			}
+			priv := ed25519.NewKeyFromSeed(seed)
+			if !priv.Public().(ed25519.PublicKey).Equal(k.Public) {
+				return nil, errors.New("закрытый ключ Ed25519 не соответствует открытому")
+			}
+			k.private = priv
+		}
+		return k, nil
+	case "RSA":
+		if j.Alg != "" && j.Alg != AlgRS256 {
+			return nil, fmt.Errorf("алгоритм %q не поддерживается для RSA", j.Alg)
+		}
+		n, errN := decodeBigInt(j.N)
+		e, errE := decodeBigInt(j.E)
+		if errN != nil || errE != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("некорректный открытый ключ RSA (n, e)")
+		}
+		if n.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA-ключ короче %d бит", minRSABits)
+		}
+		pub := &rsa.PublicKey{N: n, E: int(e.Int64())}
+		k := &Key{ID: j.Kid, Alg: AlgRS256, Public: pub}
+		if j.D != "" {
+			priv, err := j.rsaPrivateKey(pub)
+			if err != nil {
+				return nil, err
+			}
+			k.private = priv
+		}
+		return k, nil
+	default:
+		return nil, fmt.Errorf("неподдерживаемый тип ключа %q", j.Kty)
+	}
+}
+
+func (j *jwk) rsaPrivateKey(pub *rsa.PublicKey) (*rsa.PrivateKey, error) {
+	d, errD := decodeBigInt(j.D)
+	p, errP := decodeBigInt(j.P)
+	q, errQ := decodeBigInt(j.Q)
+	if err := errors.Join(errD, errP, errQ); err != nil {
+		return nil, errors.New("некорректный закрытый ключ RSA: нужны d, p и q")
+	}
+	priv := &rsa.PrivateKey{PublicKey: *pub, D: d, Primes: []*big.Int{p, q}}
+	if err := priv.Validate(); err != nil {
+		return nil, fmt.Errorf("некорректный закрытый ключ RSA: %w", err)
+	}
+	priv.Precompute()
+	return priv, nil
+}
+
+// toJWK сериализует ключ; закрытая часть включается только при withPrivate
+func (k *Key) toJWK(withPrivate bool) jwk {
+	j := jwk{Kid: k.ID, Use: "sig", Alg: k.Alg}
+	switch pub := k.Public.(type) {
+	case ed25519.PublicKey:
+		j.Kty, j.Crv, j.X = "OKP", "Ed25519", encodeSegment(pub)
+		if priv, ok := k.private.(ed25519.PrivateKey); ok && withPrivate {
+			j.D = encodeSegment(priv.Seed())
+		}
+	case *rsa.PublicKey:
+		j.Kty, j.N, j.E = "RSA", encodeSegment(pub.N.Bytes()), encodeSegment(big.NewInt(int64(pub.E)).Bytes())
+		if priv, ok := k.private.(*rsa.PrivateKey); ok && withPrivate {
+			j.D = encodeSegment(priv.D.Bytes())
+			j.P = encodeSegment(priv.Primes[0].Bytes())
+			j.Q = encodeSegment(priv.Primes[1].Bytes())
+			j.DP = encodeSegment(priv.Precomputed.Dp.Bytes())
+			j.DQ = encodeSegment(priv.Precomputed.Dq.Bytes())
+			j.QI = encodeSegment(priv.Precomputed.Qinv.Bytes())
+		}
+	}
+	return j
+}
+
+// thumbprint вычисляет отпечаток открытого ключа по RFC 7638
+func (k *Key) thumbprint() string {
+	j := k.toJWK(false)
+	var canonical string
+	if j.Kty == "OKP" {
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, j.Crv, j.Kty, j.X)
+	} else {
+		canonical = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, j.E, j.Kty, j.N)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return encodeSegment(sum[:])
+}
+
+// MarshalPrivate сериализует набор целиком, вместе с закрытыми ключами, для записи в файл
+func (ks *KeySet) MarshalPrivate() ([]byte, error) {
+	set := jwkSet{Keys: []jwk{}}
+	for _, k := range ks.Keys {
+		set.Keys = append(set.Keys, k.toJWK(true))
+	}
+	return json.MarshalIndent(set, "", "  ")
+}
+
+// PublicJWKS возвращает открытые части собственных ключей сервиса (тех, что
+// с закрытой частью) - их публикуют, чтобы другие сервисы могли проверять
+// выпущенные здесь токены. Чужие ключи из файла не публикуются
+func (ks *KeySet) PublicJWKS() ([]byte, error) {
+	set := jwkSet{Keys: []jwk{}}
+	if ks != nil {
+		for _, k := range ks.Keys {
+			if k.CanSign() {
+				set.Keys = append(set.Keys, k.toJWK(false))
+			}
+		}
+	}
+	return json.Marshal(set)
+}
+
+// JWKSHandler отдает /.well-known/jwks.json. Набор сериализуется один раз:
+// ключи меняются только при перезапуске
+func JWKSHandler(ks *KeySet) (http.HandlerFunc, error) {
+	body, err := ks.PublicJWKS()
+	if err != nil {
+		return nil, fmt.Errorf("auth: сериализация JWKS: %w", err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.Write(body)
+	}, nil
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := decodeSegment(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("некорректное число")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ошибки проверки токена
+var (
+	ErrTokenMalformed       = errors.New("некорректный формат токена")
+	ErrTokenUnverifiable    = errors.New("нет ключа для проверки подписи")
+	ErrTokenSignature       = errors.New("неверная подпись токена")
+	ErrTokenExpired         = errors.New("срок действия токена истек")
+	ErrTokenNotValidYet     = errors.New("токен еще не действует")
+	ErrTokenInvalidAudience = errors.New("токен выпущен для другого получателя")
+	ErrTokenInvalidIssuer   = errors.New("токен выпущен неизвестным издателем")
+	ErrTokenInvalidClaims   = errors.New("в токене нет обязательных полей")
+)
+
+// NumericDate - время в секундах Unix, как в полях exp, nbf и iat (RFC 7519)
+type NumericDate int64
+
+// NewNumericDate округляет t до секунд
+func NewNumericDate(t time.Time) *NumericDate {
+	d := NumericDate(t.Unix())
+	return &d
+}
+
+// Time переводит значение в time.Time
+func (d NumericDate) Time() time.Time {
+	return time.Unix(int64(d), 0)
+}
+
+// UnmarshalJSON допускает дробные секунды, которые разрешает RFC 7519
+func (d *NumericDate) UnmarshalJSON(b []byte) error {
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("ожидается время в секундах, получено %s", b)
+	}
+	*d = NumericDate(math.Floor(f))
+	return nil
+}
+
+// Audience - поле aud: по RFC 7519 строка или массив строк
+type Audience []string
+
+// UnmarshalJSON принимает обе формы
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return errors.New("aud должен быть строкой или массивом строк")
+	}
+	*a = many
+	return nil
+}
+
+// MarshalJSON записывает единственного получателя строкой
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// Claims - поля токена, которые понимает сервис
+type Claims struct {
+	Issuer    string       `json:"iss,omitempty"`
+	Subject   string       `json:"sub,omitempty"`
+	Audience  Audience     `json:"aud,omitempty"`
+	ExpiresAt *NumericDate `json:"exp,omitempty"`
+	NotBefore *NumericDate `json:"nbf,omitempty"`
+	IssuedAt  *NumericDate `json:"iat,omitempty"`
+	ID        string       `json:"jti,omitempty"`
+	Scope     string       `json:"scope,omitempty"` // разрешения через пробел (RFC 8693)
+	Name      string       `json:"name,omitempty"`
+	// UserID связывает токен с пользователем этого сервиса: права такого
+	// токена определяются ролями пользователя
+	UserID int64 `json:"uid,omitempty"`
+}
+
+// Scopes возвращает разрешения из поля scope
+func (c *Claims) Scopes() []string {
+	scopes := strings.Fields(c.Scope)
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return scopes
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Verifier проверяет подпись и поля токенов. HS256 проверяется общим
+// секретом Secret, RS256 и EdDSA - открытыми ключами из Keys.
+// Пустые Issuer и Audience не проверяются
+type Verifier struct {
+	Secret   []byte
+	Keys     *KeySet
+	Issuer   string
+	Audience string
+	Leeway   time.Duration // допустимое расхождение часов при проверке exp и nbf
+
+	now func() time.Time
+}
+
+// Verify проверяет токен и возвращает его поля. Обязательны sub и exp
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("auth: %w: ожидается три части через точку", ErrTokenMalformed)
+	}
+	var header jwtHeader
+	if err := decodeJSONSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("auth: заголовок: %w", err)
+	}
+	sig, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("auth: %w: подпись не в base64url", ErrTokenMalformed)
+	}
+	if err := v.verifySignature(header, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	// Поля разбираются только после проверки подписи
+	var claims Claims
+	if err := decodeJSONSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("auth: поля: %w", err)
+	}
+	if err := v.validate(&claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// verifySignature выбирает ключ строго по алгоритму из заголовка: ключ
+// одного типа нельзя использовать для другого алгоритма (например,
+// открытый RSA-ключ как секрет HS256), а alg=none не принимается вовсе
+func (v *Verifier) verifySignature(header jwtHeader, signed, sig []byte) error {
+	switch header.Alg {
+	case AlgHS256:
+		if len(v.Secret) == 0 {
+			return fmt.Errorf("auth: %w: секрет HS256 не настроен", ErrTokenUnverifiable)
+		}
+		mac := hmac.New(sha256.New, v.Secret)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return fmt.Errorf("auth: %w", ErrTokenSignature)
+		}
+		return nil
+	case AlgRS256, AlgEdDSA:
+		keys := v.Keys.Lookup(header.Alg, header.Kid)
+		if len(keys) == 0 {
+			return fmt.Errorf("auth: %w: алгоритм %s, kid %q", ErrTokenUnverifiable, header.Alg, header.Kid)
+		}
+		for _, k := range keys {
+			if k.verify(signed, sig) {
+				return nil
+			}
+		}
+		return fmt.Errorf("auth: %w", ErrTokenSignature)
+	default:
+		return fmt.Errorf("auth: %w: неподдерживаемый алгоритм %q", ErrTokenUnverifiable, header.Alg)
+	}
+}
+
+func (v *Verifier) validate(c *Claims) error {
+	now := time.Now()
+	if v.now != nil {
+		now = v.now()
+	}
+	if c.Subject == "" || c.ExpiresAt == nil {
+		return fmt.Errorf("auth: %w: нужны sub и exp", ErrTokenInvalidClaims)
+	}
+	if !now.Before(c.ExpiresAt.Time().Add(v.Leeway)) {
+		return fmt.Errorf("auth: %w в %s", ErrTokenExpired, c.ExpiresAt.Time().UTC().Format(time.RFC3339))
+	}
+	if c.NotBefore != nil && now.Add(v.Leeway).Before(c.NotBefore.Time()) {
+		return fmt.Errorf("auth: %w до %s", ErrTokenNotValidYet, c.NotBefore.Time().UTC().Format(time.RFC3339))
+	}
+	if v.Issuer != "" && c.Issuer != v.Issuer {
+		return fmt.Errorf("auth: %w: %q", ErrTokenInvalidIssuer, c.Issuer)
+	}
+	if v.Audience != "" && !slices.Contains(c.Audience, v.Audience) {
+		return fmt.Errorf("auth: %w: %q", ErrTokenInvalidAudience, []string(c.Audience))
+	}
+	return nil
+}
+
+func (k *Key) verify(signed, sig []byte) bool {
+	switch pub := k.Public.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, signed, sig)
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig) == nil
+	}
+	return false
+}
+
+// Sign выпускает токен, подписанный собственным ключом сервиса
+func (k *Key) Sign(claims *Claims) (string, error) {
+	if !k.CanSign() {
+		return "", fmt.Errorf("auth: у ключа %q нет закрытой части", k.ID)
+	}
+	signed, err := signingInput(jwtHeader{Alg: k.Alg, Kid: k.ID, Typ: "JWT"}, claims)
+	if err != nil {
+		return "", err
+	}
+	var sig []byte
+	switch priv := k.private.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(priv, []byte(signed))
+	case *rsa.PrivateKey:
+		sum := sha256.Sum256([]byte(signed))
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, sum[:]); err != nil {
+			return "", fmt.Errorf("auth: подпись токена: %w", err)
+		}
+	}
+	return signed + "." + encodeSegment(sig), nil
+}
+
+// SignHS256 выпускает токен, подписанный общим секретом
+func SignHS256(claims *Claims, secret []byte) (string, error) {
+	if len(secret) == 0 {
+		return "", errors.New("auth: секрет HS256 не задан")
+	}
+	signed, err := signingInput(jwtHeader{Alg: AlgHS256, Typ: "JWT"}, claims)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + encodeSegment(mac.Sum(nil)), nil
+}
+
+func signingInput(header jwtHeader, claims *Claims) (string, error) {
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("auth: сериализация заголовка: %w", err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("auth: сериализация полей: %w", err)
+	}
+	return encodeSegment(h) + "." + encodeSegment(c), nil
+}
+
+func decodeJSONSegment(s string, v any) error {
+	b, err := decodeSegment(s)
+	if err != nil {
+		return fmt.Errorf("%w: не base64url", ErrTokenMalformed)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrTokenMalformed, err)
+	}
+	return nil
+}
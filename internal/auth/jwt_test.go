@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// mustKey создает ключ или останавливает тест
+func mustKey(t *testing.T, alg, kid string) *Key {
+	t.Helper()
+	k, err := GenerateKey(alg, kid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func validClaims(now time.Time) *Claims {
+	return &Claims{
+		Issuer:    "https://auth.example.com",
+		Subject:   "svc-billing",
+		Audience:  Audience{"dlugosh-api"},
+		ExpiresAt: NewNumericDate(now.Add(time.Hour)),
+		Scope:     "users:read users:write",
+	}
+}
+
+func TestVerifyAlgorithms(t *testing.T) {
+	now := time.Now()
+	ed := mustKey(t, AlgEdDSA, "ed-1")
+	rsaKey := mustKey(t, AlgRS256, "")
+	foreign := mustKey(t, AlgEdDSA, "ed-1") // тот же kid, но чужой ключ
+	v := &Verifier{
+		Secret:   testSecret,
+		Keys:     &KeySet{Keys: []*Key{ed, rsaKey}},
+		Issuer:   "https://auth.example.com",
+		Audience: "dlugosh-api",
+		now:      func() time.Time { return now },
+	}
+
+	sign := func(f func(*Claims) (string, error)) string {
+		token, err := f(validClaims(now))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	hs := sign(func(c *Claims) (string, error) { return SignHS256(c, testSecret) })
+	// alg=none и HS256, подписанный открытым RSA-ключом как секретом, - классические атаки
+	unsigned := encodeSegment([]byte(`{"alg":"none"}`)) + "." + strings.Split(hs, ".")[1] + "."
+	rsaJWK, _ := json.Marshal(rsaKey.toJWK(false))
+	confused := sign(func(c *Claims) (string, error) { return SignHS256(c, rsaJWK) })
+
+	testCases := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"HS256", hs, nil},
+		{"EdDSA", sign(ed.Sign), nil},
+		{"RS256", sign(rsaKey.Sign), nil},
+		{"Чужой ключ с тем же kid", sign(foreign.Sign), ErrTokenSignature},
+		{"Неверный секрет", sign(func(c *Claims) (string, error) { return SignHS256(c, []byte("another-secret-another-secret-00")) }), ErrTokenSignature},
+		{"alg=none", unsigned, ErrTokenUnverifiable},
+		{"Путаница алгоритмов", confused, ErrTokenSignature},
+		{"Мусор", "not-a-token", ErrTokenMalformed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := v.Verify(tc.token)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Ошибка %v, ожидалась %v", err, tc.wantErr)
+			}
+			if err == nil && (claims.Subject != "svc-billing" || len(claims.Scopes()) != 2) {
+				t.Errorf("Неожиданные поля: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestVerifyClaims(t *testing.T) {
+	now := time.Now()
+	v := &Verifier{
+		Secret:   testSecret,
+		Issuer:   "https://auth.example.com",
+		Audience: "dlugosh-api",
+		Leeway:   30 * time.Second,
+		now:      func() time.Time { return now },
+	}
+
+	testCases := []struct {
+		name    string
+		modify  func(c *Claims)
+		wantErr error
+	}{
+		{"Действующий", func(c *Claims) {}, nil},
+		{"Истек", func(c *Claims) { c.ExpiresAt = NewNumericDate(now.Add(-time.Minute)) }, ErrTokenExpired},
+		{"Истек в пределах расхождения часов", func(c *Claims) { c.ExpiresAt = NewNumericDate(now.Add(-10 * time.Second)) }, nil},
+		{"Еще не действует", func(c *Claims) { c.NotBefore = NewNumericDate(now.Add(time.Minute)) }, ErrTokenNotValidYet},
+		{"Чужой получатель", func(c *Claims) { c.Audience = Audience{"other-api"} }, ErrTokenInvalidAudience},
+		{"Один из получателей", func(c *Claims) { c.Audience = Audience{"other-api", "dlugosh-api"} }, nil},
+		{"Чужой издатель", func(c *Claims) { c.Issuer = "https://evil.example.com" }, ErrTokenInvalidIssuer},
+		{"Без exp", func(c *Claims) { c.ExpiresAt = nil }, ErrTokenInvalidClaims},
+		{"Без sub", func(c *Claims) { c.Subject = "" }, ErrTokenInvalidClaims},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := validClaims(now)
+			tc.modify(c)
+			token, err := SignHS256(c, testSecret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := v.Verify(token); !errors.Is(err, tc.wantErr) {
+				t.Errorf("Ошибка %v, ожидалась %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestClaimsJSON(t *testing.T) {
+	var c Claims
+	if err := json.Unmarshal([]byte(`{"sub":"a","aud":"x","exp":1700000000.75}`), &c); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Audience) != 1 || c.Audience[0] != "x" || *c.ExpiresAt != 1700000000 {
+		t.Errorf("Неожиданный разбор: %+v", c)
+	}
+	out, _ := json.Marshal(Claims{Audience: Audience{"x"}})
+	if string(out) != `{"aud":"x"}` {
+		t.Errorf("Единственный получатель должен записываться строкой: %s", out)
+	}
+}
+
+func TestKeySetRoundTrip(t *testing.T) {
+	own := mustKey(t, AlgEdDSA, "own")
+	rotated := mustKey(t, AlgRS256, "rotated")
+	foreign := &Key{ID: "foreign", Alg: AlgEdDSA, Public: mustKey(t, AlgEdDSA, "").Public}
+	data, err := (&KeySet{Keys: []*Key{own, foreign, rotated}}).MarshalPrivate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := ParseKeySet(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks.Keys) != 3 || ks.Keys[1].CanSign() || ks.SigningKey().ID != "rotated" {
+		t.Fatalf("Набор разобран неверно: %d ключей, подпись ключом %q", len(ks.Keys), ks.SigningKey().ID)
+	}
+	// Ключ после разбора подписывает токены, которые проверяются исходным
+	token, err := ks.SigningKey().Sign(validClaims(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&Verifier{Keys: &KeySet{Keys: []*Key{rotated}}}).Verify(token); err != nil {
+		t.Errorf("Токен не прошел проверку: %v", err)
+	}
+
+	handler, err := JWKSHandler(ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	var published jwkSet
+	if err := json.Unmarshal(rr.Body.Bytes(), &published); err != nil {
+		t.Fatal(err)
+	}
+	if len(published.Keys) != 2 || published.Keys[0].Kid != "own" || published.Keys[1].Kid != "rotated" {
+		t.Errorf("Опубликованы не те ключи: %s", rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), `"d"`) {
+		t.Errorf("Опубликована закрытая часть ключа: %s", rr.Body.String())
+	}
+}
+
+func TestParseKeySetErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"keys":[{"kty":"EC","crv":"P-256"}]}`,
+		`{"keys":[{"kty":"OKP","crv":"Ed25519","x":"short"}]}`,
+		`{"keys":[{"kty":"RSA","n":"AQAB","e":"AQAB"}]}`, // слишком короткий ключ
+		`not json`,
+	} {
+		if _, err := ParseKeySet([]byte(data)); err == nil {
+			t.Errorf("Ожидалась ошибка для %s", data)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	v := &Verifier{Secret: testSecret}
+	valid, _ := SignHS256(validClaims(time.Now()), testSecret)
+	expired := validClaims(time.Now())
+	expired.ExpiresAt = NewNumericDate(time.Now().Add(-time.Hour))
+	expiredToken, _ := SignHS256(expired, testSecret)
+
+	var got *Principal
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = PrincipalFromContext(r.Context())
+	})
+	// API-ключи и сессии в этом тесте не проверяются: вместо них - заглушка
+	reject := func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			unauthorized(w, r, "ключ", "")
+		})
+	}
+	h := Authenticate(reject, RequireBearer(v, discardLogger), reject)(next)
+
+	testCases := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+		expectedError  string
+	}{
+		{"Действующий токен", "Bearer " + valid, http.StatusOK, ""},
+		{"Схема в нижнем регистре", "bearer " + valid, http.StatusOK, ""},
+		{"Просроченный токен", "Bearer " + expiredToken, http.StatusUnauthorized, `error="invalid_token"`},
+		{"Без токена - проверка ключа", "", http.StatusUnauthorized, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got = nil
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Статус %d, ожидался %d. Тело: %s", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			challenges := strings.Join(rr.Header().Values("WWW-Authenticate"), "; ")
+			if tc.expectedError != "" && !strings.Contains(challenges, tc.expectedError) {
+				t.Errorf("WWW-Authenticate %q не содержит %q", challenges, tc.expectedError)
+			}
+			if tc.expectedStatus == http.StatusOK {
+				if got == nil || got.Kind != KindToken || got.ID != "svc-billing" || !got.HasScope("users:write") {
+					t.Errorf("Неожиданный субъект: %+v", got)
+				}
+			} else if got != nil {
+				t.Error("Запрос без действующего токена дошел до обработчика")
+			}
+		})
+	}
+}
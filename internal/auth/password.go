@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+// Ограничения длины пароля. Верхняя граница защищает от запросов с
+// мегабайтным паролем, который пришлось бы хешировать
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 128
+)
+
+// argon2Params - параметры argon2id. Значения по умолчанию - второй
+// рекомендованный вариант RFC 9106 с уменьшенным параллелизмом
+type argon2Params struct {
+	memory  uint32 // КиБ
+	time    uint32
+	threads uint8
+	saltLen int
+	keyLen  uint32
+}
+
+var defaultArgon2 = argon2Params{memory: 64 * 1024, time: 3, threads: 2, saltLen: 16, keyLen: 32}
+
+// ValidatePassword проверяет длину пароля
+func ValidatePassword(password string) error {
+	n := utf8.RuneCountInString(password)
+	switch {
+	case n < MinPasswordLength:
+		return &storage.ValidationError{Field: "password", Message: fmt.Sprintf("не короче %d символов", MinPasswordLength)}
+	case n > MaxPasswordLength:
+		return &storage.ValidationError{Field: "password", Message: fmt.Sprintf("не длиннее %d символов", MaxPasswordLength)}
+	}
+	return nil
+}
+
+// HashPassword возвращает хеш argon2id в формате PHC:
+// $argon2id$v=19$m=65536,t=3,p=2$соль$хеш
+func HashPassword(password string) (string, error) {
+	p := defaultArgon2
+	salt := make([]byte, p.saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("auth: генерация соли: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, p.keyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword сравнивает пароль с хешем argon2id или bcrypt (хеши bcrypt
+// могут прийти из других систем при импорте пользователей)
+func VerifyPassword(encoded, password string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		p, salt, key, err := parseArgon2(encoded)
+		if err != nil {
+			return false, err
+		}
+		computed := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(computed, key) == 1, nil
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("auth: хеш bcrypt: %w", err)
+		}
+		return true, nil
+	default:
+		return false, errors.New("auth: неизвестный формат хеша пароля")
+	}
+}
+
+// NeedsRehash сообщает, что хеш получен не текущим алгоритмом или с другими
+// параметрами. Такой хеш заменяется при следующем успешном входе
+func NeedsRehash(encoded string) bool {
+	p, salt, key, err := parseArgon2(encoded)
+	if err != nil {
+		return true
+	}
+	d := defaultArgon2
+	return p.memory != d.memory || p.time != d.time || p.threads != d.threads ||
+		len(salt) != d.saltLen || len(key) != int(d.keyLen)
+}
+
+func parseArgon2(encoded string) (p argon2Params, salt, key []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, errors.New("auth: некорректный хеш argon2id")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("auth: неподдерживаемая версия argon2id %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, nil, nil, fmt.Errorf("auth: некорректные параметры argon2id %q", parts[3])
+	}
+	salt, errSalt := base64.RawStdEncoding.DecodeString(parts[4])
+	key, errKey := base64.RawStdEncoding.DecodeString(parts[5])
+	if errSalt != nil || errKey != nil || len(key) == 0 {
+		return p, nil, nil, errors.New("auth: некорректные соль или хеш argon2id")
+	}
+	return p, salt, key, nil
+}
+
+var (
+	dummyOnce sync.Once
+	dummyHash string
+)
+
+// VerifyDummy тратит на проверку столько же времени, сколько настоящая
+// проверка пароля. Вызывается, когда пользователь не найден, чтобы по
+// времени ответа нельзя было узнать, зарегистрирован ли email
+func VerifyDummy(password string) {
+	dummyOnce.Do(func() {
+		dummyHash, _ = HashPassword("dummy-password")
+	})
+	VerifyPassword(dummyHash, password)
+}
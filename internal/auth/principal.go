@@ -0,0 +1,76 @@
+// Package auth отвечает за аутентификацию запросов к API: кто выполняет
+// запрос (Principal) и с какими разрешениями (scopes)
+package auth
+
+import (
+	"context"
+	"slices"
+
+	"github.com/casanera/DlugoshSolutions/internal/audit"
+)
+
+// Виды субъектов
+const (
+	KindAPIKey  = "api_key"
+	KindToken   = "jwt"
+	KindSession = "session"
+)
+
+// Разрешения на операции с пользователями
+const (
+	PermUsersRead   = "users:read"
+	PermUsersWrite  = "users:write"
+	PermUsersDelete = "users:delete"
+)
+
+// PermAuditRead - просмотр журнала аудита
+const PermAuditRead = "audit:read"
+
+// SelfSuffix ограничивает разрешение собственной записью субъекта:
+// users:write:self позволяет изменять только свою запись
+const SelfSuffix = ":self"
+
+// Principal - аутентифицированный субъект запроса
+type Principal struct {
+	Kind   string   // KindAPIKey, KindToken или KindSession
+	ID     string   // идентификатор в пределах вида (ID ключа, subject токена, ID пользователя)
+	Name   string   // человекочитаемое имя для журналов
+	Scopes []string // разрешения, например users:read
+	// UserID - пользователь этого сервиса, от имени которого выполняется
+	// запрос; 0 - субъект не связан с пользователем (сервис, API-ключ)
+	UserID int64
+}
+
+// String возвращает субъект в виде вид:ID для журналов и аудита
+func (p *Principal) String() string {
+	return p.Kind + ":" + p.ID
+}
+
+// HasScope сообщает, выдано ли субъекту разрешение scope
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// CanOwn сообщает, разрешена ли операция perm над записью пользователя
+// ownerID: по общему разрешению или по perm:self, если это запись самого субъекта
+func (p *Principal) CanOwn(perm string, ownerID int64) bool {
+	if p.HasScope(perm) {
+		return true
+	}
+	return p.UserID != 0 && p.UserID == ownerID && p.HasScope(perm+SelfSuffix)
+}
+
+type principalKey struct{}
+
+// WithPrincipal возвращает контекст с субъектом запроса. Субъект попадает
+// и в журнал аудита изменений, который ведет хранилище
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	ctx = audit.WithActor(ctx, p.String())
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext возвращает субъект запроса или nil для анонимного запроса
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/casanera/DlugoshSolutions/internal/logging"
+	"github.com/casanera/DlugoshSolutions/internal/middleware"
+	"github.com/casanera/DlugoshSolutions/internal/problem"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+// LoadRoles заменяет разрешения субъекта, связанного с пользователем, на
+// разрешения его ролей. Если субъект пришел со своим списком разрешений
+// (scope токена), он только сужает права ролей и не может их расширить.
+// Субъекты без пользователя (API-ключи, сервисы) сохраняют свои разрешения
+func LoadRoles(roles storage.RoleStorage, logger *slog.Logger) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := PrincipalFromContext(r.Context())
+			if p == nil || p.UserID == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			perms, err := roles.UserPermissions(r.Context(), p.UserID)
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					logger.LogAttrs(r.Context(), slog.LevelError, "ошибка загрузки ролей пользователя",
+						slog.String("principal", p.String()), slog.Int64("user_id", p.UserID), logging.Err(err))
+					problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Не удалось проверить права доступа")
+				}
+				return
+			}
+
+			resolved := *p
+			resolved.Scopes = perms
+			if len(p.Scopes) > 0 {
+				resolved.Scopes = narrow(perms, p.Scopes)
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), &resolved)))
+		})
+	}
+}
+
+// narrow оставляет из perms только то, что покрывает scopes. Разрешение
+// users:write в scopes покрывает и users:write:self
+func narrow(perms, scopes []string) []string {
+	granted := &Principal{Scopes: scopes}
+	kept := []string{}
+	for _, perm := range perms {
+		if granted.HasScope(perm) || granted.HasScope(strings.TrimSuffix(perm, SelfSuffix)) {
+			kept = append(kept, perm)
+		}
+	}
+	return kept
+}
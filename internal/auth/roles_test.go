@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+func TestLoadRoles(t *testing.T) {
+	roles := storage.NewMockRoleStorage()
+	if err := roles.GrantRole(context.Background(), 7, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := roles.GrantRole(context.Background(), 8, "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got *Principal
+	h := LoadRoles(roles, discardLogger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = PrincipalFromContext(r.Context())
+	}))
+
+	testCases := []struct {
+		name      string
+		principal *Principal
+		want      []string
+	}{
+		{"Роли пользователя", &Principal{Kind: KindToken, ID: "7", UserID: 7},
+			[]string{PermUsersDelete, PermUsersRead, PermUsersWrite}},
+		{"Scope токена сужает права", &Principal{Kind: KindToken, ID: "7", UserID: 7, Scopes: []string{PermUsersRead}},
+			[]string{PermUsersRead}},
+		{"Scope не расширяет права", &Principal{Kind: KindToken, ID: "8", UserID: 8, Scopes: []string{PermUsersWrite, PermUsersDelete}},
+			[]string{PermUsersWrite + SelfSuffix}},
+		{"Без ролей", &Principal{Kind: KindToken, ID: "9", UserID: 9}, []string{}},
+		{"API-ключ сохраняет свои разрешения", &Principal{Kind: KindAPIKey, ID: "1", Scopes: []string{PermUsersRead}},
+			[]string{PermUsersRead}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got = nil
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+			req = req.WithContext(WithPrincipal(req.Context(), tc.principal))
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			if got == nil || !slices.Equal(got.Scopes, tc.want) {
+				t.Errorf("Разрешения %v, ожидались %v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("Ошибка хранилища", func(t *testing.T) {
+		roles.ReturnError = errors.New("connection refused")
+		defer func() { roles.ReturnError = nil }()
+		got = nil
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+		req = req.WithContext(WithPrincipal(req.Context(), &Principal{Kind: KindToken, ID: "7", UserID: 7}))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusInternalServerError || got != nil {
+			t.Errorf("Ожидался 500 без вызова обработчика, получено %d", rr.Code)
+		}
+	})
+}
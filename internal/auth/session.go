@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/casanera/DlugoshSolutions/internal/logging"
+	"github.com/casanera/DlugoshSolutions/internal/middleware"
+	"github.com/casanera/DlugoshSolutions/internal/models"
+	"github.com/casanera/DlugoshSolutions/internal/problem"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+// Cookie и заголовок сессии. Cookie сессии недоступна JavaScript (HttpOnly);
+// CSRF-токен, наоборот, читается фронтендом из cookie и возвращается
+// в заголовке - сторонний сайт прочитать его не может
+const (
+	SessionCookie = "session"
+	CSRFCookie    = "csrf_token"
+	CSRFHeader    = "X-CSRF-Token"
+)
+
+// touchResolution - как часто обновляется last_seen_at сессии
+const touchResolution = time.Minute
+
+// ErrSessionExpired - сессия истекла по бездействию или абсолютному сроку
+var ErrSessionExpired = errors.New("сессия истекла")
+
+// SessionManager создает, проверяет и завершает серверные сессии
+type SessionManager struct {
+	Store           storage.SessionStorage
+	IdleTimeout     time.Duration // сессия без активности дольше этого срока истекает
+	AbsoluteTimeout time.Duration // предельный срок жизни сессии независимо от активности
+	Secure          bool          // передавать cookie только по HTTPS
+
+	now func() time.Time
+}
+
+func NewSessionManager(store storage.SessionStorage) *SessionManager {
+	return &SessionManager{Store: store, IdleTimeout: 30 * time.Minute, AbsoluteTimeout: 12 * time.Hour, Secure: true}
+}
+
+func (m *SessionManager) clock() time.Time {
+	if m.now != nil {
+		return m.now()
+	}
+	return time.Now()
+}
+
+// Start создает сессию пользователя и устанавливает cookie сессии и CSRF-токена
+func (m *SessionManager) Start(ctx context.Context, w http.ResponseWriter, userID int64) (*models.Session, error) {
+	id, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	csrf, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	session := &models.Session{UserID: userID, CSRFToken: csrf, ExpiresAt: m.clock().Add(m.AbsoluteTimeout)}
+	if err := m.Store.CreateSession(ctx, hashToken(id), session); err != nil {
+		return nil, err
+	}
+	m.setCookies(w, id, csrf, session.ExpiresAt)
+	return session, nil
+}
+
+// End завершает сессию из cookie запроса, если она есть, и удаляет cookie
+func (m *SessionManager) End(w http.ResponseWriter, r *http.Request) error {
+	m.clearCookies(w)
+	if hash := SessionHash(r); hash != "" {
+		return m.Store.DeleteSession(r.Context(), hash)
+	}
+	return nil
+}
+
+// Resolve находит действующую сессию по cookie запроса. Истекшая сессия
+// удаляется, возвращается ErrSessionExpired
+func (m *SessionManager) Resolve(r *http.Request) (*models.Session, error) {
+	hash := SessionHash(r)
+	if hash == "" {
+		return nil, fmt.Errorf("auth: %w", storage.ErrSessionNotFound)
+	}
+	session, err := m.Store.GetSession(r.Context(), hash)
+	if err != nil {
+		return nil, err
+	}
+	now := m.clock()
+	if !now.Before(session.ExpiresAt) || !now.Before(session.LastSeenAt.Add(m.IdleTimeout)) {
+		if err := m.Store.DeleteSession(r.Context(), hash); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("auth: %w", ErrSessionExpired)
+	}
+	if now.Sub(session.LastSeenAt) >= touchResolution {
+		if err := m.Store.TouchSession(r.Context(), hash); err != nil {
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+// SessionHash возвращает хеш идентификатора сессии из cookie или пустую
+// строку, если cookie нет. Хеш служит ключом сессии в хранилище
+func SessionHash(r *http.Request) string {
+	c, err := r.Cookie(SessionCookie)
+	if err != nil || c.Value == "" {
+		return ""
+	}
+	return hashToken(c.Value)
+}
+
+func (m *SessionManager) setCookies(w http.ResponseWriter, id, csrf string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{Name: SessionCookie, Value: id, Path: "/", Expires: expires,
+		HttpOnly: true, Secure: m.Secure, SameSite: http.SameSiteLaxMode})
+	http.SetCookie(w, &http.Cookie{Name: CSRFCookie, Value: csrf, Path: "/", Expires: expires,
+		Secure: m.Secure, SameSite: http.SameSiteStrictMode})
+}
+
+func (m *SessionManager) clearCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: SessionCookie, Path: "/", MaxAge: -1,
+		HttpOnly: true, Secure: m.Secure, SameSite: http.SameSiteLaxMode})
+	http.SetCookie(w, &http.Cookie{Name: CSRFCookie, Path: "/", MaxAge: -1,
+		Secure: m.Secure, SameSite: http.SameSiteStrictMode})
+}
+
+// RequireSession пропускает только запросы с действующей сессией и кладет
+// в контекст Principal пользователя (права определит LoadRoles).
+// Изменяющие запросы дополнительно должны передать CSRF-токен сессии
+// в заголовке X-CSRF-Token
+func RequireSession(m *SessionManager, logger *slog.Logger) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session, err := m.Resolve(r)
+			if err != nil {
+				attrs := []slog.Attr{slog.String("method", r.Method), slog.String("path", r.URL.Path), logging.Err(err)}
+				switch {
+				case errors.Is(err, context.Canceled):
+				case errors.Is(err, storage.ErrSessionNotFound), errors.Is(err, ErrSessionExpired):
+					logger.LogAttrs(r.Context(), slog.LevelInfo, "запрос с недействительной сессией", attrs...)
+					m.clearCookies(w)
+					unauthorized(w, r, "Сессия истекла или завершена, войдите снова", "")
+				default:
+					logger.LogAttrs(r.Context(), slog.LevelError, "ошибка проверки сессии", attrs...)
+					problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Не удалось проверить сессию")
+				}
+				return
+			}
+			if !safeMethod(r.Method) &&
+				subtle.ConstantTimeCompare([]byte(r.Header.Get(CSRFHeader)), []byte(session.CSRFToken)) != 1 {
+				logger.LogAttrs(r.Context(), slog.LevelWarn, "запрос без действительного CSRF-токена",
+					slog.String("method", r.Method), slog.String("path", r.URL.Path), slog.Int64("user_id", session.UserID))
+				problem.Error(w, r, http.StatusForbidden, problem.CodeCSRF, "Не передан или неверен CSRF-токен (заголовок "+CSRFHeader+")")
+				return
+			}
+
+			p := &Principal{Kind: KindSession, ID: strconv.FormatInt(session.UserID, 10), UserID: session.UserID}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// safeMethod - методы, которые не меняют состояние и не требуют CSRF-токена
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// randomToken возвращает 256 случайных бит в base64url
+func randomToken() (string, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("auth: генерация токена: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b[:]), nil
+}
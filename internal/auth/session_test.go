@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+func TestPasswordHashing(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyPassword(hash, "correct horse"); !ok || err != nil {
+		t.Errorf("Верный пароль не принят: %v", err)
+	}
+	if ok, _ := VerifyPassword(hash, "correct horse!"); ok {
+		t.Error("Принят неверный пароль")
+	}
+	if NeedsRehash(hash) {
+		t.Error("Хеш с текущими параметрами помечен для замены")
+	}
+
+	// Хеши bcrypt принимаются, но заменяются на argon2id
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if ok, err := VerifyPassword(string(legacy), "correct horse"); !ok || err != nil {
+		t.Errorf("Хеш bcrypt не принят: %v", err)
+	}
+	if !NeedsRehash(string(legacy)) {
+		t.Error("Хеш bcrypt не помечен для замены")
+	}
+	if _, err := VerifyPassword("plain-text", "plain-text"); err == nil {
+		t.Error("Пароль в открытом виде принят как хеш")
+	}
+	if err := ValidatePassword("short"); err == nil {
+		t.Error("Принят слишком короткий пароль")
+	}
+}
+
+func TestRequireSession(t *testing.T) {
+	now := time.Now()
+	store := storage.NewMockSessionStorage()
+	m := NewSessionManager(store)
+	m.now = func() time.Time { return now }
+
+	rr := httptest.NewRecorder()
+	session, err := m.Start(context.Background(), rr, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := rr.Result().Cookies()
+
+	var got *Principal
+	h := RequireSession(m, discardLogger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = PrincipalFromContext(r.Context())
+	}))
+
+	testCases := []struct {
+		name           string
+		method         string
+		withCookies    bool
+		csrf           string
+		elapsed        time.Duration // сколько времени прошло после входа
+		expectedStatus int
+	}{
+		{"Чтение с сессией", http.MethodGet, true, "", 0, http.StatusOK},
+		{"Изменение с CSRF-токеном", http.MethodDelete, true, session.CSRFToken, 0, http.StatusOK},
+		{"Изменение без CSRF-токена", http.MethodDelete, true, "", 0, http.StatusForbidden},
+		{"Изменение с чужим CSRF-токеном", http.MethodPost, true, "forged", 0, http.StatusForbidden},
+		{"Без cookie", http.MethodGet, false, "", 0, http.StatusUnauthorized},
+		{"Истекла по бездействию", http.MethodGet, true, "", m.IdleTimeout + time.Second, http.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got = nil
+			m.now = func() time.Time { return now.Add(tc.elapsed) }
+			req := httptest.NewRequest(tc.method, "/api/v1/users/7", nil)
+			if tc.withCookies {
+				for _, c := range cookies {
+					req.AddCookie(c)
+				}
+			}
+			if tc.csrf != "" {
+				req.Header.Set(CSRFHeader, tc.csrf)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Статус %d, ожидался %d. Тело: %s", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			if tc.expectedStatus == http.StatusOK && (got == nil || got.Kind != KindSession || got.UserID != 7) {
+				t.Errorf("Неожиданный субъект: %+v", got)
+			}
+		})
+	}
+	if len(store.Sessions) != 0 {
+		t.Error("Истекшая сессия не удалена из хранилища")
+	}
+}
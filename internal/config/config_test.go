@@ -0,0 +1,156 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envMap - подмена os.Getenv для тестов
+func envMap(m map[string]string) func(string) string {
+	return func(k string) string { return m[k] }
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	content := `
+http:
+  port: 7000
+  write_timeout: 45s
+database:
+  host: file-host
+  user: file-user
+  password: file-password
+  name: file-db
+`
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	env := envMap(map[string]string{
+		"CONFIG_FILE": file,
+		"DB_HOST":     "env-host",
+		"APP_PORT":    "7500",
+	})
+	cfg, err := Load([]string{"-app-port", "9000", "migrate", "status"}, env)
+	if err != nil {
+		t.Fatalf("Неожиданная ошибка: %v", err)
+	}
+
+	if cfg.HTTP.Port != 9000 {
+		t.Errorf("Флаг должен перекрывать окружение и файл: port=%d", cfg.HTTP.Port)
+	}
+	if cfg.Database.Host != "env-host" {
+		t.Errorf("Окружение должно перекрывать файл: host=%q", cfg.Database.Host)
+	}
+	if cfg.Database.User != "file-user" || cfg.HTTP.WriteTimeout != 45*time.Second {
+		t.Errorf("Значения из файла не применены: user=%q write_timeout=%v", cfg.Database.User, cfg.HTTP.WriteTimeout)
+	}
+	if cfg.HTTP.ReadTimeout != Default().HTTP.ReadTimeout {
+		t.Errorf("Не заданное нигде значение должно остаться по умолчанию: %v", cfg.HTTP.ReadTimeout)
+	}
+	if strings.Join(cfg.Args, " ") != "migrate status" {
+		t.Errorf("Позиционные аргументы: %q", cfg.Args)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		env     map[string]string
+		args    []string
+		wantErr []string // Фрагменты, которые должны быть в тексте ошибки
+	}{
+		{
+			name:    "Нет параметров БД",
+			env:     map[string]string{},
+			wantErr: []string{"DB_HOST", "DB_PASSWORD"},
+		},
+		{
+			name:    "Несколько ошибок сразу",
+			env:     map[string]string{"DATABASE_URL": "mysql://h/db", "APP_PORT": "70000"},
+			wantErr: []string{"DATABASE_URL", "APP_PORT"},
+		},
+		{
+			name:    "Некорректная длительность",
+			env:     map[string]string{"DATABASE_URL": "postgres://u:p@h/db", "SHUTDOWN_TIMEOUT": "soon"},
+			wantErr: []string{"SHUTDOWN_TIMEOUT"},
+		},
+		{
+			name:    "Неизвестный sslmode",
+			env:     map[string]string{"DB_HOST": "h", "DB_USER": "u", "DB_PASSWORD": "p", "DB_NAME": "n", "DB_SSLMODE": "sometimes"},
+			wantErr: []string{"DB_SSLMODE"},
+		},
+		{
+			name:    "Неизвестные уровень и формат журнала",
+			env:     map[string]string{"DATABASE_URL": "postgres://u:p@h/db", "LOG_LEVEL": "verbose"},
+			args:    []string{"-log-format", "xml"},
+			wantErr: []string{"LOG_LEVEL", "LOG_FORMAT"},
+		},
+		{
+			name:    "Короткий секрет JWT",
+			env:     map[string]string{"DATABASE_URL": "postgres://u:p@h/db", "JWT_SECRET": "short", "JWT_LEEWAY": "-1s"},
+			wantErr: []string{"JWT_SECRET", "JWT_LEEWAY"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Load(tc.args, envMap(tc.env))
+			if err == nil {
+				t.Fatal("Ожидалась ошибка валидации")
+			}
+			for _, want := range tc.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Ошибка не упоминает %s: %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDSNAndRedaction(t *testing.T) {
+	cfg, err := Load(nil, envMap(map[string]string{
+		"DB_HOST":     "db",
+		"DB_USER":     "admin",
+		"DB_PASSWORD": "p@ss w/rd&x",
+		"DB_NAME":     "users",
+	}))
+	if err != nil {
+		t.Fatalf("Неожиданная ошибка: %v", err)
+	}
+
+	want := "postgres://admin:p%40ss%20w%2Frd&x@db:5432/users?sslmode=disable"
+	if dsn := cfg.Database.DSN(); dsn != want {
+		t.Errorf("DSN: получено %q, ожидалось %q", dsn, want)
+	}
+	if out := cfg.Redacted(); strings.Contains(out, "p@ss") || !strings.Contains(out, redacted) {
+		t.Errorf("Пароль не замаскирован:\n%s", out)
+	}
+
+	for _, dsn := range []string{
+		"postgres://admin:topsecret@db/users",
+		"postgres://admin@db/users?sslmode=require&password=topsecret",
+		"postgresql://db/users?PASSWORD=topsecret",
+		"host=db user=admin password=topsecret dbname=users",
+		"host=db password='top secret\\' x' dbname=users",
+	} {
+		cfg.Database.URL = dsn
+		if out := cfg.Redacted(); strings.Contains(out, "topsecret") || strings.Contains(out, "secret\\") || !strings.Contains(out, redacted) {
+			t.Errorf("Пароль в DATABASE_URL %q не замаскирован:\n%s", dsn, out)
+		}
+	}
+	cfg.Database.URL = ""
+
+	cfg.Database.Host, cfg.Database.Port = "::1", 6432
+	if dsn := cfg.Database.DSN(); !strings.Contains(dsn, "@[::1]:6432/") {
+		t.Errorf("DSN с IPv6-адресом: %q", dsn)
+	}
+
+	cfg.Auth.JWTSecret = "0123456789abcdef0123456789abcdef-secret"
+	if out := cfg.Redacted(); strings.Contains(out, "-secret") {
+		t.Errorf("Секрет JWT не замаскирован:\n%s", out)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/casanera/DlugoshSolutions/internal/audit"
+	"github.com/casanera/DlugoshSolutions/internal/auth"
+	"github.com/casanera/DlugoshSolutions/internal/problem"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+// AuditHandler отдает журнал аудита: историю изменений пользователя и
+// общий список событий с фильтрами
+type AuditHandler struct {
+	*UserHandler
+	Events storage.AuditStorage
+}
+
+func NewAuditHandler(users *UserHandler, events storage.AuditStorage) *AuditHandler {
+	return &AuditHandler{UserHandler: users, Events: events}
+}
+
+// HistoryRoute - обработчик GET /api/v1/users/{id}/history с проверкой прав
+func (h *AuditHandler) HistoryRoute() http.HandlerFunc {
+	return h.authorize(access{action: "audit.history", perm: auth.PermAuditRead}, h.HistoryHandler)
+}
+
+// ListRoute - обработчик GET /api/v1/audit с проверкой прав
+func (h *AuditHandler) ListRoute() http.HandlerFunc {
+	return h.authorize(access{action: "audit.list", perm: auth.PermAuditRead}, h.ListHandler)
+}
+
+// HistoryHandler отдает изменения пользователя от новых к старым. История
+// удаленного пользователя тоже доступна, поэтому наличие записи не проверяется
+func (h *AuditHandler) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.pathID(w, r)
+	if !ok {
+		return
+	}
+	filter, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidQuery, err.Error())
+		return
+	}
+	filter.Resource = storage.UserResource(id)
+	h.list(w, r, filter)
+}
+
+// ListHandler отдает события аудита по фильтрам actor, action, resource,
+// outcome, request_id и интервалу since/until (RFC 3339)
+func (h *AuditHandler) ListHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidQuery, err.Error())
+		return
+	}
+	h.list(w, r, filter)
+}
+
+func (h *AuditHandler) list(w http.ResponseWriter, r *http.Request, filter storage.AuditFilter) {
+	page, err := h.Events.ListAuditEvents(r.Context(), filter)
+	if err != nil {
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при чтении журнала аудита")
+		return
+	}
+	if page.HasNext && len(page.Events) > 0 {
+		q := r.URL.Query()
+		q.Set("limit", strconv.Itoa(filter.Limit))
+		q.Set("cursor", encodeCursor(cursorBefore, page.Events[len(page.Events)-1].ID))
+		u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=%q", u.String(), "next"))
+	}
+	if page.Events == nil {
+		page.Events = []audit.Event{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page.Events)
+}
+
+// parseAuditFilter разбирает фильтры и пагинацию журнала аудита. Курсор
+// указывает на последнее событие предыдущей страницы
+func parseAuditFilter(q url.Values) (storage.AuditFilter, error) {
+	f := storage.AuditFilter{
+		Actor:     strings.TrimSpace(q.Get("actor")),
+		Action:    strings.TrimSpace(q.Get("action")),
+		Resource:  strings.TrimSpace(q.Get("resource")),
+		Outcome:   q.Get("outcome"),
+		RequestID: strings.TrimSpace(q.Get("request_id")),
+	}
+	if f.Outcome != "" && f.Outcome != audit.OutcomeSuccess && f.Outcome != audit.OutcomeDenied {
+		return f, fmt.Errorf("параметр outcome: ожидается %s или %s", audit.OutcomeSuccess, audit.OutcomeDenied)
+	}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, fmt.Errorf("параметр %s: ожидается время в формате RFC 3339, например 2024-05-01T00:00:00Z", p.name)
+			}
+			*p.t = t
+		}
+	}
+	limit, err := positiveParam(q, "limit", DefaultPageSize)
+	if err != nil {
+		return f, err
+	}
+	f.Limit = min(limit, MaxPageSize)
+	if cursor := q.Get("cursor"); cursor != "" {
+		direction, id, err := decodeCursor(cursor)
+		if err != nil || direction != cursorBefore {
+			return f, fmt.Errorf("параметр cursor: некорректный курсор журнала аудита")
+		}
+		f.Before = id
+	}
+	return f, nil
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/casanera/DlugoshSolutions/internal/audit"
+	"github.com/casanera/DlugoshSolutions/internal/auth"
+	"github.com/casanera/DlugoshSolutions/internal/models"
+	"github.com/casanera/DlugoshSolutions/internal/reqctx"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+func TestAuditHistory(t *testing.T) {
+	mockStorage := storage.NewMockUserStorage()
+	mockStorage.Audit = storage.NewMockAuditStorage()
+	userHandler := NewUserHandler(mockStorage)
+	userHandler.Audit = mockStorage.Audit
+	h := NewAuditHandler(userHandler, mockStorage.Audit)
+
+	// Изменения проходят через обработчики пользователей, как в main
+	for i, step := range []struct{ method, url, body string }{
+		{http.MethodPost, "/api/v1/users", `{"name":"Alice","email":"alice@example.com"}`},
+		{http.MethodPost, "/api/v1/users", `{"name":"Bob","email":"bob@example.com"}`},
+		{http.MethodPut, "/api/v1/users/1", `{"name":"Alice Smith","email":"alice@example.com"}`},
+		{http.MethodDelete, "/api/v1/users/1", ""},
+	} {
+		req := httptest.NewRequest(step.method, step.url, bytes.NewBufferString(step.body))
+		ctx := reqctx.WithRequestID(req.Context(), "req-"+string(rune('a'+i)))
+		req = req.WithContext(auth.WithPrincipal(ctx, admin))
+		rr := httptest.NewRecorder()
+		serve(userHandler, rr, req)
+		if rr.Code >= 300 {
+			t.Fatalf("%s %s: статус %d. Тело: %s", step.method, step.url, rr.Code, rr.Body.String())
+		}
+	}
+
+	auditor := &auth.Principal{Kind: auth.KindAPIKey, ID: "9", Scopes: []string{auth.PermAuditRead}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/users/{id}/history", h.HistoryRoute())
+	mux.HandleFunc("GET /api/v1/audit", h.ListRoute())
+	get := func(p *auth.Principal, url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req = req.WithContext(auth.WithPrincipal(req.Context(), p))
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get(auditor, "/api/v1/users/1/history")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Статус %d. Тело: %s", rr.Code, rr.Body.String())
+	}
+	var events []audit.Event
+	if err := json.NewDecoder(rr.Body).Decode(&events); err != nil {
+		t.Fatal(err)
+	}
+	// История удаленного пользователя доступна, от новых событий к старым
+	if len(events) != 3 || events[0].Action != "users.delete" || events[2].Action != "users.create" {
+		t.Fatalf("Неожиданная история: %+v", events)
+	}
+	var before, after models.User
+	update := events[1]
+	if err := json.Unmarshal(update.Before, &before); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(update.After, &after); err != nil {
+		t.Fatal(err)
+	}
+	if before.Name != "Alice" || after.Name != "Alice Smith" || after.Version != before.Version+1 {
+		t.Errorf("Неверные состояния до и после: %+v -> %+v", before, after)
+	}
+	if update.Actor != admin.String() || update.RequestID != "req-c" {
+		t.Errorf("Не записаны субъект и запрос: %q, %q", update.Actor, update.RequestID)
+	}
+	var deleted models.User
+	if err := json.Unmarshal(events[0].After, &deleted); err != nil || deleted.DeletedAt == nil {
+		t.Errorf("Удаление должно сохранить пометку об удалении: %s (%v)", events[0].After, err)
+	}
+	if events[2].Before != nil {
+		t.Error("У создания не должно быть состояния до")
+	}
+
+	// Общий журнал с фильтром и постраничным выводом
+	rr = get(auditor, "/api/v1/audit?action=users.create&limit=1")
+	if err := json.NewDecoder(rr.Body).Decode(&events); err != nil {
+		t.Fatal(err)
+	}
+	link := rr.Header().Get("Link")
+	if len(events) != 1 || events[0].Resource != "users/2" || !strings.Contains(link, `rel="next"`) {
+		t.Fatalf("Первая страница: %+v, Link %q", events, link)
+	}
+	next := link[strings.Index(link, "<")+1 : strings.Index(link, ">")]
+	rr = get(auditor, next)
+	if err := json.NewDecoder(rr.Body).Decode(&events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Resource != "users/1" || rr.Header().Get("Link") != "" {
+		t.Fatalf("Вторая страница: %+v, Link %q", events, rr.Header().Get("Link"))
+	}
+
+	if rr := get(auditor, "/api/v1/audit?since=yesterday"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Некорректный since: статус %d", rr.Code)
+	}
+	if rr := get(admin, "/api/v1/audit"); rr.Code != http.StatusForbidden {
+		t.Errorf("Без audit:read: статус %d", rr.Code)
+	}
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/casanera/DlugoshSolutions/internal/audit"
+	"github.com/casanera/DlugoshSolutions/internal/auth"
+	"github.com/casanera/DlugoshSolutions/internal/logging"
+	"github.com/casanera/DlugoshSolutions/internal/models"
+	"github.com/casanera/DlugoshSolutions/internal/problem"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+// maxAuthBodySize ограничивает тело запросов входа и смены пароля
+const maxAuthBodySize = 4 << 10
+
+// AuthHandler обслуживает вход по паролю, выход и смену пароля.
+// Журнал, аудит и разбор ошибок хранилища - общие с UserHandler
+type AuthHandler struct {
+	*UserHandler
+	Credentials storage.CredentialStorage
+	Sessions    *auth.SessionManager
+	MaxAttempts int           // неудачных попыток подряд до блокировки входа
+	Lockout     time.Duration // срок блокировки
+}
+
+func NewAuthHandler(users *UserHandler, credentials storage.CredentialStorage, sessions *auth.SessionManager) *AuthHandler {
+	return &AuthHandler{UserHandler: users, Credentials: credentials, Sessions: sessions, MaxAttempts: 5, Lockout: 15 * time.Minute}
+}
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type loginResponse struct {
+	User      *models.User `json:"user"`
+	CSRFToken string       `json:"csrf_token"`
+	ExpiresAt time.Time    `json:"expires_at"`
+}
+
+// LoginHandler проверяет email и пароль и открывает сессию. На неизвестный
+// email и неверный пароль ответ одинаковый, чтобы по нему нельзя было
+// перебирать зарегистрированные адреса
+func (h *AuthHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if !h.decodeBody(w, r, &req) {
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email == "" || req.Password == "" {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeValidation, "Нужно указать email и пароль").
+			WithErrors(problem.FieldError{Field: "email", Message: "обязательное поле"},
+				problem.FieldError{Field: "password", Message: "обязательное поле"}))
+		return
+	}
+
+	creds, err := h.Credentials.GetCredentialsByEmail(r.Context(), req.Email)
+	if errors.Is(err, storage.ErrCredentialsNotFound) {
+		auth.VerifyDummy(req.Password)
+		h.loginFailed(w, r, "", "неизвестный email или пароль не задан")
+		return
+	}
+	if err != nil {
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при входе")
+		return
+	}
+	actor := auth.KindSession + ":" + strconv.FormatInt(creds.UserID, 10)
+	// Попытка учитывается до проверки пароля: иначе параллельные запросы,
+	// прочитавшие запись до блокировки, проверили бы каждый свой пароль
+	attempt, err := h.Credentials.ReserveLoginAttempt(r.Context(), creds.UserID, h.MaxAttempts, h.Lockout)
+	if err != nil {
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при входе", slog.Int64("user_id", creds.UserID))
+		return
+	}
+	if !attempt.Allowed {
+		h.accountLocked(w, r, actor, *attempt.LockedUntil)
+		return
+	}
+
+	ok, err := auth.VerifyPassword(creds.PasswordHash, req.Password)
+	if err != nil {
+		h.log(r, slog.LevelError, "ошибка проверки пароля", slog.Int64("user_id", creds.UserID), logging.Err(err))
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Внутренняя ошибка сервера при входе")
+		return
+	}
+	if !ok {
+		if attempt.LockedUntil != nil {
+			h.log(r, slog.LevelWarn, "вход заблокирован после неудачных попыток",
+				slog.Int64("user_id", creds.UserID), slog.Time("locked_until", *attempt.LockedUntil))
+			h.accountLocked(w, r, actor, *attempt.LockedUntil)
+			return
+		}
+		h.loginFailed(w, r, actor, "неверный пароль")
+		return
+	}
+
+	if err := h.Credentials.RecordLoginSuccess(r.Context(), creds.UserID, attempt); err != nil {
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при входе", slog.Int64("user_id", creds.UserID))
+		return
+	}
+	// Хеш старого формата (bcrypt из импорта или прежние параметры argon2id)
+	// заменяется, пока пароль известен. Ошибка не мешает входу
+	if auth.NeedsRehash(creds.PasswordHash) {
+		if hash, err := auth.HashPassword(req.Password); err != nil {
+			h.log(r, slog.LevelWarn, "не удалось обновить хеш пароля", slog.Int64("user_id", creds.UserID), logging.Err(err))
+		} else if err := h.Credentials.SetPassword(r.Context(), creds.UserID, hash); err != nil {
+			h.log(r, slog.LevelWarn, "не удалось обновить хеш пароля", slog.Int64("user_id", creds.UserID), logging.Err(err))
+		}
+	}
+	user, err := h.Storage.GetUserByID(r.Context(), creds.UserID)
+	if err != nil {
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при входе", slog.Int64("user_id", creds.UserID))
+		return
+	}
+	// Истекшие сессии удаляются попутно: отдельная фоновая задача для этого не нужна
+	if n, err := h.Sessions.Store.DeleteExpiredSessions(r.Context(), h.Sessions.IdleTimeout); err != nil {
+		h.log(r, slog.LevelWarn, "не удалось удалить истекшие сессии", logging.Err(err))
+	} else if n > 0 {
+		h.log(r, slog.LevelDebug, "удалены истекшие сессии", slog.Int64("count", n))
+	}
+	session, err := h.Sessions.Start(r.Context(), w, user.ID)
+	if err != nil {
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при создании сессии", slog.Int64("user_id", user.ID))
+		return
+	}
+
+	h.record(r, audit.Event{Actor: actor, Action: "auth.login", Resource: "users/" + strconv.FormatInt(user.ID, 10), Outcome: audit.OutcomeSuccess})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(loginResponse{User: user, CSRFToken: session.CSRFToken, ExpiresAt: session.ExpiresAt})
+}
+
+// loginFailed отвечает 401 на неудачный вход и записывает его в аудит
+func (h *AuthHandler) loginFailed(w http.ResponseWriter, r *http.Request, actor, reason string) {
+	h.log(r, slog.LevelInfo, "неудачная попытка входа", slog.String("reason", reason))
+	h.record(r, audit.Event{Actor: actor, Action: "auth.login", Resource: "sessions", Outcome: audit.OutcomeDenied, Reason: reason})
+	problem.Error(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "Неверный email или пароль")
+}
+
+// accountLocked отвечает 429 с Retry-After до конца блокировки
+func (h *AuthHandler) accountLocked(w http.ResponseWriter, r *http.Request, actor string, until time.Time) {
+	retry := int(math.Ceil(time.Until(until).Seconds()))
+	h.record(r, audit.Event{Actor: actor, Action: "auth.login", Resource: "sessions", Outcome: audit.OutcomeDenied, Reason: "вход заблокирован"})
+	w.Header().Set("Retry-After", strconv.Itoa(max(retry, 1)))
+	problem.Error(w, r, http.StatusTooManyRequests, problem.CodeAccountLocked,
+		"Слишком много неудачных попыток входа, повторите после "+until.UTC().Format(time.RFC3339))
+}
+
+// LogoutHandler завершает сессию из cookie. Ответ 204 и без сессии: выход
+// должен удаваться всегда
+func (h *AuthHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if err := h.Sessions.End(w, r); err != nil {
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при выходе")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type meResponse struct {
+	Kind        string   `json:"kind"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name,omitempty"`
+	UserID      int64    `json:"user_id,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// MeHandler отдает субъект запроса и его разрешения. По ним фронтенд решает,
+// какие действия показывать
+func (h *AuthHandler) MeHandler(w http.ResponseWriter, r *http.Request) {
+	p := auth.PrincipalFromContext(r.Context())
+	if p == nil {
+		problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Запрос не аутентифицирован")
+		return
+	}
+	perms := p.Scopes
+	if perms == nil {
+		perms = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(meResponse{Kind: p.Kind, ID: p.ID, Name: p.Name, UserID: p.UserID, Permissions: perms})
+}
+
+type passwordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// PasswordHandler задает пароль пользователя. Администратор (users:write)
+// задает его без старого пароля; пользователь, меняющий свой пароль по праву
+// users:write:self, подтверждает его текущим. Остальные сессии пользователя
+// после смены завершаются
+func (h *AuthHandler) PasswordHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.pathID(w, r)
+	if !ok {
+		return
+	}
+	var req passwordRequest
+	if !h.decodeBody(w, r, &req) {
+		return
+	}
+	if err := auth.ValidatePassword(req.NewPassword); err != nil {
+		var validationErr *storage.ValidationError
+		errors.As(err, &validationErr)
+		validationErr.Field = "new_password"
+		writeValidationError(w, r, validationErr)
+		return
+	}
+
+	p := auth.PrincipalFromContext(r.Context())
+	if !p.HasScope(auth.PermUsersWrite) {
+		creds, err := h.Credentials.GetCredentials(r.Context(), id)
+		switch {
+		case errors.Is(err, storage.ErrCredentialsNotFound):
+			// Пароль задается впервые - подтверждать нечего
+		case err != nil:
+			h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при смене пароля", slog.Int64("user_id", id))
+			return
+		default:
+			ok, err := auth.VerifyPassword(creds.PasswordHash, req.CurrentPassword)
+			if err != nil || !ok {
+				h.log(r, slog.LevelInfo, "неверный текущий пароль", slog.Int64("user_id", id), logging.Err(err))
+				h.record(r, audit.Event{Actor: p.String(), Action: "users.password", Resource: "users/" + strconv.FormatInt(id, 10),
+					Outcome: audit.OutcomeDenied, Reason: "неверный текущий пароль"})
+				problem.Write(w, r, problem.New(http.StatusForbidden, problem.CodeInvalidCredentials, "Текущий пароль указан неверно").
+					WithErrors(problem.FieldError{Field: "current_password", Message: "не совпадает с текущим паролем"}))
+				return
+			}
+		}
+	}
+
+	hash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		h.log(r, slog.LevelError, "ошибка хеширования пароля", logging.Err(err))
+		problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "Внутренняя ошибка сервера при смене пароля")
+		return
+	}
+	if err := h.Credentials.SetPassword(r.Context(), id, hash); err != nil {
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при смене пароля", slog.Int64("user_id", id))
+		return
+	}
+	// Текущая сессия остается, если пароль меняет сам пользователь из браузера
+	var keep string
+	if p.Kind == auth.KindSession && p.UserID == id {
+		keep = auth.SessionHash(r)
+	}
+	if err := h.Sessions.Store.DeleteUserSessions(r.Context(), id, keep); err != nil {
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при завершении сессий", slog.Int64("user_id", id))
+		return
+	}
+
+	h.record(r, audit.Event{Actor: p.String(), Action: "users.password", Resource: "users/" + strconv.FormatInt(id, 10), Outcome: audit.OutcomeSuccess})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeBody разбирает JSON-тело ограниченного размера. При ошибке пишет
+// ответ 400 и возвращает false
+func (h *AuthHandler) decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	defer r.Body.Close()
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxAuthBodySize)).Decode(v); err != nil {
+		h.log(r, slog.LevelInfo, "некорректный JSON", logging.Err(err))
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Некорректный JSON: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// record пишет событие в журнал аудита; сбой аудита не отменяет операцию
+func (h *AuthHandler) record(r *http.Request, e audit.Event) {
+	if h.Audit == nil {
+		return
+	}
+	if err := h.Audit.Record(r.Context(), e); err != nil {
+		h.log(r, slog.LevelError, "не удалось записать событие аудита", logging.Err(err))
+	}
+}
+
+// PasswordRoute - обработчик смены пароля с проверкой прав для маршрута
+// PUT /api/v1/users/{id}/password
+func (h *AuthHandler) PasswordRoute() http.HandlerFunc {
+	return h.authorize(access{action: "users.password", perm: auth.PermUsersWrite, self: true}, h.PasswordHandler)
+}
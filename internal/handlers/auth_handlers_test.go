@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/casanera/DlugoshSolutions/internal/audit"
+	"github.com/casanera/DlugoshSolutions/internal/auth"
+	"github.com/casanera/DlugoshSolutions/internal/models"
+	"github.com/casanera/DlugoshSolutions/internal/problem"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+// newTestAuthHandler создает обработчик с пользователями Alice (пароль
+// "correct horse") и Bob (без пароля)
+func newTestAuthHandler(t *testing.T) (*AuthHandler, *storage.MockCredentialStorage, *storage.MockSessionStorage, *auditLog) {
+	t.Helper()
+	users := storage.NewMockUserStorage()
+	users.Users = map[int64]*models.User{
+		1: {ID: 1, Name: "Alice", Email: "alice@example.com", Version: 1},
+		2: {ID: 2, Name: "Bob", Email: "bob@example.com", Version: 1},
+	}
+	credentials := storage.NewMockCredentialStorage(users)
+	hash, err := auth.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := credentials.SetPassword(context.Background(), 1, hash); err != nil {
+		t.Fatal(err)
+	}
+	sessions := storage.NewMockSessionStorage()
+	events := &auditLog{}
+	userHandler := NewUserHandler(users)
+	userHandler.Audit = events
+	h := NewAuthHandler(userHandler, credentials, auth.NewSessionManager(sessions))
+	h.MaxAttempts = 3
+	return h, credentials, sessions, events
+}
+
+func login(h *AuthHandler, email, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(loginRequest{Email: email, Password: password})
+	rr := httptest.NewRecorder()
+	h.LoginHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", bytes.NewReader(body)))
+	return rr
+}
+
+func TestLoginHandler(t *testing.T) {
+	h, _, sessions, events := newTestAuthHandler(t)
+
+	rr := login(h, "alice@example.com", "correct horse")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Ожидался статус 200, получено %d. Тело: %s", rr.Code, rr.Body.String())
+	}
+	var resp loginResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.User == nil || resp.User.ID != 1 || resp.CSRFToken == "" {
+		t.Errorf("Неожиданный ответ: %+v", resp)
+	}
+	cookies := map[string]*http.Cookie{}
+	for _, c := range rr.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+	session := cookies[auth.SessionCookie]
+	if session == nil || !session.HttpOnly || !session.Secure || cookies[auth.CSRFCookie] == nil {
+		t.Fatalf("Cookie сессии установлены неверно: %+v", cookies)
+	}
+	if cookies[auth.CSRFCookie].Value != resp.CSRFToken {
+		t.Error("CSRF-токен в ответе и в cookie различается")
+	}
+	if len(sessions.Sessions) != 1 {
+		t.Errorf("Ожидалась одна сессия, в хранилище %d", len(sessions.Sessions))
+	}
+	if _, ok := sessions.Sessions[session.Value]; ok {
+		t.Error("Идентификатор сессии хранится в открытом виде")
+	}
+	if len(*events) != 1 || (*events)[0].Outcome != audit.OutcomeSuccess {
+		t.Errorf("Вход не записан в аудит: %+v", *events)
+	}
+
+	// Неизвестный email, пользователь без пароля и неверный пароль неразличимы
+	for _, tc := range []struct{ email, password string }{
+		{"nobody@example.com", "correct horse"},
+		{"bob@example.com", "correct horse"},
+		{"alice@example.com", "wrong"},
+	} {
+		rr := login(h, tc.email, tc.password)
+		var p problem.Problem
+		json.NewDecoder(rr.Body).Decode(&p)
+		if rr.Code != http.StatusUnauthorized || p.Code != problem.CodeInvalidCredentials {
+			t.Errorf("%s: статус %d, код %q", tc.email, rr.Code, p.Code)
+		}
+		if len(rr.Result().Cookies()) != 0 {
+			t.Errorf("%s: при неудачном входе установлены cookie", tc.email)
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	h, credentials, _, _ := newTestAuthHandler(t)
+
+	for i := 1; i < h.MaxAttempts; i++ {
+		if rr := login(h, "alice@example.com", "wrong"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Попытка %d: статус %d, ожидался 401", i, rr.Code)
+		}
+	}
+	rr := login(h, "alice@example.com", "wrong")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("Последняя попытка: статус %d, Retry-After %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	// Во время блокировки не принимается и верный пароль
+	if rr := login(h, "alice@example.com", "correct horse"); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Вход во время блокировки: статус %d, ожидался 429", rr.Code)
+	}
+
+	credentials.Credentials[1].LockedUntil = nil
+	if rr := login(h, "alice@example.com", "correct horse"); rr.Code != http.StatusOK {
+		t.Fatalf("Вход после блокировки: статус %d", rr.Code)
+	}
+	if c := credentials.Credentials[1]; c.FailedAttempts != 0 {
+		t.Errorf("Успешный вход не сбросил счетчик: %d", c.FailedAttempts)
+	}
+}
+
+func TestLoginLockoutConcurrent(t *testing.T) {
+	h, _, _, _ := newTestAuthHandler(t)
+	h.Audit = nil // журнал теста не рассчитан на параллельную запись
+
+	// Пароли проверяются медленно, поэтому без учета попытки до проверки
+	// все запросы успели бы прочитать запись до блокировки
+	const guesses = 10
+	codes := make(chan int, guesses+1)
+	var wg sync.WaitGroup
+	for i := 0; i <= guesses; i++ {
+		password := "wrong"
+		if i == guesses {
+			password = "correct horse"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- login(h, "alice@example.com", password).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	// Проверенных паролей - не больше MaxAttempts: 401, 200 и 429 на последней разрешенной
+	if checked := counts[http.StatusUnauthorized] + counts[http.StatusOK]; checked > h.MaxAttempts || counts[http.StatusUnauthorized] >= h.MaxAttempts {
+		t.Errorf("Проверено паролей больше порога %d: %v", h.MaxAttempts, counts)
+	}
+	if counts[http.StatusTooManyRequests] < guesses+1-h.MaxAttempts {
+		t.Errorf("Отклонено меньше попыток, чем ожидалось: %v", counts)
+	}
+}
+
+func TestPasswordHandler(t *testing.T) {
+	self := &auth.Principal{Kind: auth.KindSession, ID: "1", UserID: 1,
+		Scopes: []string{auth.PermUsersRead + auth.SelfSuffix, auth.PermUsersWrite + auth.SelfSuffix}}
+
+	testCases := []struct {
+		name           string
+		principal      *auth.Principal
+		userID         int64
+		body           string
+		expectedStatus int
+		keptSessions   int // сколько сессий пользователя остается после смены
+	}{
+		{"Смена своего пароля", self, 1, `{"current_password":"correct horse","new_password":"battery staple"}`, http.StatusNoContent, 1},
+		{"Неверный текущий пароль", self, 1, `{"current_password":"wrong","new_password":"battery staple"}`, http.StatusForbidden, 2},
+		{"Чужой пароль", self, 2, `{"new_password":"battery staple"}`, http.StatusForbidden, 2},
+		{"Короткий пароль", self, 1, `{"current_password":"correct horse","new_password":"short"}`, http.StatusBadRequest, 2},
+		{"Администратор без текущего пароля", admin, 1, `{"new_password":"battery staple"}`, http.StatusNoContent, 0},
+		{"Администратор задает пароль впервые", admin, 2, `{"new_password":"battery staple"}`, http.StatusNoContent, 2},
+		{"Несуществующий пользователь", admin, 9, `{"new_password":"battery staple"}`, http.StatusNotFound, 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, credentials, sessions, _ := newTestAuthHandler(t)
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/users/"+strconv.FormatInt(tc.userID, 10)+"/password",
+				bytes.NewBufferString(tc.body))
+			req.AddCookie(&http.Cookie{Name: auth.SessionCookie, Value: "current"})
+			req = req.WithContext(auth.WithPrincipal(req.Context(), tc.principal))
+			sessions.Sessions = map[string]*models.Session{
+				auth.SessionHash(req): {UserID: 1},
+				"other":               {UserID: 1},
+			}
+			mux := http.NewServeMux()
+			mux.HandleFunc("PUT /api/v1/users/{id}/password", h.PasswordRoute())
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Ожидался статус %d, получено %d. Тело: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if len(sessions.Sessions) != tc.keptSessions {
+				t.Errorf("Осталось сессий: %d, ожидалось %d", len(sessions.Sessions), tc.keptSessions)
+			}
+			if tc.expectedStatus != http.StatusNoContent {
+				if ok, _ := auth.VerifyPassword(credentials.Credentials[1].PasswordHash, "correct horse"); !ok {
+					t.Error("Отклоненный запрос изменил пароль")
+				}
+				return
+			}
+			if ok, _ := auth.VerifyPassword(credentials.Credentials[tc.userID].PasswordHash, "battery staple"); !ok {
+				t.Error("Новый пароль не принимается")
+			}
+		})
+	}
+}
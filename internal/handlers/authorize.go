@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/casanera/DlugoshSolutions/internal/audit"
+	"github.com/casanera/DlugoshSolutions/internal/auth"
+	"github.com/casanera/DlugoshSolutions/internal/logging"
+	"github.com/casanera/DlugoshSolutions/internal/problem"
+)
+
+// access - правило доступа к операции над пользователями
+type access struct {
+	action string // имя операции в журнале аудита
+	perm   string // необходимое разрешение
+	// self - для записи {id}, принадлежащей самому субъекту, достаточно perm:self
+	self bool
+}
+
+// authorize выполняет next, только если субъекту запроса разрешена операция.
+// Запрос без субъекта отклоняется: до обработчиков доходят только
+// аутентифицированные запросы, и его появление означает ошибку конфигурации
+func (h *UserHandler) authorize(a access, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := auth.PrincipalFromContext(r.Context())
+		var allowed bool
+		switch {
+		case p == nil:
+		case a.self:
+			ownerID, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+			allowed = p.CanOwn(a.perm, ownerID)
+		default:
+			allowed = p.HasScope(a.perm)
+		}
+		if allowed {
+			next(w, r)
+			return
+		}
+		h.deny(w, r, a, p)
+	}
+}
+
+// deny отвечает 403 и записывает отказ в журнал аудита
+func (h *UserHandler) deny(w http.ResponseWriter, r *http.Request, a access, p *auth.Principal) {
+	resource := "users"
+	if id := r.PathValue("id"); id != "" {
+		resource += "/" + id
+	}
+	event := audit.Event{
+		Action:   a.action,
+		Resource: resource,
+		Outcome:  audit.OutcomeDenied,
+		Reason:   "нет разрешения " + a.perm,
+	}
+	if p != nil {
+		event.Actor = p.String()
+	}
+	h.log(r, slog.LevelInfo, "доступ запрещен", slog.String("action", a.action), slog.String("permission", a.perm))
+	if h.Audit != nil {
+		if err := h.Audit.Record(r.Context(), event); err != nil {
+			h.log(r, slog.LevelError, "не удалось записать событие аудита", logging.Err(err))
+		}
+	}
+	problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden,
+		"Недостаточно прав: операция требует разрешения "+a.perm)
+}
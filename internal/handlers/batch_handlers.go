@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/casanera/DlugoshSolutions/internal/auth"
+	"github.com/casanera/DlugoshSolutions/internal/logging"
+	"github.com/casanera/DlugoshSolutions/internal/models"
+	"github.com/casanera/DlugoshSolutions/internal/problem"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+// Ограничения пакета операций
+const (
+	MaxBatchSize     = 10000
+	maxBatchBodySize = 8 << 20
+)
+
+// Режимы выполнения пакета
+const (
+	batchAtomic     = "atomic"      // все операции или ни одной
+	batchBestEffort = "best_effort" // ошибка операции не отменяет остальные
+)
+
+// Операции пакета
+const (
+	batchCreate = "create"
+	batchUpdate = "update"
+	batchDelete = "delete"
+)
+
+// BatchHandler выполняет пакет операций над пользователями в одной транзакции
+type BatchHandler struct {
+	*UserHandler
+	Store storage.Transactor
+}
+
+func NewBatchHandler(users *UserHandler, store storage.Transactor) *BatchHandler {
+	return &BatchHandler{UserHandler: users, Store: store}
+}
+
+type batchOperation struct {
+	Op      string      `json:"op"`      // create, update или delete
+	ID      int64       `json:"id"`      // для update и delete
+	Version int64       `json:"version"` // ожидаемая версия для update и delete; 0 - без проверки
+	User    models.User `json:"user"`    // имя и email для create и update
+}
+
+type batchRequest struct {
+	Mode       string           `json:"mode"` // atomic (по умолчанию) или best_effort
+	Operations []batchOperation `json:"operations"`
+}
+
+// batchResult - итог одной операции; results[i] соответствует operations[i]
+type batchResult struct {
+	Status  int              `json:"status"`
+	ID      int64            `json:"id,omitempty"`
+	Version int64            `json:"version,omitempty"`
+	Error   *problem.Problem `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Mode      string        `json:"mode"`
+	Committed bool          `json:"committed"` // изменения сохранены (в best_effort - успешные)
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []batchResult `json:"results"`
+}
+
+// batchAborted прерывает транзакцию пакета atomic на операции index
+type batchAborted struct{ index int }
+
+func (e *batchAborted) Error() string {
+	return fmt.Sprintf("пакет отменен: ошибка в операции %d", e.index)
+}
+
+// BatchRoute - обработчик POST /api/v1/users:batch с проверкой прав. Пакет
+// требует users:write, а если в нем есть удаления - еще и users:delete
+func (h *BatchHandler) BatchRoute() http.HandlerFunc {
+	return h.authorize(access{action: "users.batch", perm: auth.PermUsersWrite}, h.BatchHandler)
+}
+
+// BatchHandler применяет операции по порядку. Подряд идущие создания
+// вставляются в БД одним многострочным INSERT. В режиме atomic первая ошибка
+// отменяет весь пакет, в best_effort ошибочные операции пропускаются
+func (h *BatchHandler) BatchHandler(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBatchBodySize)).Decode(&req); err != nil {
+		h.log(r, slog.LevelInfo, "некорректный JSON", logging.Err(err))
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Некорректный JSON: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	switch {
+	case req.Mode == "":
+		req.Mode = batchAtomic
+	case req.Mode != batchAtomic && req.Mode != batchBestEffort:
+		writeValidationError(w, r, &storage.ValidationError{Field: "mode", Message: "ожидается atomic или best_effort"})
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > MaxBatchSize {
+		writeValidationError(w, r, &storage.ValidationError{Field: "operations",
+			Message: fmt.Sprintf("ожидается от 1 до %d операций", MaxBatchSize)})
+		return
+	}
+	if p := auth.PrincipalFromContext(r.Context()); !p.HasScope(auth.PermUsersDelete) {
+		for _, op := range req.Operations {
+			if op.Op == batchDelete {
+				h.deny(w, r, access{action: "users.batch", perm: auth.PermUsersDelete}, p)
+				return
+			}
+		}
+	}
+
+	atomic := req.Mode == batchAtomic
+	invalid := make([]*problem.Problem, len(req.Operations))
+	failed := -1
+	for i, op := range req.Operations {
+		if invalid[i] = validateOperation(op); invalid[i] != nil && failed < 0 {
+			failed = i
+		}
+	}
+
+	var results []batchResult
+	var err error
+	if atomic && failed >= 0 {
+		results = make([]batchResult, len(req.Operations))
+		err = &batchAborted{index: failed}
+	} else {
+		err = h.Store.WithTx(r.Context(), storage.TxOptions{}, func(tx storage.Store) error {
+			// При повторе транзакции итоги собираются заново
+			results = make([]batchResult, len(req.Operations))
+			return h.execute(r, tx.Users(), req.Operations, invalid, atomic, results)
+		})
+	}
+
+	resp := batchResponse{Mode: req.Mode, Committed: err == nil, Results: results}
+	status := http.StatusOK
+	var aborted *batchAborted
+	switch {
+	case errors.As(err, &aborted):
+		for i := range results {
+			if p := invalid[i]; p != nil {
+				results[i] = batchResult{Status: p.Status, Error: p}
+			} else if i != aborted.index || results[i].Error == nil {
+				results[i] = batchResult{Status: http.StatusFailedDependency, Error: problem.New(http.StatusFailedDependency,
+					problem.CodeBatchAborted, fmt.Sprintf("Операция не выполнена: пакет отменен из-за ошибки в операции %d", aborted.index))}
+			}
+		}
+		status = results[aborted.index].Status
+	case err != nil:
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при выполнении пакета операций")
+		return
+	}
+	for _, res := range results {
+		if res.Error == nil {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+
+	h.log(r, slog.LevelInfo, "пакет операций выполнен", slog.String("mode", req.Mode), slog.Bool("committed", resp.Committed),
+		slog.Int("succeeded", resp.Succeeded), slog.Int("failed", resp.Failed))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// execute выполняет операции в транзакции и заполняет results. Операции из
+// invalid не выполняются (в режиме atomic их нет)
+func (h *BatchHandler) execute(r *http.Request, users storage.UserStorage, ops []batchOperation, invalid []*problem.Problem, atomic bool, results []batchResult) error {
+	ctx := r.Context()
+	fail := func(i int, err error) error {
+		p, _ := storageProblem(r, err, "Внутренняя ошибка сервера при выполнении операции")
+		if p == nil {
+			return err // клиент отключился
+		}
+		if errors.Is(err, storage.ErrVersionMismatch) {
+			// Версия в пакете - явное предусловие, как If-Match
+			p = problem.New(http.StatusPreconditionFailed, problem.CodePreconditionFailed,
+				"Пользователь был изменен: версия не совпадает с указанной")
+		}
+		results[i] = batchResult{Status: p.Status, Error: p}
+		if atomic {
+			return &batchAborted{index: i}
+		}
+		return nil
+	}
+
+	for i := 0; i < len(ops); i++ {
+		if p := invalid[i]; p != nil {
+			results[i] = batchResult{Status: p.Status, Error: p}
+			continue
+		}
+		op := ops[i]
+		switch op.Op {
+		case batchCreate:
+			// Подряд идущие создания - одним вызовом хранилища
+			var (
+				created []*models.User
+				indexes []int
+			)
+			for ; i < len(ops) && ops[i].Op == batchCreate; i++ {
+				if invalid[i] != nil {
+					results[i] = batchResult{Status: invalid[i].Status, Error: invalid[i]}
+					continue
+				}
+				created = append(created, &models.User{Name: ops[i].User.Name, Email: ops[i].User.Email})
+				indexes = append(indexes, i)
+			}
+			i-- // внешний цикл продолжит со следующей за созданиями операции
+			if err := users.CreateUsers(ctx, created); err != nil {
+				// Ошибка БД, а не отдельной записи: пакет не может продолжаться
+				return err
+			}
+			for k, u := range created {
+				if u.ID == 0 {
+					if err := fail(indexes[k], storage.ErrDuplicateEmail); err != nil {
+						return err
+					}
+					continue
+				}
+				results[indexes[k]] = batchResult{Status: http.StatusCreated, ID: u.ID, Version: u.Version}
+			}
+		case batchUpdate:
+			user := models.User{ID: op.ID, Name: op.User.Name, Email: op.User.Email, Version: op.Version}
+			if err := users.UpdateUser(ctx, &user); err != nil {
+				if err := fail(i, err); err != nil {
+					return err
+				}
+				continue
+			}
+			results[i] = batchResult{Status: http.StatusOK, ID: user.ID, Version: user.Version}
+		case batchDelete:
+			if err := users.DeleteUser(ctx, op.ID, op.Version); err != nil {
+				if err := fail(i, err); err != nil {
+					return err
+				}
+				continue
+			}
+			results[i] = batchResult{Status: http.StatusNoContent, ID: op.ID}
+		}
+	}
+	return nil
+}
+
+// validateOperation проверяет операцию до обращения к хранилищу
+func validateOperation(op batchOperation) *problem.Problem {
+	var err *storage.ValidationError
+	switch op.Op {
+	case batchCreate, batchUpdate:
+		user := op.User
+		errors.As(storage.ValidateUser(&user), &err)
+		if op.Op == batchUpdate && op.ID <= 0 {
+			err = &storage.ValidationError{Field: "id", Message: "обязателен для update"}
+		}
+	case batchDelete:
+		if op.ID <= 0 {
+			err = &storage.ValidationError{Field: "id", Message: "обязателен для delete"}
+		}
+	default:
+		err = &storage.ValidationError{Field: "op", Message: "ожидается create, update или delete"}
+	}
+	if err == nil {
+		return nil
+	}
+	return problem.New(http.StatusBadRequest, problem.CodeValidation, err.Error()).
+		WithErrors(problem.FieldError{Field: err.Field, Message: err.Message})
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/casanera/DlugoshSolutions/internal/auth"
+	"github.com/casanera/DlugoshSolutions/internal/models"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+func TestBatchHandler(t *testing.T) {
+	store := storage.NewMockStore()
+	userHandler := NewUserHandler(store.Users)
+	userHandler.Audit = store.Audit
+	h := NewBatchHandler(userHandler, store)
+	reset := func() {
+		store.Users.Users = map[int64]*models.User{
+			1: {ID: 1, Name: "Alice", Email: "alice@example.com", Version: 1},
+			2: {ID: 2, Name: "Bob", Email: "bob@example.com", Version: 1},
+		}
+		store.Users.NextID = 3
+		store.Audit.Events = nil
+	}
+	do := func(p *auth.Principal, body string) (*httptest.ResponseRecorder, batchResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/users:batch", bytes.NewBufferString(body))
+		req = req.WithContext(auth.WithPrincipal(req.Context(), p))
+		rr := httptest.NewRecorder()
+		h.BatchRoute()(rr, req)
+		var resp batchResponse
+		if rr.Code != http.StatusForbidden && rr.Body.Len() > 0 {
+			json.Unmarshal(rr.Body.Bytes(), &resp)
+		}
+		return rr, resp
+	}
+	statuses := func(resp batchResponse) []int {
+		var s []int
+		for _, r := range resp.Results {
+			s = append(s, r.Status)
+		}
+		return s
+	}
+	ops := `[
+		{"op":"create","user":{"name":"Carol","email":"carol@example.com"}},
+		{"op":"create","user":{"name":"Alice 2","email":"alice@example.com"}},
+		{"op":"update","id":2,"version":1,"user":{"name":"Bobby","email":"bob@example.com"}},
+		{"op":"delete","id":1,"version":5}
+	]`
+
+	t.Run("best_effort выполняет успешные операции", func(t *testing.T) {
+		reset()
+		rr, resp := do(admin, `{"mode":"best_effort","operations":`+ops+`}`)
+		if rr.Code != http.StatusOK || !resp.Committed {
+			t.Fatalf("Статус %d. Тело: %s", rr.Code, rr.Body.String())
+		}
+		want := []int{http.StatusCreated, http.StatusConflict, http.StatusOK, http.StatusPreconditionFailed}
+		if fmt.Sprint(statuses(resp)) != fmt.Sprint(want) || resp.Succeeded != 2 || resp.Failed != 2 {
+			t.Fatalf("Итоги %v (успешно %d, ошибок %d), ожидались %v", statuses(resp), resp.Succeeded, resp.Failed, want)
+		}
+		if resp.Results[0].ID != 3 || store.Users.Users[2].Name != "Bobby" || store.Users.Users[1].DeletedAt != nil {
+			t.Errorf("Неверное состояние после пакета: %+v", resp.Results)
+		}
+		if len(store.Audit.Events) != 2 {
+			t.Errorf("В журнале %d событий, ожидалось 2", len(store.Audit.Events))
+		}
+	})
+
+	t.Run("atomic отменяет пакет при первой ошибке", func(t *testing.T) {
+		reset()
+		rr, resp := do(admin, `{"operations":`+ops+`}`)
+		if rr.Code != http.StatusConflict || resp.Committed {
+			t.Fatalf("Статус %d. Тело: %s", rr.Code, rr.Body.String())
+		}
+		want := []int{http.StatusFailedDependency, http.StatusConflict, http.StatusFailedDependency, http.StatusFailedDependency}
+		if fmt.Sprint(statuses(resp)) != fmt.Sprint(want) {
+			t.Fatalf("Итоги %v, ожидались %v", statuses(resp), want)
+		}
+		if len(store.Users.Users) != 2 || store.Users.Users[2].Name != "Bob" || len(store.Audit.Events) != 0 {
+			t.Error("Отмененный пакет изменил хранилище")
+		}
+	})
+
+	t.Run("atomic без ошибок", func(t *testing.T) {
+		reset()
+		var b strings.Builder
+		b.WriteString(`{"operations":[`)
+		for i := 0; i < 2500; i++ {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, `{"op":"create","user":{"name":"User %d","email":"u%d@example.com"}}`, i, i)
+		}
+		b.WriteString(`,{"op":"delete","id":1}]}`)
+		rr, resp := do(admin, b.String())
+		if rr.Code != http.StatusOK || resp.Succeeded != 2501 || len(store.Users.Users) != 2502 {
+			t.Fatalf("Статус %d, успешно %d, пользователей %d", rr.Code, resp.Succeeded, len(store.Users.Users))
+		}
+	})
+
+	t.Run("Некорректная операция в atomic не доходит до хранилища", func(t *testing.T) {
+		reset()
+		rr, resp := do(admin, `{"operations":[{"op":"create","user":{"name":"Dan","email":"dan@example.com"}},{"op":"rename","id":1}]}`)
+		if rr.Code != http.StatusBadRequest || resp.Results[1].Error.Errors[0].Field != "op" || len(store.Users.Users) != 2 {
+			t.Fatalf("Статус %d. Тело: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Повтор после ошибки сериализации", func(t *testing.T) {
+		reset()
+		store.SerializationFailures, store.Calls = 1, 0
+		rr, _ := do(admin, `{"operations":[{"op":"create","user":{"name":"Eve","email":"eve@example.com"}}]}`)
+		if rr.Code != http.StatusOK || store.Calls != 2 || len(store.Users.Users) != 3 {
+			t.Fatalf("Статус %d, попыток %d, пользователей %d", rr.Code, store.Calls, len(store.Users.Users))
+		}
+	})
+
+	t.Run("Удаление требует users:delete", func(t *testing.T) {
+		reset()
+		writer := &auth.Principal{Kind: auth.KindToken, ID: "w", Scopes: []string{auth.PermUsersWrite}}
+		if rr, _ := do(writer, `{"operations":[{"op":"delete","id":1}]}`); rr.Code != http.StatusForbidden {
+			t.Errorf("Ожидался 403, получено %d", rr.Code)
+		}
+		if rr, _ := do(writer, `{"operations":[{"op":"create","user":{"name":"Fay","email":"fay@example.com"}}]}`); rr.Code != http.StatusOK {
+			t.Errorf("Создание с users:write: статус %d", rr.Code)
+		}
+	})
+}
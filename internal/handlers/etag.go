@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/casanera/DlugoshSolutions/internal/models"
+	"github.com/casanera/DlugoshSolutions/internal/problem"
+)
+
+// userETag - сильный ETag представления пользователя, построенный по версии записи
+func userETag(u *models.User) string {
+	return `"v` + strconv.FormatInt(u.Version, 10) + `"`
+}
+
+// setUserETag выставляет ETag для ответа с пользователем
+func setUserETag(w http.ResponseWriter, u *models.User) {
+	w.Header().Set("ETag", userETag(u))
+}
+
+// parseETags разбирает список сущностей из If-Match/If-None-Match.
+// wildcard = true для "*"
+func parseETags(header string) (tags []string, wildcard bool) {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		switch tag {
+		case "":
+		case "*":
+			wildcard = true
+		default:
+			tags = append(tags, tag)
+		}
+	}
+	return tags, wildcard
+}
+
+// versionFromETag извлекает версию из сильного ETag вида "v<N>"
+func versionFromETag(tag string) (int64, bool) {
+	if !strings.HasPrefix(tag, `"v`) || !strings.HasSuffix(tag, `"`) || len(tag) < 4 {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(tag[2:len(tag)-1], 10, 64)
+	if err != nil || v <= 0 {
+		return 0, false
+	}
+	return v, true
+}
+
+// notModified проверяет If-None-Match (слабое сравнение, RFC 9110 13.1.2)
+func notModified(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	tags, wildcard := parseETags(header)
+	if wildcard {
+		return true
+	}
+	for _, tag := range tags {
+		if strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// hasIfMatch сообщает, что клиент прислал предусловие If-Match
+func hasIfMatch(r *http.Request) bool {
+	return r.Header.Get("If-Match") != ""
+}
+
+// expectedVersion превращает If-Match в ожидаемую версию записи для
+// условного изменения в хранилище. 0 - без проверки версии (заголовка нет или "*").
+// Если в заголовке несколько сущностей, текущая версия читается через current.
+// При невыполнимом предусловии отвечает 412 и возвращает ok = false
+func (h *UserHandler) expectedVersion(w http.ResponseWriter, r *http.Request, current func() (*models.User, error)) (version int64, ok bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return 0, true
+	}
+	tags, wildcard := parseETags(header)
+	if wildcard {
+		return 0, true
+	}
+
+	var versions []int64
+	for _, tag := range tags {
+		// Для If-Match применяется сильное сравнение: слабые ETag не совпадают никогда
+		if v, ok := versionFromETag(tag); ok {
+			versions = append(versions, v)
+		}
+	}
+	switch len(versions) {
+	case 0:
+	case 1:
+		return versions[0], true
+	default:
+		user, err := current()
+		if err != nil {
+			h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при проверке версии пользователя")
+			return 0, false
+		}
+		for _, v := range versions {
+			if v == user.Version {
+				return v, true
+			}
+		}
+	}
+	problem.Error(w, r, http.StatusPreconditionFailed, problem.CodePreconditionFailed,
+		"Пользователь был изменен: версия не совпадает с указанной в If-Match")
+	return 0, false
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/casanera/DlugoshSolutions/internal/auth"
+	"github.com/casanera/DlugoshSolutions/internal/importer"
+	"github.com/casanera/DlugoshSolutions/internal/problem"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+// ImportHandler загружает пользователей из CSV или NDJSON в теле запроса
+type ImportHandler struct {
+	*UserHandler
+	Store storage.Transactor
+	// Timeout заменяет таймауты чтения и записи HTTP-сервера для импорта:
+	// большой файл не успевает загрузиться за обычный ReadTimeout
+	Timeout time.Duration
+}
+
+func NewImportHandler(users *UserHandler, store storage.Transactor) *ImportHandler {
+	return &ImportHandler{UserHandler: users, Store: store, Timeout: 10 * time.Minute}
+}
+
+// ImportRoute - обработчик POST /api/v1/users/import с проверкой прав
+func (h *ImportHandler) ImportRoute() http.HandlerFunc {
+	return h.authorize(access{action: "users.import", perm: auth.PermUsersWrite}, h.ImportHandler)
+}
+
+// ImportHandler читает файл из тела запроса (text/csv, application/x-ndjson)
+// или из поля file формы multipart/form-data. Параметры: format (csv или
+// ndjson; по умолчанию - по типу содержимого), delimiter, name_column,
+// email_column, dry_run. Файл не буферизуется: строки сохраняются по мере чтения
+func (h *ImportHandler) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseImportOptions(r.URL.Query())
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidQuery, err.Error())
+		return
+	}
+	if h.Timeout > 0 {
+		// Не все ResponseWriter поддерживают дедлайны (например, в тестах)
+		rc := http.NewResponseController(w)
+		rc.SetReadDeadline(time.Now().Add(h.Timeout))
+		rc.SetWriteDeadline(time.Now().Add(h.Timeout))
+	}
+
+	body, contentType, err := importBody(r)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidImport, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	if opts.Format == "" {
+		format, ok := formatFromContentType(contentType)
+		if !ok {
+			problem.Error(w, r, http.StatusUnsupportedMediaType, problem.CodeUnsupportedMedia,
+				"Импорт принимает text/csv, application/x-ndjson или multipart/form-data; формат можно указать параметром format")
+			return
+		}
+		opts.Format = format
+	}
+
+	report, err := importer.Run(r.Context(), h.Store, body, opts)
+	switch {
+	case errors.Is(err, importer.ErrFormat):
+		h.log(r, slog.LevelInfo, "некорректный файл импорта", slog.String("format", opts.Format), slog.String("err", err.Error()))
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidImport, err.Error())
+		return
+	case err != nil:
+		attrs := []slog.Attr{slog.Bool("dry_run", opts.DryRun)}
+		if report != nil {
+			// Сохраненные до ошибки порции остаются в БД
+			attrs = append(attrs, slog.Int("rows", report.Rows), slog.Int("created", report.Created))
+		}
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при импорте пользователей", attrs...)
+		return
+	}
+
+	h.log(r, slog.LevelInfo, "импорт пользователей завершен", slog.Bool("dry_run", report.DryRun), slog.Int("rows", report.Rows),
+		slog.Int("created", report.Created), slog.Int("skipped", report.Skipped), slog.Int("invalid", report.Invalid))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// parseImportOptions разбирает параметры импорта из строки запроса
+func parseImportOptions(q url.Values) (importer.Options, error) {
+	opts := importer.Options{
+		Format:      q.Get("format"),
+		NameColumn:  q.Get("name_column"),
+		EmailColumn: q.Get("email_column"),
+	}
+	if v := q.Get("dry_run"); v != "" {
+		dryRun, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("параметр dry_run должен быть true или false")
+		}
+		opts.DryRun = dryRun
+	}
+	delimiter, err := importer.ParseDelimiter(q.Get("delimiter"))
+	if err != nil {
+		return opts, fmt.Errorf("параметр delimiter: %v", err)
+	}
+	opts.Delimiter = delimiter
+	if opts.Format != "" && opts.Format != importer.FormatCSV && opts.Format != importer.FormatNDJSON {
+		return opts, fmt.Errorf("параметр format: ожидается %s или %s", importer.FormatCSV, importer.FormatNDJSON)
+	}
+	return opts, nil
+}
+
+// importBody возвращает поток файла и его тип содержимого. Из формы
+// multipart/form-data берется часть file, остальные части пропускаются
+func importBody(r *http.Request) (io.Reader, string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, mediaType, nil
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", fmt.Errorf("некорректная форма: %v", err)
+	}
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, "", fmt.Errorf("в форме нет поля file")
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("некорректная форма: %v", err)
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if contentType == "" || contentType == "application/octet-stream" {
+			// Браузеры не знают тип .ndjson: определяем по расширению
+			switch path.Ext(part.FileName()) {
+			case ".ndjson", ".jsonl":
+				contentType = "application/x-ndjson"
+			}
+		}
+		return part, contentType, nil
+	}
+}
+
+// formatFromContentType выбирает формат по типу содержимого. Тип без
+// указания формата (пустой, text/plain, application/octet-stream) считается CSV;
+// ok = false для остальных типов, например application/json-seq (RFC 7464):
+// его записи начинаются с символа 0x1E и не разбираются как NDJSON
+func formatFromContentType(contentType string) (format string, ok bool) {
+	switch contentType {
+	case "application/x-ndjson", "application/jsonl", "application/jsonlines":
+		return importer.FormatNDJSON, true
+	case "", "text/csv", "application/csv", "text/plain", "application/octet-stream":
+		return importer.FormatCSV, true
+	}
+	return "", false
+}
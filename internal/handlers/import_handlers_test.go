@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/casanera/DlugoshSolutions/internal/auth"
+	"github.com/casanera/DlugoshSolutions/internal/importer"
+	"github.com/casanera/DlugoshSolutions/internal/models"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+func TestImportHandler(t *testing.T) {
+	store := storage.NewMockStore()
+	h := NewImportHandler(NewUserHandler(store.Users), store)
+	reset := func() {
+		store.Users.Users = map[int64]*models.User{
+			1: {ID: 1, Name: "Alice", Email: "alice@example.com", Version: 1},
+		}
+		store.Users.NextID = 2
+	}
+	do := func(p *auth.Principal, query, contentType string, body *bytes.Buffer) (*httptest.ResponseRecorder, importer.Report) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/users/import"+query, body)
+		req.Header.Set("Content-Type", contentType)
+		req = req.WithContext(auth.WithPrincipal(req.Context(), p))
+		rr := httptest.NewRecorder()
+		h.ImportRoute()(rr, req)
+		var report importer.Report
+		if rr.Code == http.StatusOK {
+			json.Unmarshal(rr.Body.Bytes(), &report)
+		}
+		return rr, report
+	}
+	lines := func(rows []importer.RowError) string {
+		var s []string
+		for _, r := range rows {
+			s = append(s, fmt.Sprintf("%d:%s", r.Line, r.Field))
+		}
+		return strings.Join(s, " ")
+	}
+	// Строка 3 - занятый email, 4 - повтор строки 2, 5 - пустая,
+	// 6 - без имени, 7 - незакрытая кавычка до конца файла
+	csvFile := "Имя;Почта\n" +
+		"Carol;carol@example.com\n" +
+		"Alice;alice@example.com\n" +
+		"Carol 2;carol@example.com\n" +
+		"\n" +
+		";dan@example.com\n" +
+		"\"Eve;eve@example.com\n"
+
+	t.Run("CSV с разделителем и сопоставлением колонок", func(t *testing.T) {
+		reset()
+		rr, report := do(admin, "?delimiter=%3B&name_column=имя&email_column=почта", "text/csv", bytes.NewBufferString(csvFile))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Статус %d. Тело: %s", rr.Code, rr.Body.String())
+		}
+		if report.Rows != 5 || report.Created != 1 || report.Skipped != 2 || report.Invalid != 2 {
+			t.Fatalf("Неверные итоги: %+v", report)
+		}
+		if got := lines(report.SkippedRows); got != "3:email 4:email" {
+			t.Errorf("Пропущенные строки %q", got)
+		}
+		if got := lines(report.InvalidRows); got != "6:name 7:" {
+			t.Errorf("Ошибочные строки %q", got)
+		}
+		if len(store.Users.Users) != 2 || store.Users.Users[2].Email != "carol@example.com" {
+			t.Errorf("Неверное состояние хранилища: %v", store.Users.Users)
+		}
+	})
+
+	t.Run("Пробный импорт ничего не сохраняет", func(t *testing.T) {
+		reset()
+		rr, report := do(admin, "?delimiter=%3B&name_column=Имя&email_column=Почта&dry_run=true", "text/csv", bytes.NewBufferString(csvFile))
+		if rr.Code != http.StatusOK || !report.DryRun || report.Created != 1 || report.Skipped != 2 {
+			t.Fatalf("Статус %d. Тело: %s", rr.Code, rr.Body.String())
+		}
+		if len(store.Users.Users) != 1 {
+			t.Errorf("Пробный импорт создал пользователей: %d", len(store.Users.Users))
+		}
+	})
+
+	t.Run("NDJSON из формы", func(t *testing.T) {
+		reset()
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("comment", "игнорируется")
+		part, _ := mw.CreateFormFile("file", "users.ndjson")
+		fmt.Fprint(part, `{"name":"Frank","email":"frank@example.com"}`+"\n"+
+			`{"name":"Grace"}`+"\n"+
+			`{"name":42,"email":"x@example.com"}`+"\n"+
+			`not json`+"\n")
+		mw.Close()
+		rr, report := do(admin, "", mw.FormDataContentType(), &body)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Статус %d. Тело: %s", rr.Code, rr.Body.String())
+		}
+		if report.Created != 1 || lines(report.InvalidRows) != "2:email 3:name 4:" {
+			t.Fatalf("Неверные итоги: %+v", report)
+		}
+	})
+
+	t.Run("Большой файл сохраняется порциями", func(t *testing.T) {
+		reset()
+		var b bytes.Buffer
+		b.WriteString("name,email\n")
+		for i := 0; i < 1200; i++ {
+			fmt.Fprintf(&b, "User %d,u%d@example.com\n", i, i)
+		}
+		store.Calls = 0
+		rr, report := do(admin, "", "text/csv", &b)
+		if rr.Code != http.StatusOK || report.Created != 1200 || store.Calls != 3 {
+			t.Fatalf("Статус %d, создано %d, транзакций %d", rr.Code, report.Created, store.Calls)
+		}
+	})
+
+	t.Run("Ошибки формата", func(t *testing.T) {
+		reset()
+		for name, tc := range map[string]struct{ query, body string }{
+			"Нет колонки":            {"", "name;email\nA;a@example.com\n"},
+			"Неизвестный формат":     {"?format=xml", "<users/>"},
+			"Некорректный delimiter": {"?delimiter=%3B%3B", "name;email\n"},
+			"Пустой файл":            {"", ""},
+		} {
+			if rr, _ := do(admin, tc.query, "text/csv", bytes.NewBufferString(tc.body)); rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: ожидался 400, получено %d", name, rr.Code)
+			}
+		}
+		if len(store.Users.Users) != 1 {
+			t.Error("Некорректный файл изменил хранилище")
+		}
+	})
+
+	t.Run("Неподдерживаемый тип содержимого", func(t *testing.T) {
+		reset()
+		ndjson := `{"name":"Bob","email":"bob@example.com"}` + "\n"
+		if rr, _ := do(admin, "", "application/json-seq", bytes.NewBufferString("\x1e"+ndjson)); rr.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("application/json-seq: ожидался 415, получено %d", rr.Code)
+		}
+		// Явный format важнее типа содержимого
+		if rr, report := do(admin, "?format=ndjson", "application/x-www-form-urlencoded", bytes.NewBufferString(ndjson)); rr.Code != http.StatusOK || report.Created != 1 {
+			t.Errorf("Статус %d, создано %d", rr.Code, report.Created)
+		}
+	})
+
+	t.Run("Импорт требует users:write", func(t *testing.T) {
+		reset()
+		reader := &auth.Principal{Kind: auth.KindToken, ID: "r", Scopes: []string{auth.PermUsersRead}}
+		if rr, _ := do(reader, "", "text/csv", bytes.NewBufferString("name,email\nA,a@example.com\n")); rr.Code != http.StatusForbidden {
+			t.Errorf("Ожидался 403, получено %d", rr.Code)
+		}
+	})
+}
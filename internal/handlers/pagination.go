@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+// Размеры страницы списка пользователей
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 100 // Больше не отдаем, даже если клиент просит
+)
+
+// Курсор непрозрачен для клиента: направление и id, закодированные в base64
+const (
+	cursorAfter  = "a"
+	cursorBefore = "b"
+)
+
+func encodeCursor(direction string, id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(direction + ":" + strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (direction string, id int64, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, fmt.Errorf("курсор не в формате base64url")
+	}
+	direction, idStr, ok := strings.Cut(string(raw), ":")
+	if !ok || (direction != cursorAfter && direction != cursorBefore) {
+		return "", 0, fmt.Errorf("неизвестный формат курсора")
+	}
+	id, err = strconv.ParseInt(idStr, 10, 64)
+	if err != nil || id <= 0 {
+		return "", 0, fmt.Errorf("некорректный id в курсоре")
+	}
+	return direction, id, nil
+}
+
+// pageRequest - разобранные параметры пагинации запроса
+type pageRequest struct {
+	params  storage.ListParams
+	paged   bool // Используется page/per_page, а не limit/cursor
+	page    int
+	perPage int
+}
+
+// positiveParam читает положительный целочисленный параметр запроса
+func positiveParam(q url.Values, name string, def int) (int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("параметр %s должен быть положительным целым числом", name)
+	}
+	return n, nil
+}
+
+// Параметры фильтрации списка и соответствующие поля storage.UserFilter
+var filterParams = []struct {
+	name  string
+	field func(f *storage.UserFilter) *string
+}{
+	{"email", func(f *storage.UserFilter) *string { return &f.Email }},
+	{"email_prefix", func(f *storage.UserFilter) *string { return &f.EmailPrefix }},
+	{"email_suffix", func(f *storage.UserFilter) *string { return &f.EmailSuffix }},
+	{"name_contains", func(f *storage.UserFilter) *string { return &f.NameContains }},
+}
+
+// parsePageRequest разбирает параметры списка: фильтры, сортировку и
+// пагинацию limit/cursor или page/per_page. Размер страницы ограничивается MaxPageSize.
+// Курсор работает только с порядком по id, поэтому при другой сортировке
+// limit трактуется как per_page первой страницы
+func parsePageRequest(q url.Values) (*pageRequest, error) {
+	var filter storage.UserFilter
+	for _, p := range filterParams {
+		v := strings.TrimSpace(q.Get(p.name))
+		if len(v) > storage.MaxEmailLength {
+			return nil, fmt.Errorf("значение параметра %s слишком длинное", p.name)
+		}
+		*p.field(&filter) = v
+	}
+	sort, err := storage.ParseSort(q.Get("sort"))
+	if err != nil {
+		return nil, fmt.Errorf("параметр sort: %v", err)
+	}
+
+	cursorMode := q.Has("limit") || q.Has("cursor")
+	pageMode := q.Has("page") || q.Has("per_page")
+	if cursorMode && pageMode {
+		return nil, fmt.Errorf("параметры limit/cursor нельзя сочетать с page/per_page")
+	}
+	if q.Get("cursor") != "" && !storage.IsDefaultSort(sort) {
+		return nil, fmt.Errorf("параметр cursor поддерживается только при сортировке по id, используйте page/per_page")
+	}
+
+	if pageMode || !storage.IsDefaultSort(sort) {
+		page, err := positiveParam(q, "page", 1)
+		if err != nil {
+			return nil, err
+		}
+		perPageParam := "per_page"
+		if !pageMode {
+			perPageParam = "limit"
+		}
+		perPage, err := positiveParam(q, perPageParam, DefaultPageSize)
+		if err != nil {
+			return nil, err
+		}
+		perPage = min(perPage, MaxPageSize)
+		if page > math.MaxInt/perPage {
+			// Иначе смещение переполнится и станет отрицательным
+			return nil, fmt.Errorf("параметр page не может превышать %d", math.MaxInt/perPage)
+		}
+		return &pageRequest{
+			params:  storage.ListParams{Limit: perPage, Offset: (page - 1) * perPage, Filter: filter, Sort: sort},
+			paged:   true,
+			page:    page,
+			perPage: perPage,
+		}, nil
+	}
+
+	limit, err := positiveParam(q, "limit", DefaultPageSize)
+	if err != nil {
+		return nil, err
+	}
+	pr := &pageRequest{params: storage.ListParams{Limit: min(limit, MaxPageSize), Filter: filter}}
+	if cursor := q.Get("cursor"); cursor != "" {
+		direction, id, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, fmt.Errorf("параметр cursor: %v", err)
+		}
+		if direction == cursorAfter {
+			pr.params.After = id
+		} else {
+			pr.params.Before = id
+		}
+	}
+	return pr, nil
+}
+
+// setPaginationHeaders выставляет X-Total-Count и Link (RFC 8288) со ссылками
+// на соседние страницы. Остальные параметры запроса сохраняются в ссылках
+func setPaginationHeaders(w http.ResponseWriter, r *http.Request, pr *pageRequest, page *storage.UserPage) {
+	w.Header().Set("X-Total-Count", strconv.FormatInt(page.Total, 10))
+
+	link := func(rel string, set map[string]string) string {
+		q := r.URL.Query()
+		for _, name := range []string{"limit", "cursor", "page", "per_page"} {
+			q.Del(name)
+		}
+		for k, v := range set {
+			q.Set(k, v)
+		}
+		u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+		return fmt.Sprintf("<%s>; rel=%q", u.String(), rel)
+	}
+
+	var links []string
+	if pr.paged {
+		perPage := strconv.Itoa(pr.perPage)
+		lastPage := int((page.Total + int64(pr.perPage) - 1) / int64(pr.perPage))
+		lastPage = max(lastPage, 1)
+		links = append(links, link("first", map[string]string{"page": "1", "per_page": perPage}))
+		if page.HasPrev {
+			links = append(links, link("prev", map[string]string{"page": strconv.Itoa(min(pr.page-1, lastPage)), "per_page": perPage}))
+		}
+		if page.HasNext {
+			links = append(links, link("next", map[string]string{"page": strconv.Itoa(pr.page + 1), "per_page": perPage}))
+		}
+		links = append(links, link("last", map[string]string{"page": strconv.Itoa(lastPage), "per_page": perPage}))
+	} else {
+		limit := strconv.Itoa(pr.params.Limit)
+		if page.HasPrev && len(page.Users) > 0 {
+			links = append(links, link("prev", map[string]string{"limit": limit, "cursor": encodeCursor(cursorBefore, page.Users[0].ID)}))
+		}
+		if page.HasNext && len(page.Users) > 0 {
+			links = append(links, link("next", map[string]string{"limit": limit, "cursor": encodeCursor(cursorAfter, page.Users[len(page.Users)-1].ID)}))
+		}
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
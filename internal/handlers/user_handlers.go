@@ -1,54 +1,177 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/casanera/DlugoshSolutions/internal/audit"
+	"github.com/casanera/DlugoshSolutions/internal/auth"
+	"github.com/casanera/DlugoshSolutions/internal/jsonpatch"
+	"github.com/casanera/DlugoshSolutions/internal/logging"
 	"github.com/casanera/DlugoshSolutions/internal/models"
+	"github.com/casanera/DlugoshSolutions/internal/problem"
+	"github.com/casanera/DlugoshSolutions/internal/router"
 	"github.com/casanera/DlugoshSolutions/internal/storage"
 )
 
 type UserHandler struct {
 	Storage storage.UserStorage
+	Logger  *slog.Logger
+	Audit   audit.Recorder
 }
 
 func NewUserHandler(s storage.UserStorage) *UserHandler {
-	return &UserHandler{Storage: s}
+	return &UserHandler{Storage: s, Logger: slog.Default(), Audit: audit.NewLogRecorder(slog.Default())}
 }
 
-// обрабатывает POST-запросы для создания пользователя
-// жидает JSON в теле запроса
-func (h *UserHandler) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+// Resource описывает маршруты ресурса /api/v1/users для роутера.
+// Каждая операция объявляет разрешение, без которого она не выполняется
+func (h *UserHandler) Resource() router.Resource {
+	return router.Resource{
+		List:   h.authorize(access{action: "users.list", perm: auth.PermUsersRead}, h.ListUsersHandler),
+		Create: h.authorize(access{action: "users.create", perm: auth.PermUsersWrite}, h.CreateUserHandler),
+		Get:    h.authorize(access{action: "users.get", perm: auth.PermUsersRead, self: true}, h.GetUserHandler),
+		Update: h.authorize(access{action: "users.update", perm: auth.PermUsersWrite, self: true}, h.UpdateUserHandler),
+		Patch:  h.authorize(access{action: "users.patch", perm: auth.PermUsersWrite, self: true}, h.PatchUserHandler),
+		Delete: h.authorize(access{action: "users.delete", perm: auth.PermUsersDelete}, h.DeleteUserHandler),
+	}
+}
+
+// log пишет запись с методом, путем запроса и субъектом; request_id добавляет
+// обработчик журнала из контекста
+func (h *UserHandler) log(r *http.Request, level slog.Level, msg string, attrs ...slog.Attr) {
+	logger := h.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	attrs = append([]slog.Attr{slog.String("method", r.Method), slog.String("path", r.URL.Path)}, attrs...)
+	if p := auth.PrincipalFromContext(r.Context()); p != nil {
+		attrs = append(attrs, slog.String("principal", p.String()))
+	}
+	logger.LogAttrs(r.Context(), level, msg, attrs...)
+}
+
+// pathID извлекает ID пользователя из сегмента {id} маршрута.
+// При ошибке пишет ответ 400 и возвращает false
+func (h *UserHandler) pathID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		h.log(r, slog.LevelInfo, "некорректный ID пользователя", slog.String("id", idStr), logging.Err(err))
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidID, "Некорректный ID пользователя")
+		return 0, false
+	}
+	return id, true
+}
+
+// writeValidationError отвечает 400 с указанием поля, не прошедшего проверку
+func writeValidationError(w http.ResponseWriter, r *http.Request, err *storage.ValidationError) {
+	problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeValidation, err.Error()).
+		WithErrors(problem.FieldError{Field: err.Field, Message: err.Message}))
+}
+
+// writeStorageError сопоставляет ошибку хранилища HTTP-статусу, пишет ответ и
+// запись в журнал с кодом ошибки. fallback - сообщение для непредвиденных
+// ошибок (500), attrs - дополнительные атрибуты записи (например, user_id)
+func (h *UserHandler) writeStorageError(w http.ResponseWriter, r *http.Request, err error, fallback string, attrs ...slog.Attr) {
+	p, level := storageProblem(r, err, fallback)
+	if p == nil {
+		// Клиент отключился - отвечать некому, только фиксируем факт
+		h.log(r, slog.LevelInfo, "запрос отменен клиентом", append(attrs, logging.Err(err))...)
 		return
 	}
+	h.log(r, level, "ошибка обработки запроса",
+		append(attrs, slog.Int("status", p.Status), slog.String("code", p.Code), logging.Err(err))...)
+	problem.Write(w, r, p)
+}
+
+// storageProblem описывает ошибку хранилища для клиента и выбирает уровень
+// записи в журнал. Для отмененного клиентом запроса возвращает nil
+func storageProblem(r *http.Request, err error, fallback string) (*problem.Problem, slog.Level) {
+	var validationErr *storage.ValidationError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return nil, slog.LevelInfo
+	case errors.Is(err, context.DeadlineExceeded):
+		return problem.New(http.StatusGatewayTimeout, problem.CodeTimeout, "Превышено время ожидания ответа от базы данных"), slog.LevelWarn
+	case errors.Is(err, storage.ErrNotFound):
+		return problem.New(http.StatusNotFound, problem.CodeNotFound, "Пользователь не найден"), slog.LevelInfo
+	case errors.Is(err, storage.ErrDuplicateEmail):
+		return problem.New(http.StatusConflict, problem.CodeDuplicateEmail, "Пользователь с таким email уже существует").
+			WithErrors(problem.FieldError{Field: "email", Message: "уже используется другим пользователем"}), slog.LevelInfo
+	case errors.Is(err, storage.ErrVersionMismatch):
+		if hasIfMatch(r) {
+			return problem.New(http.StatusPreconditionFailed, problem.CodePreconditionFailed,
+				"Пользователь был изменен: версия не совпадает с указанной в If-Match"), slog.LevelInfo
+		}
+		return problem.New(http.StatusConflict, problem.CodeConflict,
+			"Пользователь был изменен параллельным запросом, повторите операцию"), slog.LevelInfo
+	case errors.Is(err, storage.ErrNotDeleted):
+		return problem.New(http.StatusConflict, problem.CodeConflict, "Пользователь не удален, восстанавливать нечего"), slog.LevelInfo
+	case errors.Is(err, storage.ErrConflict):
+		return problem.New(http.StatusConflict, problem.CodeConflict, "Конфликт при изменении пользователя"), slog.LevelInfo
+	case errors.As(err, &validationErr):
+		return problem.New(http.StatusBadRequest, problem.CodeValidation, validationErr.Error()).
+			WithErrors(problem.FieldError{Field: validationErr.Field, Message: validationErr.Message}), slog.LevelInfo
+	default:
+		return problem.New(http.StatusInternalServerError, problem.CodeInternal, fallback), slog.LevelError
+	}
+}
 
+// includeDeleted разбирает параметр include_deleted. Удаленных пользователей
+// видят только субъекты с правом удаления; остальным отвечает 403, на
+// некорректное значение - 400. При ответе возвращает ok = false
+func (h *UserHandler) includeDeleted(w http.ResponseWriter, r *http.Request, action string) (include, ok bool) {
+	v := r.URL.Query().Get("include_deleted")
+	if v == "" {
+		return false, true
+	}
+	include, err := strconv.ParseBool(v)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidQuery, "параметр include_deleted должен быть true или false")
+		return false, false
+	}
+	if p := auth.PrincipalFromContext(r.Context()); include && (p == nil || !p.HasScope(auth.PermUsersDelete)) {
+		h.deny(w, r, access{action: action, perm: auth.PermUsersDelete}, p)
+		return false, false
+	}
+	return include, true
+}
+
+// обрабатывает POST-запросы для создания пользователя
+// жидает JSON в теле запроса
+func (h *UserHandler) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 	var user models.User
 	err := json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
-		log.Printf("Ошибка декодирования JSON: %v", err)
-		http.Error(w, "Некорректный JSON: "+err.Error(), http.StatusBadRequest)
+		h.log(r, slog.LevelInfo, "некорректный JSON", logging.Err(err))
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Некорректный JSON: "+err.Error())
 		return
 	}
 	defer r.Body.Close()
 
-	if user.Name == "" || user.Email == "" {
-		http.Error(w, "Имя и email не могут быть пустыми", http.StatusBadRequest)
+	if err := storage.ValidateUser(&user); err != nil {
+		h.writeStorageError(w, r, err, "")
 		return
 	}
 
-	id, err := h.Storage.CreateUser(&user)
+	id, err := h.Storage.CreateUser(r.Context(), &user)
 	if err != nil {
-		log.Printf("Ошибка создания пользователя в хранилище: %v", err)
-		http.Error(w, "Внутренняя ошибка сервера при создании пользователя", http.StatusInternalServerError)
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при создании пользователя")
 		return
 	}
 	user.ID = id
 
+	setUserETag(w, &user)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(user)
@@ -56,133 +179,282 @@ func (h *UserHandler) CreateUserHandler(w http.ResponseWriter, r *http.Request)
 
 // обрабатывает GET-запросы для получения пользователя по ID
 func (h *UserHandler) GetUserHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+	id, ok := h.pathID(w, r)
+	if !ok {
+		return
+	}
+	include, ok := h.includeDeleted(w, r, "users.get")
+	if !ok {
 		return
 	}
 
-	pathRemainder := strings.TrimPrefix(r.URL.Path, "/api/v1/users")
-	idStr := strings.Trim(pathRemainder, "/")
-
-	if idStr != "" { // Если есть ID
-		id, err := strconv.ParseInt(idStr, 10, 64)
-		if err != nil {
-			log.Printf("Некорректный ID пользователя '%s': %v", idStr, err)
-			http.Error(w, "Некорректный ID пользователя", http.StatusBadRequest)
-			return
-		}
-
-		user, err := h.Storage.GetUserByID(id)
-		if err != nil {
-			if strings.Contains(err.Error(), "пользователь не найден") {
-				log.Printf("Пользователь с ID %d не найден: %v", id, err)
-				http.Error(w, "Пользователь не найден", http.StatusNotFound)
-			} else {
-				log.Printf("Ошибка получения пользователя по ID %d из хранилища: %v", id, err)
-				http.Error(w, "Внутренняя ошибка сервера при получении пользователя", http.StatusInternalServerError)
-			}
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(user)
-	} else {
-		users, err := h.Storage.GetAllUsers()
-		if err != nil {
-			log.Printf("Ошибка получения всех пользователей из хранилища: %v", err)
-			http.Error(w, "Внутренняя ошибка сервера при получении списка пользователей", http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(users)
+	get := h.Storage.GetUserByID
+	if include {
+		get = h.Storage.GetUserIncludingDeleted
 	}
+	user, err := get(r.Context(), id)
+	if err != nil {
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при получении пользователя", slog.Int64("user_id", id))
+		return
+	}
+	setUserETag(w, user)
+	if notModified(r, userETag(user)) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
 }
 
-func (h *UserHandler) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+// ListUsersHandler отдает список пользователей постранично: сами пользователи
+// в теле, навигация - в заголовках Link и X-Total-Count
+func (h *UserHandler) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	pr, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidQuery, err.Error())
 		return
 	}
-
-	pathRemainder := strings.TrimPrefix(r.URL.Path, "/api/v1/users")
-	idStr := strings.Trim(pathRemainder, "/")
-
-	if idStr == "" {
-		http.Error(w, "ID пользователя должен быть указан в пути для обновления", http.StatusBadRequest)
+	include, ok := h.includeDeleted(w, r, "users.list")
+	if !ok {
 		return
 	}
-
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	pr.params.Filter.IncludeDeleted = include
+	page, err := h.Storage.ListUsers(r.Context(), pr.params)
 	if err != nil {
-		log.Printf("Некорректный ID пользователя для обновления '%s': %v", idStr, err)
-		http.Error(w, "Некорректный ID пользователя", http.StatusBadRequest)
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при получении списка пользователей")
+		return
+	}
+	if page.Users == nil {
+		page.Users = []models.User{}
+	}
+	setPaginationHeaders(w, r, pr, page)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page.Users)
+}
+
+func (h *UserHandler) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.pathID(w, r)
+	if !ok {
 		return
 	}
 
 	var user models.User
-	err = json.NewDecoder(r.Body).Decode(&user)
+	err := json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
-		log.Printf("Ошибка декодирования JSON при обновлении: %v", err)
-		http.Error(w, "Некорректный JSON: "+err.Error(), http.StatusBadRequest)
+		h.log(r, slog.LevelInfo, "некорректный JSON", slog.Int64("user_id", id), logging.Err(err))
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Некорректный JSON: "+err.Error())
 		return
 	}
 	defer r.Body.Close()
 
 	user.ID = id // Устанавливаем ID из URL
 
-	if user.Name == "" || user.Email == "" {
-		http.Error(w, "Имя и email не могут быть пустыми при обновлении", http.StatusBadRequest)
+	if err := storage.ValidateUser(&user); err != nil {
+		h.writeStorageError(w, r, err, "", slog.Int64("user_id", id))
+		return
+	}
+
+	// Версия в теле игнорируется: предусловие задается только заголовком If-Match
+	user.Version, ok = h.expectedVersion(w, r, func() (*models.User, error) {
+		return h.Storage.GetUserByID(r.Context(), id)
+	})
+	if !ok {
 		return
 	}
 
-	err = h.Storage.UpdateUser(&user)
+	err = h.Storage.UpdateUser(r.Context(), &user)
 	if err != nil {
-		if strings.Contains(err.Error(), "не найден для обновления") {
-			log.Printf("Пользователь с ID %d не найден для обновления: %v", id, err)
-			http.Error(w, "Пользователь не найден для обновления", http.StatusNotFound)
-		} else {
-			log.Printf("Ошибка обновления пользователя с ID %d в хранилище: %v", id, err)
-			http.Error(w, "Внутренняя ошибка сервера при обновлении пользователя", http.StatusInternalServerError)
-		}
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при обновлении пользователя", slog.Int64("user_id", id))
 		return
 	}
 
+	setUserETag(w, &user)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
 }
 
-// обрабатывает DELETE-запросы для удаления пользователя
-func (h *UserHandler) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
-		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+// maxPatchBodySize ограничивает размер тела PATCH-запроса
+const maxPatchBodySize = 1 << 20
+
+// PatchUserHandler обрабатывает PATCH-запросы: частичное обновление пользователя
+// в формате JSON Merge Patch (RFC 7396) или JSON Patch (RFC 6902).
+// В хранилище записываются только реально изменившиеся поля
+func (h *UserHandler) PatchUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.pathID(w, r)
+	if !ok {
 		return
 	}
 
-	pathRemainder := strings.TrimPrefix(r.URL.Path, "/api/v1/users")
-	idStr := strings.Trim(pathRemainder, "/")
+	var applyPatch func(doc, patch []byte) ([]byte, error)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case jsonpatch.MergePatchType:
+		applyPatch = jsonpatch.MergePatch
+	case jsonpatch.JSONPatchType:
+		applyPatch = jsonpatch.Apply
+	default:
+		w.Header().Set("Accept-Patch", jsonpatch.MergePatchType+", "+jsonpatch.JSONPatchType)
+		problem.Error(w, r, http.StatusUnsupportedMediaType, problem.CodeUnsupportedMedia,
+			"PATCH поддерживает только "+jsonpatch.MergePatchType+" и "+jsonpatch.JSONPatchType)
+		return
+	}
 
-	if idStr == "" {
-		http.Error(w, "ID пользователя должен быть указан в пути для удаления", http.StatusBadRequest)
+	patch, err := io.ReadAll(io.LimitReader(r.Body, maxPatchBodySize))
+	if err != nil {
+		h.log(r, slog.LevelInfo, "ошибка чтения тела PATCH", slog.Int64("user_id", id), logging.Err(err))
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidJSON, "Не удалось прочитать тело запроса")
 		return
 	}
+	defer r.Body.Close()
 
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	current, err := h.Storage.GetUserByID(r.Context(), id)
 	if err != nil {
-		log.Printf("Некорректный ID пользователя для удаления '%s': %v", idStr, err)
-		http.Error(w, "Некорректный ID пользователя", http.StatusBadRequest)
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при получении пользователя", slog.Int64("user_id", id))
+		return
+	}
+	version, ok := h.expectedVersion(w, r, func() (*models.User, error) { return current, nil })
+	if !ok {
+		return
+	}
+	if version != 0 && version != current.Version {
+		problem.Error(w, r, http.StatusPreconditionFailed, problem.CodePreconditionFailed,
+			"Пользователь был изменен: версия не совпадает с указанной в If-Match")
+		return
+	}
+	doc, err := json.Marshal(current)
+	if err != nil {
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при обновлении пользователя", slog.Int64("user_id", id))
 		return
 	}
 
-	err = h.Storage.DeleteUser(id)
+	patched, err := applyPatch(doc, patch)
 	if err != nil {
-		if strings.Contains(err.Error(), "не найден для удаления") {
-			log.Printf("Пользователь с ID %d не найден для удаления: %v", id, err)
-			http.Error(w, "Пользователь не найден для удаления", http.StatusNotFound)
+		h.log(r, slog.LevelInfo, "ошибка применения патча", slog.Int64("user_id", id), logging.Err(err))
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			problem.Error(w, r, http.StatusConflict, problem.CodeConflict, err.Error())
 		} else {
-			log.Printf("Ошибка удаления пользователя с ID %d из хранилища: %v", id, err)
-			http.Error(w, "Внутренняя ошибка сервера при удалении пользователя", http.StatusInternalServerError)
+			problem.Error(w, r, http.StatusUnprocessableEntity, problem.CodeInvalidPatch, err.Error())
 		}
 		return
 	}
 
+	var updated models.User
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields() // Патч не может добавить пользователю несуществующие поля
+	if err := dec.Decode(&updated); err != nil {
+		problem.Error(w, r, http.StatusUnprocessableEntity, problem.CodeInvalidPatch,
+			"Результат применения патча не является пользователем: "+err.Error())
+		return
+	}
+	if updated.ID != id {
+		writeValidationError(w, r, &storage.ValidationError{Field: "id", Message: "не может быть изменен"})
+		return
+	}
+	if updated.Version != current.Version {
+		writeValidationError(w, r, &storage.ValidationError{Field: "version", Message: "не может быть изменена"})
+		return
+	}
+	if !sameTime(updated.DeletedAt, current.DeletedAt) {
+		// Иначе изменение молча потерялось бы: удаляют через DELETE, восстанавливают через :restore
+		err := &storage.ValidationError{Field: "deleted_at", Message: "не может быть изменено через PATCH"}
+		problem.Write(w, r, problem.New(http.StatusUnprocessableEntity, problem.CodeValidation, err.Error()).
+			WithErrors(problem.FieldError{Field: err.Field, Message: err.Message}))
+		return
+	}
+	if err := storage.ValidateUser(&updated); err != nil {
+		h.writeStorageError(w, r, err, "", slog.Int64("user_id", id))
+		return
+	}
+
+	// Изменение применяется, только если запись не поменялась с момента чтения
+	changes := storage.UserChanges{Version: current.Version}
+	if updated.Name != current.Name {
+		changes.Name = &updated.Name
+	}
+	if updated.Email != current.Email {
+		changes.Email = &updated.Email
+	}
+
+	result, err := h.Storage.PatchUser(r.Context(), id, changes)
+	if err != nil {
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при обновлении пользователя", slog.Int64("user_id", id))
+		return
+	}
+
+	setUserETag(w, result)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// обрабатывает DELETE-запросы для удаления пользователя. Пользователь
+// помечается удаленным и до окончательного удаления может быть восстановлен
+func (h *UserHandler) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.pathID(w, r)
+	if !ok {
+		return
+	}
+
+	version, ok := h.expectedVersion(w, r, func() (*models.User, error) {
+		return h.Storage.GetUserByID(r.Context(), id)
+	})
+	if !ok {
+		return
+	}
+
+	err := h.Storage.DeleteUser(r.Context(), id, version)
+	if err != nil {
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при удалении пользователя", slog.Int64("user_id", id))
+		return
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// RestoreRoute - обработчик POST /api/v1/users/{id}:restore с проверкой прав.
+// ServeMux не поддерживает шаблон "{id}:restore", поэтому маршрут
+// регистрируется как POST /api/v1/users/{id}, а действие отделяется здесь
+func (h *UserHandler) RestoreRoute() http.HandlerFunc {
+	restore := h.authorize(access{action: "users.restore", perm: auth.PermUsersDelete}, h.RestoreUserHandler)
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, verb, found := strings.Cut(r.PathValue("id"), ":")
+		if !found || verb != "restore" {
+			router.NotFound(w, r)
+			return
+		}
+		r.SetPathValue("id", id)
+		restore(w, r)
+	}
+}
+
+// RestoreUserHandler снимает с пользователя пометку об удалении и отдает его
+func (h *UserHandler) RestoreUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.pathID(w, r)
+	if !ok {
+		return
+	}
+
+	version, ok := h.expectedVersion(w, r, func() (*models.User, error) {
+		return h.Storage.GetUserIncludingDeleted(r.Context(), id)
+	})
+	if !ok {
+		return
+	}
+
+	user, err := h.Storage.RestoreUser(r.Context(), id, version)
+	if err != nil {
+		h.writeStorageError(w, r, err, "Внутренняя ошибка сервера при восстановлении пользователя", slog.Int64("user_id", id))
+		return
+	}
+
+	setUserETag(w, user)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// sameTime сравнивает необязательные моменты времени
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
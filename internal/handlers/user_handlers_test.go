@@ -1,19 +1,41 @@
 package handlers
 
 import (
-	"bytes"         // Для создания io.Reader из строки (тело запроса)
+	"bytes" // Для создания io.Reader из строки (тело запроса)
+	"context"
 	"encoding/json" // Для кодирования/декодирования JSON
 	"net/http"
 	"net/http/httptest" // Для тестирования HTTP обработчиков
 	"strconv"
 	"testing" // Пакет для написания тестов
+	"time"
 
 	"fmt"
 
+	"github.com/casanera/DlugoshSolutions/internal/audit"
+	"github.com/casanera/DlugoshSolutions/internal/auth"
 	"github.com/casanera/DlugoshSolutions/internal/models"
+	"github.com/casanera/DlugoshSolutions/internal/problem"
+	"github.com/casanera/DlugoshSolutions/internal/router"
 	"github.com/casanera/DlugoshSolutions/internal/storage"
 )
 
+// admin - субъект со всеми разрешениями; от его имени выполняются запросы
+// в тестах, которые не проверяют права доступа
+var admin = &auth.Principal{Kind: "test", ID: "admin",
+	Scopes: []string{auth.PermUsersRead, auth.PermUsersWrite, auth.PermUsersDelete}}
+
+// serve прогоняет запрос через роутер, как в main, чтобы обработчики
+// получили значения r.PathValue. Запрос без субъекта выполняется от имени admin
+func serve(h *UserHandler, w http.ResponseWriter, req *http.Request) {
+	if auth.PrincipalFromContext(req.Context()) == nil {
+		req = req.WithContext(auth.WithPrincipal(req.Context(), admin))
+	}
+	rt := router.New()
+	rt.Resource("/api/v1/users", h.Resource())
+	rt.ServeHTTP(w, req)
+}
+
 func TestCreateUserHandler(t *testing.T) {
 	mockStorage := storage.NewMockUserStorage()
 	userHandler := NewUserHandler(mockStorage) // Создаем хендлер с моком
@@ -76,7 +98,7 @@ func TestCreateUserHandler(t *testing.T) {
 
 			rr := httptest.NewRecorder()
 
-			userHandler.CreateUserHandler(rr, req)
+			serve(userHandler, rr, req)
 
 			// Проверяем статус-код
 			if status := rr.Code; status != tc.expectedStatusCode {
@@ -113,9 +135,9 @@ func TestGetUserHandler(t *testing.T) {
 	mockStorage.NextID = 2
 
 	t.Run("Получение всех пользователей (один существует)", func(t *testing.T) {
-		req, _ := http.NewRequest(http.MethodGet, "/api/v1/users/", nil)
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/users", nil)
 		rr := httptest.NewRecorder()
-		userHandler.GetUserHandler(rr, req)
+		serve(userHandler, rr, req)
 
 		if status := rr.Code; status != http.StatusOK {
 			t.Errorf("GetAll: неверный статус-код: получено %v, ожидалось %v. Тело: %s", status, http.StatusOK, rr.Body.String())
@@ -136,7 +158,7 @@ func TestGetUserHandler(t *testing.T) {
 	t.Run("Получение пользователя по существующему ID", func(t *testing.T) {
 		req, _ := http.NewRequest(http.MethodGet, "/api/v1/users/"+strconv.FormatInt(existingUser.ID, 10), nil)
 		rr := httptest.NewRecorder()
-		userHandler.GetUserHandler(rr, req)
+		serve(userHandler, rr, req)
 
 		if status := rr.Code; status != http.StatusOK {
 			t.Errorf("GetByID: неверный статус-код: получено %v, ожидалось %v. Тело: %s", status, http.StatusOK, rr.Body.String())
@@ -154,7 +176,7 @@ func TestGetUserHandler(t *testing.T) {
 		nonExistentID := int64(999)
 		req, _ := http.NewRequest(http.MethodGet, "/api/v1/users/"+strconv.FormatInt(nonExistentID, 10), nil)
 		rr := httptest.NewRecorder()
-		userHandler.GetUserHandler(rr, req)
+		serve(userHandler, rr, req)
 
 		if status := rr.Code; status != http.StatusNotFound {
 			t.Errorf("GetByID (not found): неверный статус-код: получено %v, ожидалось %v. Тело: %s", status, http.StatusNotFound, rr.Body.String())
@@ -164,10 +186,723 @@ func TestGetUserHandler(t *testing.T) {
 	t.Run("Получение пользователя с некорректным ID", func(t *testing.T) {
 		req, _ := http.NewRequest(http.MethodGet, "/api/v1/users/abc", nil)
 		rr := httptest.NewRecorder()
-		userHandler.GetUserHandler(rr, req)
+		serve(userHandler, rr, req)
 
 		if status := rr.Code; status != http.StatusBadRequest {
 			t.Errorf("GetByID (invalid id): неверный статус-код: получено %v, ожидалось %v. Тело: %s", status, http.StatusBadRequest, rr.Body.String())
 		}
 	})
 }
+
+func TestUserHandlerContextCancellation(t *testing.T) {
+	mockStorage := storage.NewMockUserStorage()
+	userHandler := NewUserHandler(mockStorage)
+	mockStorage.Users[1] = &models.User{ID: 1, Name: "Slow User", Email: "slow@example.com"}
+	mockStorage.Delay = time.Second // Хранилище "думает" дольше, чем готов ждать клиент
+
+	t.Run("Истек дедлайн запроса", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "/api/v1/users/1", nil)
+		rr := httptest.NewRecorder()
+
+		start := time.Now()
+		serve(userHandler, rr, req)
+
+		if elapsed := time.Since(start); elapsed >= mockStorage.Delay {
+			t.Errorf("Обработчик не прервал запрос к хранилищу: прошло %v", elapsed)
+		}
+		if status := rr.Code; status != http.StatusGatewayTimeout {
+			t.Errorf("Неверный статус-код: получено %v, ожидалось %v. Тело: %s", status, http.StatusGatewayTimeout, rr.Body.String())
+		}
+	})
+
+	t.Run("Клиент отключился", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel() // Клиент ушел еще до обращения к хранилищу
+		req, _ := http.NewRequestWithContext(ctx, http.MethodDelete, "/api/v1/users/1", nil)
+		rr := httptest.NewRecorder()
+
+		serve(userHandler, rr, req)
+
+		if rr.Body.Len() != 0 {
+			t.Errorf("Ожидалось пустое тело ответа для отмененного запроса, получено: %s", rr.Body.String())
+		}
+		if u, exists := mockStorage.Users[1]; !exists || u.DeletedAt != nil {
+			t.Errorf("Пользователь не должен удаляться при отмененном контексте")
+		}
+	})
+}
+
+func TestStorageErrorStatusMapping(t *testing.T) {
+	mockStorage := storage.NewMockUserStorage()
+	userHandler := NewUserHandler(mockStorage)
+
+	testCases := []struct {
+		name               string
+		storageErr         error
+		expectedStatusCode int
+	}{
+		{"Не найден", fmt.Errorf("обертка: %w", storage.ErrNotFound), http.StatusNotFound},
+		{"Дубликат email", fmt.Errorf("обертка: %w", storage.ErrDuplicateEmail), http.StatusConflict},
+		{"Конфликт", fmt.Errorf("обертка: %w", storage.ErrConflict), http.StatusConflict},
+		{"Ошибка валидации", fmt.Errorf("обертка: %w", &storage.ValidationError{Field: "email", Message: "плохой"}), http.StatusBadRequest},
+		{"Непредвиденная ошибка", fmt.Errorf("симуляция ошибки БД"), http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockStorage.ReturnError = tc.storageErr
+			req, _ := http.NewRequest(http.MethodPut, "/api/v1/users/1", bytes.NewBufferString(`{"name": "User", "email": "user@example.com"}`))
+			rr := httptest.NewRecorder()
+			serve(userHandler, rr, req)
+
+			if status := rr.Code; status != tc.expectedStatusCode {
+				t.Errorf("Неверный статус-код: получено %v, ожидалось %v. Тело: %s", status, tc.expectedStatusCode, rr.Body.String())
+			}
+		})
+	}
+
+	t.Run("Удаление несуществующего пользователя", func(t *testing.T) {
+		mockStorage.ReturnError = nil
+		req, _ := http.NewRequest(http.MethodDelete, "/api/v1/users/999", nil)
+		rr := httptest.NewRecorder()
+		serve(userHandler, rr, req)
+
+		if status := rr.Code; status != http.StatusNotFound {
+			t.Errorf("Неверный статус-код: получено %v, ожидалось %v. Тело: %s", status, http.StatusNotFound, rr.Body.String())
+		}
+	})
+}
+
+func TestDuplicateEmailConflict(t *testing.T) {
+	mockStorage := storage.NewMockUserStorage()
+	userHandler := NewUserHandler(mockStorage)
+	mockStorage.Users[1] = &models.User{ID: 1, Name: "First", Email: "taken@example.com"}
+	mockStorage.Users[2] = &models.User{ID: 2, Name: "Second", Email: "second@example.com"}
+	mockStorage.NextID = 3
+
+	t.Run("Создание с занятым email", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/users", bytes.NewBufferString(`{"name": "Dup", "email": "taken@example.com"}`))
+		rr := httptest.NewRecorder()
+		serve(userHandler, rr, req)
+
+		if status := rr.Code; status != http.StatusConflict {
+			t.Errorf("Неверный статус-код: получено %v, ожидалось %v. Тело: %s", status, http.StatusConflict, rr.Body.String())
+		}
+		if !bytes.Contains(rr.Body.Bytes(), []byte("email")) {
+			t.Errorf("Тело ответа должно называть конфликтующее поле email, получено: %s", rr.Body.String())
+		}
+		if len(mockStorage.Users) != 2 {
+			t.Errorf("Пользователь-дубликат не должен сохраняться, в хранилище %d пользователей", len(mockStorage.Users))
+		}
+	})
+
+	t.Run("Обновление на занятый email", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPut, "/api/v1/users/2", bytes.NewBufferString(`{"name": "Second", "email": "taken@example.com"}`))
+		rr := httptest.NewRecorder()
+		serve(userHandler, rr, req)
+
+		if status := rr.Code; status != http.StatusConflict {
+			t.Errorf("Неверный статус-код: получено %v, ожидалось %v. Тело: %s", status, http.StatusConflict, rr.Body.String())
+		}
+	})
+
+	t.Run("Обновление с сохранением своего email", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPut, "/api/v1/users/1", bytes.NewBufferString(`{"name": "Renamed", "email": "taken@example.com"}`))
+		rr := httptest.NewRecorder()
+		serve(userHandler, rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("Неверный статус-код: получено %v, ожидалось %v. Тело: %s", status, http.StatusOK, rr.Body.String())
+		}
+	})
+}
+
+func TestProblemDetailsResponse(t *testing.T) {
+	mockStorage := storage.NewMockUserStorage()
+	userHandler := NewUserHandler(mockStorage)
+
+	decodeProblem := func(t *testing.T, rr *httptest.ResponseRecorder) problem.Problem {
+		t.Helper()
+		if ct := rr.Header().Get("Content-Type"); ct != problem.ContentType {
+			t.Errorf("Неверный Content-Type: получено %q, ожидалось %q", ct, problem.ContentType)
+		}
+		var p problem.Problem
+		if err := json.NewDecoder(rr.Body).Decode(&p); err != nil {
+			t.Fatalf("Не удалось декодировать problem+json: %v", err)
+		}
+		return p
+	}
+
+	t.Run("Пользователь не найден", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/users/42", nil)
+		rr := httptest.NewRecorder()
+		serve(userHandler, rr, req)
+
+		p := decodeProblem(t, rr)
+		if p.Status != http.StatusNotFound || p.Code != problem.CodeNotFound {
+			t.Errorf("Неверная проблема: status=%d code=%q", p.Status, p.Code)
+		}
+		if p.Instance != "/api/v1/users/42" {
+			t.Errorf("Неверный instance: %q", p.Instance)
+		}
+		if p.Type == "" || p.Title == "" || p.Detail == "" {
+			t.Errorf("Поля type, title и detail должны быть заполнены: %+v", p)
+		}
+	})
+
+	t.Run("Ошибка валидации по полю", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/users", bytes.NewBufferString(`{"name": "Test", "email": ""}`))
+		rr := httptest.NewRecorder()
+		serve(userHandler, rr, req)
+
+		p := decodeProblem(t, rr)
+		if p.Status != http.StatusBadRequest || p.Code != problem.CodeValidation {
+			t.Errorf("Неверная проблема: status=%d code=%q", p.Status, p.Code)
+		}
+		if len(p.Errors) != 1 || p.Errors[0].Field != "email" {
+			t.Errorf("Ожидалась ошибка по полю email, получено: %+v", p.Errors)
+		}
+	})
+}
+
+func TestListUsersPagination(t *testing.T) {
+	mockStorage := storage.NewMockUserStorage()
+	userHandler := NewUserHandler(mockStorage)
+	for i := int64(1); i <= 5; i++ {
+		mockStorage.Users[i] = &models.User{ID: i, Name: "User " + strconv.FormatInt(i, 10), Email: fmt.Sprintf("u%d@example.com", i)}
+	}
+	mockStorage.NextID = 6
+
+	list := func(t *testing.T, target string) ([]models.User, map[string]string, *httptest.ResponseRecorder) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, target, nil)
+		rr := httptest.NewRecorder()
+		serve(userHandler, rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Неверный статус-код для %s: %d. Тело: %s", target, rr.Code, rr.Body.String())
+		}
+		var users []models.User
+		if err := json.NewDecoder(rr.Body).Decode(&users); err != nil {
+			t.Fatalf("Не удалось декодировать JSON: %v", err)
+		}
+		links := map[string]string{}
+		for _, part := range bytes.Split([]byte(rr.Header().Get("Link")), []byte(", ")) {
+			var url, rel string
+			if _, err := fmt.Sscanf(string(part), "<%s rel=%q", &url, &rel); err == nil {
+				links[rel] = url[:len(url)-2] // отрезаем ">;"
+			}
+		}
+		return users, links, rr
+	}
+
+	ids := func(users []models.User) []int64 {
+		var res []int64
+		for _, u := range users {
+			res = append(res, u.ID)
+		}
+		return res
+	}
+
+	t.Run("Курсорная пагинация вперед и назад", func(t *testing.T) {
+		users, links, rr := list(t, "/api/v1/users?limit=2")
+		if got := fmt.Sprint(ids(users)); got != "[1 2]" {
+			t.Errorf("Первая страница: получено %s", got)
+		}
+		if total := rr.Header().Get("X-Total-Count"); total != "5" {
+			t.Errorf("X-Total-Count: получено %q, ожидалось 5", total)
+		}
+		if _, ok := links["prev"]; ok {
+			t.Errorf("У первой страницы не должно быть ссылки prev")
+		}
+
+		users, links, _ = list(t, links["next"])
+		if got := fmt.Sprint(ids(users)); got != "[3 4]" {
+			t.Errorf("Вторая страница: получено %s", got)
+		}
+
+		users, _, _ = list(t, links["prev"])
+		if got := fmt.Sprint(ids(users)); got != "[1 2]" {
+			t.Errorf("Возврат назад: получено %s", got)
+		}
+	})
+
+	t.Run("Постраничная навигация page/per_page", func(t *testing.T) {
+		users, links, _ := list(t, "/api/v1/users?page=3&per_page=2")
+		if got := fmt.Sprint(ids(users)); got != "[5]" {
+			t.Errorf("Последняя страница: получено %s", got)
+		}
+		if _, ok := links["next"]; ok {
+			t.Errorf("У последней страницы не должно быть ссылки next")
+		}
+		if links["last"] != "/api/v1/users?page=3&per_page=2" {
+			t.Errorf("Неверная ссылка last: %q", links["last"])
+		}
+	})
+
+	t.Run("Размер страницы ограничен сервером", func(t *testing.T) {
+		pr, err := parsePageRequest(map[string][]string{"limit": {"100000"}})
+		if err != nil {
+			t.Fatalf("Неожиданная ошибка: %v", err)
+		}
+		if pr.params.Limit != MaxPageSize {
+			t.Errorf("Limit: получено %d, ожидалось %d", pr.params.Limit, MaxPageSize)
+		}
+	})
+
+	for _, target := range []string{
+		"/api/v1/users?limit=0",
+		"/api/v1/users?cursor=garbage",
+		"/api/v1/users?page=1&limit=5",
+		"/api/v1/users?page=9223372036854775807&per_page=100",
+		"/api/v1/users?page=92233720368547759&per_page=100",
+	} {
+		t.Run("Некорректные параметры "+target, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, target, nil)
+			rr := httptest.NewRecorder()
+			serve(userHandler, rr, req)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Неверный статус-код: получено %d, ожидалось %d", rr.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestListUsersFilterAndSort(t *testing.T) {
+	mockStorage := storage.NewMockUserStorage()
+	userHandler := NewUserHandler(mockStorage)
+	for _, u := range []*models.User{
+		{ID: 1, Name: "Иван Петров", Email: "ivan@ourdomain.ru"},
+		{ID: 2, Name: "Мария Иванова", Email: "maria@other.com"},
+		{ID: 3, Name: "Петр Сидоров", Email: "petr@ourdomain.ru"},
+		{ID: 4, Name: "Анна", Email: "ivan.a@other.com"},
+	} {
+		mockStorage.Users[u.ID] = u
+	}
+
+	testCases := []struct {
+		name        string
+		query       string
+		expectedIDs string
+	}{
+		{"Точный email", "email=maria@other.com", "[2]"},
+		{"Префикс email", "email_prefix=ivan", "[1 4]"},
+		{"Суффикс email", "email_suffix=@ourdomain.ru", "[1 3]"},
+		{"Подстрока имени без учета регистра", "name_contains=иван", "[1 2]"},
+		{"Комбинация фильтров", "name_contains=иван&email_suffix=@ourdomain.ru", "[1]"},
+		{"Сортировка по имени", "sort=name", "[4 1 2 3]"},
+		{"Сортировка по убыванию email", "sort=-email", "[3 2 1 4]"},
+		{"Сортировка с фильтром и лимитом", "email_suffix=@ourdomain.ru&sort=-id&limit=1", "[3]"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/api/v1/users?"+tc.query, nil)
+			rr := httptest.NewRecorder()
+			serve(userHandler, rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Неверный статус-код: %d. Тело: %s", rr.Code, rr.Body.String())
+			}
+			var users []models.User
+			if err := json.NewDecoder(rr.Body).Decode(&users); err != nil {
+				t.Fatalf("Не удалось декодировать JSON: %v", err)
+			}
+			var ids []int64
+			for _, u := range users {
+				ids = append(ids, u.ID)
+			}
+			if got := fmt.Sprint(ids); got != tc.expectedIDs {
+				t.Errorf("Получены ID %s, ожидались %s", got, tc.expectedIDs)
+			}
+		})
+	}
+
+	for _, query := range []string{"sort=password", "sort=name,name", "sort=name&cursor=" + encodeCursor(cursorAfter, 1)} {
+		t.Run("Некорректный запрос "+query, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/api/v1/users?"+query, nil)
+			rr := httptest.NewRecorder()
+			serve(userHandler, rr, req)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Неверный статус-код: получено %d, ожидалось %d", rr.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestPatchUserHandler(t *testing.T) {
+	mockStorage := storage.NewMockUserStorage()
+	userHandler := NewUserHandler(mockStorage)
+
+	testCases := []struct {
+		name               string
+		contentType        string
+		body               string
+		expectedStatusCode int
+		expectedUser       models.User
+		expectedChanged    []string // Какие поля переданы в PatchUser
+		expectedCode       string   // Код problem для ошибок, если важен
+	}{
+		{
+			name:               "Merge Patch меняет только email",
+			contentType:        "application/merge-patch+json",
+			body:               `{"email": "new@example.com"}`,
+			expectedStatusCode: http.StatusOK,
+			expectedUser:       models.User{ID: 1, Name: "Patch User", Email: "new@example.com", Version: 2},
+			expectedChanged:    []string{"email"},
+		},
+		{
+			name:               "JSON Patch с test и replace",
+			contentType:        "application/json-patch+json; charset=utf-8",
+			body:               `[{"op": "test", "path": "/name", "value": "Patch User"}, {"op": "replace", "path": "/name", "value": "Renamed"}]`,
+			expectedStatusCode: http.StatusOK,
+			expectedUser:       models.User{ID: 1, Name: "Renamed", Email: "patch@example.com", Version: 2},
+			expectedChanged:    []string{"name"},
+		},
+		{
+			name:               "JSON Patch с проваленным test",
+			contentType:        "application/json-patch+json",
+			body:               `[{"op": "test", "path": "/name", "value": "Someone Else"}, {"op": "replace", "path": "/name", "value": "Renamed"}]`,
+			expectedStatusCode: http.StatusConflict,
+		},
+		{
+			name:               "Удаление обязательного поля",
+			contentType:        "application/merge-patch+json",
+			body:               `{"name": null}`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Попытка изменить ID",
+			contentType:        "application/merge-patch+json",
+			body:               `{"id": 2}`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Merge Patch не может пометить удаленным",
+			contentType:        "application/merge-patch+json",
+			body:               `{"deleted_at": "2024-01-01T00:00:00Z"}`,
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedCode:       problem.CodeValidation,
+		},
+		{
+			// У неудаленного пользователя deleted_at нет, поэтому replace не применяется
+			name:               "JSON Patch не может заменить deleted_at",
+			contentType:        "application/json-patch+json",
+			body:               `[{"op": "replace", "path": "/deleted_at", "value": "2024-01-01T00:00:00Z"}]`,
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedCode:       problem.CodeInvalidPatch,
+		},
+		{
+			name:               "JSON Patch не может добавить deleted_at",
+			contentType:        "application/json-patch+json",
+			body:               `[{"op": "add", "path": "/deleted_at", "value": "2024-01-01T00:00:00Z"}]`,
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedCode:       problem.CodeValidation,
+		},
+		{
+			name:               "Неизвестное поле",
+			contentType:        "application/merge-patch+json",
+			body:               `{"password": "secret"}`,
+			expectedStatusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:               "Занятый email",
+			contentType:        "application/merge-patch+json",
+			body:               `{"email": "other@example.com"}`,
+			expectedStatusCode: http.StatusConflict,
+		},
+		{
+			name:               "Неподдерживаемый Content-Type",
+			contentType:        "application/json",
+			body:               `{"email": "new@example.com"}`,
+			expectedStatusCode: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockStorage.Users = map[int64]*models.User{
+				1: {ID: 1, Name: "Patch User", Email: "patch@example.com", Version: 1},
+				2: {ID: 2, Name: "Other", Email: "other@example.com", Version: 1},
+			}
+			mockStorage.PatchArg = nil
+
+			req, _ := http.NewRequest(http.MethodPatch, "/api/v1/users/1", bytes.NewBufferString(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			rr := httptest.NewRecorder()
+			serve(userHandler, rr, req)
+
+			if rr.Code != tc.expectedStatusCode {
+				t.Fatalf("Неверный статус-код: получено %d, ожидалось %d. Тело: %s", rr.Code, tc.expectedStatusCode, rr.Body.String())
+			}
+			if tc.expectedStatusCode != http.StatusOK {
+				var p problem.Problem
+				if tc.expectedCode != "" && (json.Unmarshal(rr.Body.Bytes(), &p) != nil || p.Code != tc.expectedCode) {
+					t.Errorf("Код %q, ожидался %q", p.Code, tc.expectedCode)
+				}
+				if tc.expectedStatusCode == http.StatusUnsupportedMediaType && rr.Header().Get("Accept-Patch") == "" {
+					t.Errorf("Ответ 415 должен содержать заголовок Accept-Patch")
+				}
+				return
+			}
+
+			var user models.User
+			if err := json.NewDecoder(rr.Body).Decode(&user); err != nil {
+				t.Fatalf("Не удалось декодировать JSON: %v", err)
+			}
+			if user != tc.expectedUser {
+				t.Errorf("Получен пользователь %+v, ожидался %+v", user, tc.expectedUser)
+			}
+			var changed []string
+			if mockStorage.PatchArg.Name != nil {
+				changed = append(changed, "name")
+			}
+			if mockStorage.PatchArg.Email != nil {
+				changed = append(changed, "email")
+			}
+			if fmt.Sprint(changed) != fmt.Sprint(tc.expectedChanged) {
+				t.Errorf("В хранилище переданы поля %v, ожидались %v", changed, tc.expectedChanged)
+			}
+		})
+	}
+}
+
+func TestOptimisticConcurrency(t *testing.T) {
+	mockStorage := storage.NewMockUserStorage()
+	userHandler := NewUserHandler(mockStorage)
+
+	do := func(method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, target, bytes.NewBufferString(body))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		serve(userHandler, rr, req)
+		return rr
+	}
+
+	reset := func() {
+		mockStorage.Users = map[int64]*models.User{
+			1: {ID: 1, Name: "Versioned", Email: "v@example.com", Version: 3},
+		}
+	}
+
+	t.Run("GET отдает ETag и учитывает If-None-Match", func(t *testing.T) {
+		reset()
+		rr := do(http.MethodGet, "/api/v1/users/1", "", nil)
+		etag := rr.Header().Get("ETag")
+		if etag != `"v3"` {
+			t.Fatalf("Неверный ETag: %q", etag)
+		}
+		rr = do(http.MethodGet, "/api/v1/users/1", "", map[string]string{"If-None-Match": "W/" + etag})
+		if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+			t.Errorf("Ожидался 304 без тела, получено %d: %s", rr.Code, rr.Body.String())
+		}
+		rr = do(http.MethodGet, "/api/v1/users/1", "", map[string]string{"If-None-Match": `"v2"`})
+		if rr.Code != http.StatusOK {
+			t.Errorf("Для устаревшего ETag ожидался 200, получено %d", rr.Code)
+		}
+	})
+
+	t.Run("PUT с актуальным If-Match", func(t *testing.T) {
+		reset()
+		rr := do(http.MethodPut, "/api/v1/users/1", `{"name": "New", "email": "v@example.com"}`, map[string]string{"If-Match": `"v3"`})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Неверный статус-код: %d. Тело: %s", rr.Code, rr.Body.String())
+		}
+		if etag := rr.Header().Get("ETag"); etag != `"v4"` {
+			t.Errorf("После обновления ожидался ETag \"v4\", получено %q", etag)
+		}
+	})
+
+	preconditionCases := []struct {
+		method, body, ifMatch string
+		headers               map[string]string
+	}{
+		{method: http.MethodPut, body: `{"name": "New", "email": "v@example.com"}`, ifMatch: `"v2"`},
+		{method: http.MethodPut, body: `{"name": "New", "email": "v@example.com"}`, ifMatch: `W/"v3"`},
+		{method: http.MethodPatch, body: `{"name": "New"}`, ifMatch: `"v2"`, headers: map[string]string{"Content-Type": "application/merge-patch+json"}},
+		{method: http.MethodDelete, ifMatch: `"v1", "v2"`},
+	}
+	for _, tc := range preconditionCases {
+		t.Run(tc.method+" с устаревшим If-Match "+tc.ifMatch, func(t *testing.T) {
+			reset()
+			headers := map[string]string{"If-Match": tc.ifMatch}
+			for k, v := range tc.headers {
+				headers[k] = v
+			}
+			rr := do(tc.method, "/api/v1/users/1", tc.body, headers)
+			if rr.Code != http.StatusPreconditionFailed {
+				t.Errorf("Ожидался 412, получено %d. Тело: %s", rr.Code, rr.Body.String())
+			}
+			if u := mockStorage.Users[1]; u == nil || u.Version != 3 {
+				t.Errorf("Пользователь не должен меняться при невыполненном предусловии: %+v", u)
+			}
+		})
+	}
+
+	t.Run("DELETE с одной из версий в списке If-Match", func(t *testing.T) {
+		reset()
+		rr := do(http.MethodDelete, "/api/v1/users/1", "", map[string]string{"If-Match": `"v2", "v3"`})
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("Ожидался 204, получено %d. Тело: %s", rr.Code, rr.Body.String())
+		}
+	})
+}
+
+// auditLog накапливает события аудита в памяти
+type auditLog []audit.Event
+
+func (l *auditLog) Record(ctx context.Context, e audit.Event) error {
+	*l = append(*l, e)
+	return nil
+}
+
+func TestAuthorization(t *testing.T) {
+	mockStorage := storage.NewMockUserStorage()
+	userHandler := NewUserHandler(mockStorage)
+	events := &auditLog{}
+	userHandler.Audit = events
+
+	operator := &auth.Principal{Kind: auth.KindToken, ID: "ops", Scopes: []string{auth.PermUsersRead}}
+	self := &auth.Principal{Kind: auth.KindToken, ID: "alice", UserID: 1,
+		Scopes: []string{auth.PermUsersRead + auth.SelfSuffix, auth.PermUsersWrite + auth.SelfSuffix}}
+
+	testCases := []struct {
+		name           string
+		principal      *auth.Principal
+		method         string
+		url            string
+		body           string
+		expectedStatus int
+	}{
+		{"Оператор читает список", operator, http.MethodGet, "/api/v1/users", "", http.StatusOK},
+		{"Оператор читает пользователя", operator, http.MethodGet, "/api/v1/users/2", "", http.StatusOK},
+		{"Оператор не может удалить", operator, http.MethodDelete, "/api/v1/users/2", "", http.StatusForbidden},
+		{"Оператор не может создать", operator, http.MethodPost, "/api/v1/users", `{"name":"X","email":"x@example.com"}`, http.StatusForbidden},
+		{"Пользователь изменяет свою запись", self, http.MethodPut, "/api/v1/users/1", `{"name":"Alice","email":"alice@example.com"}`, http.StatusOK},
+		{"Пользователь не может изменить чужую запись", self, http.MethodPut, "/api/v1/users/2", `{"name":"Bob","email":"bob@example.com"}`, http.StatusForbidden},
+		{"Пользователь читает свою запись", self, http.MethodGet, "/api/v1/users/1", "", http.StatusOK},
+		{"Пользователь не видит список", self, http.MethodGet, "/api/v1/users", "", http.StatusForbidden},
+		{"Пользователь не может удалить себя", self, http.MethodDelete, "/api/v1/users/1", "", http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockStorage.Users = map[int64]*models.User{
+				1: {ID: 1, Name: "Alice", Email: "alice@example.com", Version: 1},
+				2: {ID: 2, Name: "Bob", Email: "bob@example.com", Version: 1},
+			}
+			*events = nil
+			req := httptest.NewRequest(tc.method, tc.url, bytes.NewBufferString(tc.body))
+			req = req.WithContext(auth.WithPrincipal(req.Context(), tc.principal))
+			rr := httptest.NewRecorder()
+			serve(userHandler, rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Ожидался статус %d, получено %d. Тело: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedStatus != http.StatusForbidden {
+				if len(*events) != 0 {
+					t.Errorf("Разрешенная операция записана как отказ: %+v", *events)
+				}
+				return
+			}
+			var p problem.Problem
+			if err := json.NewDecoder(rr.Body).Decode(&p); err != nil || p.Code != problem.CodeForbidden {
+				t.Errorf("Ожидался problem с кодом %s, получено %+v (%v)", problem.CodeForbidden, p, err)
+			}
+			if len(*events) != 1 || (*events)[0].Outcome != audit.OutcomeDenied || (*events)[0].Actor != tc.principal.String() {
+				t.Errorf("Отказ не записан в аудит: %+v", *events)
+			}
+			if len(mockStorage.Users) != 2 || mockStorage.Users[2].Name != "Bob" {
+				t.Error("Запрещенная операция изменила хранилище")
+			}
+		})
+	}
+}
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	mockStorage := storage.NewMockUserStorage()
+	userHandler := NewUserHandler(mockStorage)
+	userHandler.Audit = &auditLog{}
+	mockStorage.Users[1] = &models.User{ID: 1, Name: "Alice", Email: "alice@example.com", Version: 1}
+	mockStorage.Users[2] = &models.User{ID: 2, Name: "Bob", Email: "bob@example.com", Version: 1}
+
+	rt := router.New()
+	rt.Resource("/api/v1/users", userHandler.Resource())
+	rt.HandleFunc(http.MethodPost, "/api/v1/users/{id}", userHandler.RestoreRoute())
+	operator := &auth.Principal{Kind: auth.KindToken, ID: "ops", Scopes: []string{auth.PermUsersRead}}
+	do := func(p *auth.Principal, method, url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		req = req.WithContext(auth.WithPrincipal(req.Context(), p))
+		rr := httptest.NewRecorder()
+		rt.ServeHTTP(rr, req)
+		return rr
+	}
+	count := func(rr *httptest.ResponseRecorder) int {
+		var users []models.User
+		if err := json.NewDecoder(rr.Body).Decode(&users); err != nil {
+			t.Fatal(err)
+		}
+		return len(users)
+	}
+
+	if rr := do(admin, http.MethodDelete, "/api/v1/users/1"); rr.Code != http.StatusNoContent {
+		t.Fatalf("Удаление: статус %d. Тело: %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(admin, http.MethodGet, "/api/v1/users/1"); rr.Code != http.StatusNotFound {
+		t.Errorf("Удаленный пользователь не должен находиться: статус %d", rr.Code)
+	}
+	if n := count(do(admin, http.MethodGet, "/api/v1/users")); n != 1 {
+		t.Errorf("В списке %d пользователей, ожидался 1", n)
+	}
+	if n := count(do(admin, http.MethodGet, "/api/v1/users?include_deleted=true")); n != 2 {
+		t.Errorf("С include_deleted в списке %d пользователей, ожидалось 2", n)
+	}
+	if rr := do(admin, http.MethodGet, "/api/v1/users/1?include_deleted=true"); rr.Code != http.StatusOK {
+		t.Errorf("Удаленный пользователь с include_deleted: статус %d", rr.Code)
+	}
+	if rr := do(operator, http.MethodGet, "/api/v1/users?include_deleted=true"); rr.Code != http.StatusForbidden {
+		t.Errorf("include_deleted без права удаления: статус %d", rr.Code)
+	}
+	if rr := do(admin, http.MethodGet, "/api/v1/users?include_deleted=maybe"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Некорректный include_deleted: статус %d", rr.Code)
+	}
+
+	// Адрес удаленного пользователя можно занять, но тогда его нельзя восстановить
+	mockStorage.Users[3] = &models.User{ID: 3, Name: "Alice 2", Email: "alice@example.com", Version: 1}
+	if rr := do(admin, http.MethodPost, "/api/v1/users/1:restore"); rr.Code != http.StatusConflict {
+		t.Errorf("Восстановление с занятым email: статус %d", rr.Code)
+	}
+	delete(mockStorage.Users, 3)
+
+	if rr := do(operator, http.MethodPost, "/api/v1/users/1:restore"); rr.Code != http.StatusForbidden {
+		t.Errorf("Восстановление без права удаления: статус %d", rr.Code)
+	}
+	if rr := do(admin, http.MethodPost, "/api/v1/users/1:undelete"); rr.Code != http.StatusNotFound {
+		t.Errorf("Неизвестное действие: статус %d", rr.Code)
+	}
+	rr := do(admin, http.MethodPost, "/api/v1/users/1:restore")
+	var restored models.User
+	if err := json.NewDecoder(rr.Body).Decode(&restored); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("Восстановление: статус %d (%v)", rr.Code, err)
+	}
+	if restored.DeletedAt != nil || restored.Version != 3 || rr.Header().Get("ETag") != `"v3"` {
+		t.Errorf("Неверный восстановленный пользователь: %+v, ETag %s", restored, rr.Header().Get("ETag"))
+	}
+	if rr := do(admin, http.MethodPost, "/api/v1/users/1:restore"); rr.Code != http.StatusConflict {
+		t.Errorf("Повторное восстановление: статус %d", rr.Code)
+	}
+
+	// Окончательно удаляются только пользователи, удаленные раньше срока
+	do(admin, http.MethodDelete, "/api/v1/users/2")
+	if n, err := mockStorage.PurgeDeletedUsers(context.Background(), time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("Срок хранения не истек, удалено %d (%v)", n, err)
+	}
+	if n, err := mockStorage.PurgeDeletedUsers(context.Background(), time.Now().Add(time.Second)); err != nil || n != 1 {
+		t.Errorf("Ожидалось окончательное удаление одного пользователя, удалено %d (%v)", n, err)
+	}
+	if _, exists := mockStorage.Users[2]; exists {
+		t.Error("Пользователь не удален окончательно")
+	}
+}
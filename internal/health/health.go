@@ -0,0 +1,165 @@
+// Package health реализует пробы /healthz (процесс жив) и /readyz (сервис
+// готов принимать трафик: зависимости доступны, остановка не началась)
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Статусы в ответе проб
+const (
+	StatusOK           = "ok"
+	StatusFail         = "fail"
+	StatusUnavailable  = "unavailable"
+	StatusShuttingDown = "shutting_down"
+)
+
+// CheckFunc проверяет одну зависимость. nil - зависимость в порядке
+type CheckFunc func(ctx context.Context) error
+
+// CheckResult - результат одной проверки в ответе /readyz
+type CheckResult struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Report - тело ответа проб
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Health хранит проверки готовности и признак остановки
+type Health struct {
+	// Timeout ограничивает время всех проверок одного запроса /readyz
+	Timeout time.Duration
+
+	mu           sync.RWMutex
+	checks       map[string]CheckFunc
+	shuttingDown atomic.Bool
+}
+
+func New(timeout time.Duration) *Health {
+	return &Health{Timeout: timeout, checks: make(map[string]CheckFunc)}
+}
+
+// Add регистрирует проверку готовности под именем name
+func (h *Health) Add(name string, check CheckFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// SetShuttingDown переводит /readyz в состояние "не готов" до конца жизни процесса
+func (h *Health) SetShuttingDown() {
+	h.shuttingDown.Store(true)
+}
+
+// Check выполняет все проверки параллельно и возвращает отчет
+func (h *Health) Check(ctx context.Context) Report {
+	if h.shuttingDown.Load() {
+		return Report{Status: StatusShuttingDown}
+	}
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+
+	h.mu.RLock()
+	names := make([]string, 0, len(h.checks))
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]CheckFunc, len(names))
+	for i, name := range names {
+		checks[i] = h.checks[name]
+	}
+	h.mu.RUnlock()
+
+	results := make([]CheckResult, len(names))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check CheckFunc) {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(names))}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+	return report
+}
+
+func run(ctx context.Context, check CheckFunc) CheckResult {
+	start := time.Now()
+	err := check(ctx)
+	res := CheckResult{Status: StatusOK, DurationMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// LivenessHandler отвечает 200, пока процесс способен обрабатывать запросы.
+// Зависимости не проверяются: их недоступность не повод перезапускать процесс
+func (h *Health) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, Report{Status: StatusOK})
+}
+
+// ReadinessHandler отвечает 200, если все проверки прошли, иначе 503
+func (h *Health) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	report := h.Check(r.Context())
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeReport(w, status, report)
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// PingDB проверяет, что PostgreSQL отвечает
+func PingDB(db *sql.DB) CheckFunc {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// PoolSaturation сообщает о проблеме, когда занята доля пула соединений
+// не меньше threshold (0..1). При пуле без ограничения проверка всегда успешна
+func PoolSaturation(db *sql.DB, threshold float64) CheckFunc {
+	return func(ctx context.Context) error {
+		stats := db.Stats()
+		if stats.MaxOpenConnections <= 0 {
+			return nil
+		}
+		if float64(stats.InUse) >= threshold*float64(stats.MaxOpenConnections) {
+			return fmt.Errorf("пул соединений заполнен: занято %d из %d", stats.InUse, stats.MaxOpenConnections)
+		}
+		return nil
+	}
+}
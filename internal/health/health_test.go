@@ -0,0 +1,72 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func readiness(t *testing.T, h *Health) (int, Report) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.ReadinessHandler(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var report Report
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatalf("Ответ не является JSON: %v", err)
+	}
+	return rr.Code, report
+}
+
+func TestReadiness(t *testing.T) {
+	h := New(50 * time.Millisecond)
+	h.Add("ok", func(ctx context.Context) error { return nil })
+
+	code, report := readiness(t, h)
+	if code != http.StatusOK || report.Status != StatusOK || report.Checks["ok"].Status != StatusOK {
+		t.Fatalf("Ожидалась готовность: %d %+v", code, report)
+	}
+
+	h.Add("broken", func(ctx context.Context) error { return errors.New("нет связи") })
+	h.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done() // Зависшая зависимость прерывается общим таймаутом
+		return ctx.Err()
+	})
+	code, report = readiness(t, h)
+	if code != http.StatusServiceUnavailable || report.Status != StatusUnavailable {
+		t.Fatalf("Ожидалось 503 unavailable: %d %+v", code, report)
+	}
+	if r := report.Checks["broken"]; r.Status != StatusFail || r.Error != "нет связи" {
+		t.Errorf("broken: %+v", r)
+	}
+	if r := report.Checks["slow"]; r.Status != StatusFail || r.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("slow: %+v", r)
+	}
+	if r := report.Checks["ok"]; r.Status != StatusOK {
+		t.Errorf("ok: %+v", r)
+	}
+}
+
+func TestShuttingDown(t *testing.T) {
+	called := false
+	h := New(time.Second)
+	h.Add("db", func(ctx context.Context) error { called = true; return nil })
+	h.SetShuttingDown()
+
+	code, report := readiness(t, h)
+	if code != http.StatusServiceUnavailable || report.Status != StatusShuttingDown {
+		t.Errorf("Во время остановки ожидалось 503 shutting_down: %d %+v", code, report)
+	}
+	if called {
+		t.Error("Во время остановки проверки зависимостей не выполняются")
+	}
+
+	rr := httptest.NewRecorder()
+	h.LivenessHandler(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Liveness не зависит от остановки: %d", rr.Code)
+	}
+}
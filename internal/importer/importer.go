@@ -0,0 +1,240 @@
+// Package importer загружает пользователей из CSV и JSON Lines (NDJSON).
+// Файл читается потоково и сохраняется порциями, поэтому его размер не
+// ограничен памятью; итог - отчет с номерами строк пропущенных и ошибочных записей
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/casanera/DlugoshSolutions/internal/models"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+// Форматы файла импорта
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// Значения по умолчанию
+const (
+	DefaultBatchSize = 500
+	// MaxReportRows ограничивает списки строк в отчете; счетчики считают все строки
+	MaxReportRows = 1000
+)
+
+// ErrFormat - файл нельзя разобрать целиком (неизвестный формат, нет нужных
+// колонок, слишком длинная строка). Ошибки отдельных строк попадают в отчет
+var ErrFormat = errors.New("некорректный файл импорта")
+
+// errDryRun откатывает транзакцию пробного импорта
+var errDryRun = errors.New("пробный импорт")
+
+// Options - параметры импорта
+type Options struct {
+	Format      string // FormatCSV или FormatNDJSON
+	Delimiter   rune   // разделитель CSV; 0 - запятая
+	NameColumn  string // колонка CSV или ключ NDJSON с именем; "" - name
+	EmailColumn string // колонка CSV или ключ NDJSON с email; "" - email
+	DryRun      bool   // проверить файл без сохранения
+	BatchSize   int    // пользователей в одной порции; 0 - DefaultBatchSize
+}
+
+// RowError - строка файла, которая не импортирована
+type RowError struct {
+	Line    int    `json:"line"`
+	Email   string `json:"email,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Report - итог импорта
+type Report struct {
+	DryRun  bool `json:"dry_run"`
+	Rows    int  `json:"rows"` // строк с данными, без заголовка и пустых
+	Created int  `json:"created"`
+	Skipped int  `json:"skipped"` // email уже занят или повторяется в файле
+	Invalid int  `json:"invalid"`
+	// Первые MaxReportRows пропущенных и ошибочных строк по возрастанию номера
+	SkippedRows []RowError `json:"skipped_rows"`
+	InvalidRows []RowError `json:"invalid_rows"`
+	Truncated   bool       `json:"truncated"` // списки строк неполные
+}
+
+func (r *Report) skip(e RowError) {
+	r.Skipped++
+	r.SkippedRows, r.Truncated = appendRow(r.SkippedRows, e, r.Truncated)
+}
+
+func (r *Report) invalid(e RowError) {
+	r.Invalid++
+	r.InvalidRows, r.Truncated = appendRow(r.InvalidRows, e, r.Truncated)
+}
+
+func appendRow(rows []RowError, e RowError, truncated bool) ([]RowError, bool) {
+	if len(rows) >= MaxReportRows {
+		return rows, true
+	}
+	return append(rows, e), truncated
+}
+
+// Run читает пользователей из in и создает их порциями по BatchSize. Каждая
+// порция сохраняется в своей транзакции: при ошибке хранилища уже сохраненные
+// порции остаются, а отчет описывает прочитанное до ошибки. Пробный импорт
+// вставляет каждую порцию в транзакции, которая сразу откатывается: так отчет
+// учитывает занятые email, но транзакция не держит блокировки всю загрузку
+func Run(ctx context.Context, store storage.Transactor, in io.Reader, opts Options) (*Report, error) {
+	rows, err := newRowReader(in, opts)
+	if err != nil {
+		return nil, err
+	}
+	im := &importer{rows: rows, batchSize: opts.BatchSize, report: &Report{DryRun: opts.DryRun}}
+	if im.batchSize <= 0 {
+		im.batchSize = DefaultBatchSize
+	}
+	if opts.DryRun {
+		// Откаченные порции не видят друг друга: повторы email между ними ищет импорт
+		im.seen = make(map[string]struct{})
+	}
+
+	// Порция прочитана до WithTx, поэтому транзакцию можно повторить после
+	// ошибки сериализации: поток файла при этом не перечитывается
+	err = im.run(ctx, func(ctx context.Context, users []*models.User) error {
+		err := store.WithTx(ctx, storage.TxOptions{}, func(tx storage.Store) error {
+			for _, u := range users {
+				u.ID, u.Version = 0, 0 // итоги прошлой попытки откачены
+			}
+			if err := tx.Users().CreateUsers(ctx, users); err != nil {
+				return err
+			}
+			if opts.DryRun {
+				return errDryRun
+			}
+			return nil
+		})
+		if errors.Is(err, errDryRun) {
+			err = nil
+		}
+		return err
+	})
+	return im.report, err
+}
+
+// ParseDelimiter разбирает разделитель CSV: один символ или tab; "" - запятая
+func ParseDelimiter(s string) (rune, error) {
+	switch {
+	case s == "":
+		return ',', nil
+	case s == "tab" || s == `\t`:
+		return '\t', nil
+	case utf8.RuneCountInString(s) == 1 && s != `"` && s != "\r" && s != "\n" && s != utf8BOM:
+		r, _ := utf8.DecodeRuneInString(s)
+		return r, nil
+	}
+	return 0, fmt.Errorf("разделитель %q: ожидается один символ или tab", s)
+}
+
+// row - запись файла с номером строки, на которой она начинается
+type row struct {
+	line        int
+	name, email string
+	err         *RowError // строку не удалось разобрать
+}
+
+type rowReader interface {
+	// next возвращает следующую запись или io.EOF
+	next() (row, error)
+}
+
+func newRowReader(in io.Reader, opts Options) (rowReader, error) {
+	name, email := opts.NameColumn, opts.EmailColumn
+	if name == "" {
+		name = "name"
+	}
+	if email == "" {
+		email = "email"
+	}
+	switch opts.Format {
+	case FormatCSV:
+		delimiter := opts.Delimiter
+		if delimiter == 0 {
+			delimiter = ','
+		}
+		return newCSVReader(in, delimiter, name, email)
+	case FormatNDJSON:
+		return newNDJSONReader(in, name, email), nil
+	default:
+		return nil, fmt.Errorf("%w: неизвестный формат %q, ожидается %s или %s", ErrFormat, opts.Format, FormatCSV, FormatNDJSON)
+	}
+}
+
+type importer struct {
+	rows      rowReader
+	batchSize int
+	report    *Report
+
+	pending []*models.User
+	lines   []int               // номера строк pending
+	seen    map[string]struct{} // email созданных строк при пробном импорте
+}
+
+// run читает записи, проверяет их и передает порции в create
+func (im *importer) run(ctx context.Context, create func(ctx context.Context, users []*models.User) error) error {
+	for {
+		r, err := im.rows.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		im.report.Rows++
+		if r.err != nil {
+			im.report.invalid(*r.err)
+			continue
+		}
+		user := &models.User{Name: r.name, Email: r.email}
+		var validationErr *storage.ValidationError
+		if errors.As(storage.ValidateUser(user), &validationErr) {
+			im.report.invalid(RowError{Line: r.line, Email: r.email, Field: validationErr.Field, Message: validationErr.Message})
+			continue
+		}
+		im.pending = append(im.pending, user)
+		im.lines = append(im.lines, r.line)
+		if len(im.pending) >= im.batchSize {
+			if err := im.flush(ctx, create); err != nil {
+				return err
+			}
+		}
+	}
+	return im.flush(ctx, create)
+}
+
+// flush сохраняет накопленную порцию. Пользователь без ID не создан: его email занят
+func (im *importer) flush(ctx context.Context, create func(ctx context.Context, users []*models.User) error) error {
+	if len(im.pending) == 0 {
+		return nil
+	}
+	if err := create(ctx, im.pending); err != nil {
+		return err
+	}
+	for i, u := range im.pending {
+		if im.seen != nil && u.ID != 0 {
+			if _, dup := im.seen[u.Email]; dup {
+				u.ID = 0
+			}
+			im.seen[u.Email] = struct{}{}
+		}
+		if u.ID == 0 {
+			im.report.skip(RowError{Line: im.lines[i], Email: u.Email, Field: "email", Message: "уже используется другим пользователем"})
+		} else {
+			im.report.Created++
+		}
+	}
+	im.pending, im.lines = im.pending[:0], im.lines[:0]
+	return nil
+}
@@ -0,0 +1,231 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/casanera/DlugoshSolutions/internal/models"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+func newTestStore() *storage.MockStore {
+	store := storage.NewMockStore()
+	store.Users.Users[1] = &models.User{ID: 1, Name: "Alice", Email: "alice@example.com", Version: 1}
+	store.Users.NextID = 2
+	return store
+}
+
+// rows описывает строки отчета в виде "строка:поле"
+func rows(list []RowError) string {
+	var s []string
+	for _, r := range list {
+		s = append(s, fmt.Sprintf("%d:%s", r.Line, r.Field))
+	}
+	return strings.Join(s, " ")
+}
+
+func TestRun(t *testing.T) {
+	testCases := []struct {
+		name            string
+		opts            Options
+		file            string
+		expectedRows    int
+		expectedCreated int
+		expectedSkipped string
+		expectedInvalid string
+	}{
+		{
+			name: "CSV",
+			opts: Options{Format: FormatCSV},
+			file: "\ufeffName, EMAIL\n" +
+				"Bob,bob@example.com\n" +
+				"\"Smith, Carol\",carol@example.com\n" +
+				"\n" +
+				"Dan\n" +
+				"\"Eve\n\",eve@example.com\n" +
+				"Fay,fay@\"x\n" +
+				"Gus,gus@example.com,лишняя колонка\n",
+			expectedRows:    6,
+			expectedCreated: 4,
+			expectedInvalid: "5: 8:",
+		},
+		{
+			name: "CSV с разделителем и своими колонками",
+			opts: Options{Format: FormatCSV, Delimiter: '\t', NameColumn: "ФИО", EmailColumn: "Почта"},
+			file: "Почта\tФИО\n" +
+				"bob@example.com\tBob\n" +
+				"alice@example.com\tAlice 2\n" +
+				"\tБез почты\n" +
+				"bob@example.com\tBob 2\n",
+			expectedRows:    4,
+			expectedCreated: 1,
+			expectedSkipped: "3:email 5:email",
+			expectedInvalid: "4:email",
+		},
+		{
+			name: "NDJSON",
+			opts: Options{Format: FormatNDJSON},
+			file: `{"name":"Bob","email":"bob@example.com","role":"ignored"}` + "\n" +
+				"\n" +
+				`{"name":"","email":"x@example.com"}` + "\n" +
+				`{"name":"Carol","email":["carol@example.com"]}` + "\n" +
+				`[1, 2]` + "\n" +
+				`{"name":"Dan","email":"dan@example.com"}`,
+			expectedRows:    5,
+			expectedCreated: 2,
+			expectedInvalid: "3:name 4:email 5:",
+		},
+		{
+			name: "Порции по две строки",
+			opts: Options{Format: FormatCSV, BatchSize: 2},
+			file: "name,email\n" +
+				"A,a@example.com\nB,b@example.com\n" +
+				"C,a@example.com\nAlice,alice@example.com\n" +
+				"D,d@example.com\n",
+			expectedRows:    5,
+			expectedCreated: 3,
+			expectedSkipped: "4:email 5:email",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newTestStore()
+			report, err := Run(context.Background(), store, strings.NewReader(tc.file), tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Rows != tc.expectedRows || report.Created != tc.expectedCreated {
+				t.Errorf("Строк %d, создано %d; ожидалось %d и %d", report.Rows, report.Created, tc.expectedRows, tc.expectedCreated)
+			}
+			if got := rows(report.SkippedRows); got != tc.expectedSkipped || report.Skipped != len(report.SkippedRows) {
+				t.Errorf("Пропущены %q, ожидались %q", got, tc.expectedSkipped)
+			}
+			if got := rows(report.InvalidRows); got != tc.expectedInvalid || report.Invalid != len(report.InvalidRows) {
+				t.Errorf("Ошибочные %q, ожидались %q", got, tc.expectedInvalid)
+			}
+			if len(store.Users.Users) != 1+tc.expectedCreated {
+				t.Errorf("В хранилище %d пользователей, ожидалось %d", len(store.Users.Users), 1+tc.expectedCreated)
+			}
+		})
+	}
+}
+
+func TestRunBatches(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("name,email\n")
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(&b, "User %d,u%d@example.com\n", i, i)
+	}
+	b.WriteString("Dup,u0@example.com\n")
+	file := b.String()
+
+	t.Run("Каждая порция - своя транзакция", func(t *testing.T) {
+		store := newTestStore()
+		report, err := Run(context.Background(), store, strings.NewReader(file), Options{Format: FormatCSV, BatchSize: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if store.Calls != 3 || report.Created != 5 || rows(report.SkippedRows) != "7:email" {
+			t.Errorf("Транзакций %d, отчет %+v", store.Calls, report)
+		}
+	})
+
+	t.Run("Повтор после ошибки сериализации не теряет строки", func(t *testing.T) {
+		store := newTestStore()
+		store.SerializationFailures = 2
+		report, err := Run(context.Background(), store, strings.NewReader(file), Options{Format: FormatCSV, BatchSize: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if store.Calls != 5 || report.Created != 5 || report.Skipped != 1 || len(store.Users.Users) != 6 {
+			t.Errorf("Вызовов %d, пользователей %d, отчет %+v", store.Calls, len(store.Users.Users), report)
+		}
+	})
+
+	t.Run("Пробный импорт ничего не сохраняет", func(t *testing.T) {
+		store := newTestStore()
+		report, err := Run(context.Background(), store, strings.NewReader(file+"Alice,alice@example.com\n"),
+			Options{Format: FormatCSV, BatchSize: 2, DryRun: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Повтор u0 - в другой порции: его находит импорт, а не хранилище
+		if !report.DryRun || report.Created != 5 || rows(report.SkippedRows) != "7:email 8:email" {
+			t.Errorf("Отчет %+v", report)
+		}
+		if len(store.Users.Users) != 1 || len(store.Audit.Events) != 0 || store.Calls != 4 {
+			t.Errorf("Пользователей %d, событий %d, транзакций %d", len(store.Users.Users), len(store.Audit.Events), store.Calls)
+		}
+	})
+
+	t.Run("Ошибка хранилища сохраняет прежние порции", func(t *testing.T) {
+		store := newTestStore()
+		store.SerializationFailures = DefaultBatchSize // больше любых повторов
+		_, err := Run(context.Background(), store, strings.NewReader(file), Options{Format: FormatCSV, BatchSize: 2})
+		if !errors.Is(err, storage.ErrSerialization) || len(store.Users.Users) != 1 {
+			t.Errorf("Ошибка %v, пользователей %d", err, len(store.Users.Users))
+		}
+	})
+}
+
+func TestRunFormatErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts Options
+		file string
+	}{
+		{"Неизвестный формат", Options{Format: "xml"}, "<users/>"},
+		{"Пустой CSV", Options{Format: FormatCSV}, ""},
+		{"Нет колонки", Options{Format: FormatCSV}, "name;email\nA;a@example.com\n"},
+		{"Длинная строка NDJSON", Options{Format: FormatNDJSON}, `{"name":"` + strings.Repeat("x", maxLineSize) + `"}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newTestStore()
+			if _, err := Run(context.Background(), store, strings.NewReader(tc.file), tc.opts); !errors.Is(err, ErrFormat) {
+				t.Errorf("Ошибка %v, ожидалась ErrFormat", err)
+			}
+		})
+	}
+}
+
+func TestReportTruncated(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("name,email\n")
+	for i := 0; i < MaxReportRows+5; i++ {
+		b.WriteString(",x@example.com\n")
+	}
+	report, err := Run(context.Background(), newTestStore(), strings.NewReader(b.String()), Options{Format: FormatCSV})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Invalid != MaxReportRows+5 || len(report.InvalidRows) != MaxReportRows || !report.Truncated {
+		t.Errorf("Ошибочных %d, в списке %d, truncated %v", report.Invalid, len(report.InvalidRows), report.Truncated)
+	}
+}
+
+func TestParseDelimiter(t *testing.T) {
+	testCases := []struct {
+		in       string
+		expected rune
+		ok       bool
+	}{
+		{"", ',', true},
+		{";", ';', true},
+		{"tab", '\t', true},
+		{`\t`, '\t', true},
+		{"|", '|', true},
+		{";;", 0, false},
+		{`"`, 0, false},
+		{"\n", 0, false},
+	}
+	for _, tc := range testCases {
+		got, err := ParseDelimiter(tc.in)
+		if got != tc.expected || (err == nil) != tc.ok {
+			t.Errorf("ParseDelimiter(%q) = %q, %v", tc.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxLineSize ограничивает строку NDJSON: более длинная строка - не пользователь
+const maxLineSize = 64 << 10
+
+// utf8BOM - метка порядка байтов, с которой Excel сохраняет CSV в UTF-8
+const utf8BOM = "\ufeff"
+
+type csvReader struct {
+	r                 *csv.Reader
+	nameCol, emailCol int
+}
+
+// newCSVReader читает заголовок и находит в нем колонки с именем и email
+// (без учета регистра и пробелов по краям)
+func newCSVReader(in io.Reader, delimiter rune, name, email string) (*csvReader, error) {
+	r := csv.NewReader(in)
+	r.Comma = delimiter
+	r.FieldsPerRecord = -1 // число колонок проверяется по заголовку для каждой строки
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: файл пуст, ожидается строка заголовка", ErrFormat)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: заголовок: %v", ErrFormat, err)
+	}
+	c := &csvReader{r: r, nameCol: -1, emailCol: -1}
+	for i, h := range header {
+		h = strings.TrimSpace(strings.TrimPrefix(h, utf8BOM))
+		switch {
+		case strings.EqualFold(h, name):
+			c.nameCol = i
+		case strings.EqualFold(h, email):
+			c.emailCol = i
+		}
+	}
+	var missing []string
+	if c.nameCol < 0 {
+		missing = append(missing, name)
+	}
+	if c.emailCol < 0 {
+		missing = append(missing, email)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: в заголовке нет колонок %s (разделитель %q)", ErrFormat, strings.Join(missing, ", "), delimiter)
+	}
+	return c, nil
+}
+
+func (c *csvReader) next() (row, error) {
+	for {
+		record, err := c.r.Read()
+		var parseErr *csv.ParseError
+		switch {
+		case errors.Is(err, io.EOF):
+			return row{}, io.EOF
+		case errors.As(err, &parseErr):
+			// Читатель CSV продолжает со следующей записи
+			return row{line: parseErr.StartLine, err: &RowError{Line: parseErr.StartLine, Message: parseErr.Err.Error()}}, nil
+		case err != nil:
+			return row{}, err
+		}
+		line, _ := c.r.FieldPos(0)
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue // пустая строка
+		}
+		if len(record) <= max(c.nameCol, c.emailCol) {
+			return row{line: line, err: &RowError{Line: line,
+				Message: fmt.Sprintf("в строке %d колонок, а в заголовке больше", len(record))}}, nil
+		}
+		return row{line: line, name: strings.TrimSpace(record[c.nameCol]), email: strings.TrimSpace(record[c.emailCol])}, nil
+	}
+}
+
+type ndjsonReader struct {
+	s           *bufio.Scanner
+	line        int
+	name, email string
+}
+
+func newNDJSONReader(in io.Reader, name, email string) *ndjsonReader {
+	s := bufio.NewScanner(in)
+	s.Buffer(make([]byte, 0, 4<<10), maxLineSize)
+	return &ndjsonReader{s: s, name: name, email: email}
+}
+
+func (n *ndjsonReader) next() (row, error) {
+	for n.s.Scan() {
+		n.line++
+		data := bytes.TrimSpace(n.s.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return row{line: n.line, err: &RowError{Line: n.line, Message: "некорректный JSON: " + err.Error()}}, nil
+		}
+		r := row{line: n.line}
+		for _, f := range []struct {
+			key string
+			dst *string
+		}{{n.name, &r.name}, {n.email, &r.email}} {
+			raw, ok := obj[f.key]
+			if !ok {
+				continue // пустое значение отклонит проверка пользователя
+			}
+			if err := json.Unmarshal(raw, f.dst); err != nil {
+				return row{line: n.line, err: &RowError{Line: n.line, Field: f.key, Message: "ожидается строка"}}, nil
+			}
+			*f.dst = strings.TrimSpace(*f.dst)
+		}
+		return r, nil
+	}
+	if err := n.s.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return row{}, fmt.Errorf("%w: строка %d длиннее %d байт", ErrFormat, n.line+1, maxLineSize)
+		}
+		return row{}, err
+	}
+	return row{}, io.EOF
+}
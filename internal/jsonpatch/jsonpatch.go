@@ -0,0 +1,312 @@
+// Package jsonpatch применяет изменения к JSON-документам в форматах
+// JSON Merge Patch (RFC 7396) и JSON Patch (RFC 6902)
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// MIME-типы тел запросов PATCH
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// ErrTestFailed возвращается, если операция test в JSON Patch не прошла
+var ErrTestFailed = errors.New("jsonpatch: операция test не выполнена")
+
+// MergePatch применяет JSON Merge Patch к документу: объекты сливаются
+// рекурсивно, null удаляет ключ, любое другое значение заменяет исходное
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p any
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, fmt.Errorf("jsonpatch: исходный документ: %w", err)
+	}
+	if err := decode(patch, &p); err != nil {
+		return nil, fmt.Errorf("jsonpatch: merge patch: %w", err)
+	}
+	return json.Marshal(mergeValue(target, p))
+}
+
+func mergeValue(target, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = make(map[string]any)
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+			continue
+		}
+		targetObj[k] = mergeValue(targetObj[k], v)
+	}
+	return targetObj
+}
+
+// Operation - одна операция JSON Patch
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Apply применяет последовательность операций JSON Patch к документу.
+// Операции выполняются атомарно: при ошибке исходный документ не меняется
+func Apply(doc, patch []byte) ([]byte, error) {
+	var ops []Operation
+	if err := decode(patch, &ops); err != nil {
+		return nil, fmt.Errorf("jsonpatch: json patch должен быть массивом операций: %w", err)
+	}
+	var root any
+	if err := json.Unmarshal(doc, &root); err != nil {
+		return nil, fmt.Errorf("jsonpatch: исходный документ: %w", err)
+	}
+	for i, op := range ops {
+		var err error
+		root, err = applyOp(root, op)
+		if err != nil {
+			return nil, fmt.Errorf("jsonpatch: операция %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(root)
+}
+
+func applyOp(root any, op Operation) (any, error) {
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.New("не задано поле value")
+		}
+		var value any
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+		switch op.Op {
+		case "add":
+			return add(root, op.Path, value)
+		case "replace":
+			if _, err := get(root, op.Path); err != nil {
+				return nil, err
+			}
+			root, err := remove(root, op.Path)
+			if err != nil {
+				return nil, err
+			}
+			return add(root, op.Path, value)
+		default:
+			current, err := get(root, op.Path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, ErrTestFailed
+			}
+			return root, nil
+		}
+	case "remove":
+		return remove(root, op.Path)
+	case "move", "copy":
+		value, err := get(root, op.From)
+		if err != nil {
+			return nil, fmt.Errorf("from: %w", err)
+		}
+		if op.Op == "move" {
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, errors.New("нельзя переместить значение внутрь самого себя")
+			}
+			if root, err = remove(root, op.From); err != nil {
+				return nil, err
+			}
+		} else {
+			value = deepCopy(value)
+		}
+		return add(root, op.Path, value)
+	}
+	return nil, fmt.Errorf("неизвестная операция %q", op.Op)
+}
+
+// parsePointer разбирает JSON Pointer (RFC 6901) на токены
+func parsePointer(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("указатель %q должен начинаться с /", path)
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+func get(root any, path string) (any, error) {
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+	cur := root
+	for _, t := range tokens {
+		switch node := cur.(type) {
+		case map[string]any:
+			v, ok := node[t]
+			if !ok {
+				return nil, fmt.Errorf("путь %q не существует", path)
+			}
+			cur = v
+		case []any:
+			i, err := arrayIndex(t, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			cur = node[i]
+		default:
+			return nil, fmt.Errorf("путь %q не существует", path)
+		}
+	}
+	return cur, nil
+}
+
+// parent возвращает контейнер, в котором находится последний токен пути
+func parent(root any, path string) (any, string, error) {
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(tokens) == 0 {
+		return nil, "", nil
+	}
+	// Символ / внутри токенов всегда экранирован как ~1, поэтому последний / - разделитель
+	container, err := get(root, path[:strings.LastIndex(path, "/")])
+	if err != nil {
+		return nil, "", err
+	}
+	return container, tokens[len(tokens)-1], nil
+}
+
+func add(root any, path string, value any) (any, error) {
+	if path == "" {
+		return value, nil
+	}
+	container, key, err := parent(root, path)
+	if err != nil {
+		return nil, err
+	}
+	switch node := container.(type) {
+	case map[string]any:
+		node[key] = value
+		return root, nil
+	case []any:
+		idx := len(node)
+		if key != "-" {
+			if idx, err = arrayIndex(key, len(node)); err != nil {
+				return nil, err
+			}
+		}
+		updated := append(node[:idx:idx], append([]any{value}, node[idx:]...)...)
+		return setContainer(root, path, updated)
+	}
+	return nil, fmt.Errorf("путь %q не указывает на объект или массив", path)
+}
+
+func remove(root any, path string) (any, error) {
+	if path == "" {
+		return nil, errors.New("нельзя удалить корень документа")
+	}
+	container, key, err := parent(root, path)
+	if err != nil {
+		return nil, err
+	}
+	switch node := container.(type) {
+	case map[string]any:
+		if _, ok := node[key]; !ok {
+			return nil, fmt.Errorf("путь %q не существует", path)
+		}
+		delete(node, key)
+		return root, nil
+	case []any:
+		idx, err := arrayIndex(key, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		updated := append(node[:idx:idx], node[idx+1:]...)
+		return setContainer(root, path, updated)
+	}
+	return nil, fmt.Errorf("путь %q не существует", path)
+}
+
+// setContainer заменяет массив, содержащий элемент path, на обновленный.
+// Нужен потому, что изменение длины среза не видно через родительский контейнер
+func setContainer(root any, path string, updated []any) (any, error) {
+	parentPath := path[:strings.LastIndex(path, "/")]
+	if parentPath == "" {
+		return updated, nil
+	}
+	container, key, err := parent(root, parentPath)
+	if err != nil {
+		return nil, err
+	}
+	switch node := container.(type) {
+	case map[string]any:
+		node[key] = updated
+	case []any:
+		idx, err := arrayIndex(key, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		node[idx] = updated
+	}
+	return root, nil
+}
+
+func arrayIndex(token string, maxIndex int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("некорректный индекс массива %q", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > maxIndex {
+		return 0, fmt.Errorf("индекс массива %q вне диапазона", token)
+	}
+	return i, nil
+}
+
+func deepCopy(v any) any {
+	switch node := v.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(node))
+		for k, val := range node {
+			c[k] = deepCopy(val)
+		}
+		return c
+	case []any:
+		c := make([]any, len(node))
+		for i, val := range node {
+			c[i] = deepCopy(val)
+		}
+		return c
+	}
+	return v
+}
+
+// decode разбирает JSON и отклоняет данные после первого значения
+func decode(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("лишние данные после JSON-значения")
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// jsonEqual сравнивает документы без учета порядка ключей
+func jsonEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("Некорректный JSON результата: %v", err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("Некорректный ожидаемый JSON: %v", err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("Получено %s, ожидалось %s", got, want)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	// Примеры из приложения A RFC 7396
+	testCases := []struct {
+		doc, patch, expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tc := range testCases {
+		got, err := MergePatch([]byte(tc.doc), []byte(tc.patch))
+		if err != nil {
+			t.Fatalf("MergePatch(%s, %s): %v", tc.doc, tc.patch, err)
+		}
+		jsonEqual(t, got, tc.expected)
+	}
+}
+
+func TestApply(t *testing.T) {
+	// Примеры из приложения A RFC 6902
+	testCases := []struct {
+		name, doc, patch, expected string
+	}{
+		{"add в объект", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{"add в массив", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"add в конец массива", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{"remove из объекта", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{"remove из массива", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{"move", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{"copy", `{"foo":"bar"}`, `[{"op":"copy","from":"/foo","path":"/baz"}]`, `{"foo":"bar","baz":"bar"}`},
+		{"test и replace", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"replace","path":"/baz","value":"x"}]`, `{"baz":"x"}`},
+		{"экранирование в указателе", `{"a/b":1,"m~n":2}`, `[{"op":"replace","path":"/a~1b","value":3},{"op":"remove","path":"/m~0n"}]`, `{"a/b":3}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Apply([]byte(tc.doc), []byte(tc.patch))
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			jsonEqual(t, got, tc.expected)
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	testCases := []struct {
+		name, doc, patch string
+	}{
+		{"test не прошел", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`},
+		{"remove несуществующего", `{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`},
+		{"replace несуществующего", `{"foo":"bar"}`, `[{"op":"replace","path":"/baz","value":1}]`},
+		{"add в несуществующий объект", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`},
+		{"индекс вне массива", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/5","value":1}]`},
+		{"неизвестная операция", `{}`, `[{"op":"frobnicate","path":"/a"}]`},
+		{"не массив", `{}`, `{"op":"add","path":"/a","value":1}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Apply([]byte(tc.doc), []byte(tc.patch)); err == nil {
+				t.Errorf("Ожидалась ошибка для %s", tc.patch)
+			}
+		})
+	}
+
+	_, err := Apply([]byte(`{"a":1}`), []byte(`[{"op":"test","path":"/a","value":2}]`))
+	if !errors.Is(err, ErrTestFailed) {
+		t.Errorf("Ожидалась ErrTestFailed, получено %v", err)
+	}
+}
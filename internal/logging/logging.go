@@ -0,0 +1,64 @@
+// Package logging настраивает структурированный журнал на log/slog
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/casanera/DlugoshSolutions/internal/reqctx"
+)
+
+// Форматы вывода журнала
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// New создает логгер с уровнем level (debug, info, warn, error) и форматом
+// format (text или json). Записи, сделанные с контекстом запроса, получают
+// атрибут request_id
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("logging: неизвестный уровень %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var h slog.Handler
+	switch format {
+	case FormatText:
+		h = slog.NewTextHandler(w, opts)
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("logging: неизвестный формат %q (ожидается %s или %s)", format, FormatText, FormatJSON)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+// contextHandler дополняет запись данными из контекста
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := reqctx.RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Err - атрибут с ошибкой под единым ключом err
+func Err(err error) slog.Attr {
+	return slog.Any("err", err)
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/casanera/DlugoshSolutions/internal/reqctx"
+)
+
+func TestNewJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := reqctx.WithRequestID(context.Background(), "req-42")
+	logger.DebugContext(ctx, "не должно попасть в журнал")
+	logger.With("component", "test").InfoContext(ctx, "пользователь получен", "user_id", 7, Err(errors.New("boom")))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Ожидалась одна запись (debug отфильтрован), получено %d:\n%s", len(lines), buf.String())
+	}
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatalf("Запись не является JSON: %v", err)
+	}
+	expected := map[string]any{
+		"level":      "INFO",
+		"msg":        "пользователь получен",
+		"request_id": "req-42",
+		"component":  "test",
+		"user_id":    float64(7),
+		"err":        "boom",
+	}
+	for k, v := range expected {
+		if rec[k] != v {
+			t.Errorf("%s = %v, ожидалось %v", k, rec[k], v)
+		}
+	}
+}
+
+func TestNewText(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "debug", FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("запуск", "port", 8080)
+	if out := buf.String(); !strings.Contains(out, "level=DEBUG") || !strings.Contains(out, "port=8080") {
+		t.Errorf("Неожиданная запись: %s", out)
+	}
+	if strings.Contains(buf.String(), "request_id") {
+		t.Errorf("Без контекста запроса request_id не добавляется: %s", buf.String())
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "verbose", FormatText); err == nil {
+		t.Error("Ожидалась ошибка для неизвестного уровня")
+	}
+	if _, err := New(&bytes.Buffer{}, "info", "xml"); err == nil {
+		t.Error("Ожидалась ошибка для неизвестного формата")
+	}
+}
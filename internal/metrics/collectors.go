@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"database/sql"
+	"time"
+)
+
+// HTTPMetrics - метрики HTTP-запросов, заполняются middleware.Metrics
+type HTTPMetrics struct {
+	Requests *CounterVec   // http_requests_total{method,route,status}
+	Duration *HistogramVec // http_request_duration_seconds{method,route}
+}
+
+func NewHTTPMetrics(reg *Registry) *HTTPMetrics {
+	return &HTTPMetrics{
+		Requests: reg.NewCounterVec("http_requests_total",
+			"Количество обработанных HTTP-запросов.", "method", "route", "status"),
+		Duration: reg.NewHistogramVec("http_request_duration_seconds",
+			"Время обработки HTTP-запроса в секундах.", DefBuckets, "method", "route"),
+	}
+}
+
+// RegisterDBStats публикует статистику пула соединений sql.DB.
+// Значения читаются из db.Stats() в момент выгрузки
+func RegisterDBStats(reg *Registry, db *sql.DB) {
+	stat := func(f func(s sql.DBStats) float64) func() float64 {
+		return func() float64 { return f(db.Stats()) }
+	}
+	reg.NewGaugeFunc("db_max_open_connections", "Максимальное число открытых соединений с БД.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	reg.NewGaugeFunc("db_open_connections", "Открытые соединения с БД (используемые и простаивающие).",
+		stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	reg.NewGaugeFunc("db_in_use_connections", "Соединения с БД, занятые запросами.",
+		stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	reg.NewGaugeFunc("db_idle_connections", "Простаивающие соединения с БД.",
+		stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	reg.NewCounterFunc("db_wait_count_total", "Сколько раз запрос ждал свободного соединения.",
+		stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	reg.NewCounterFunc("db_wait_duration_seconds_total", "Суммарное время ожидания свободного соединения в секундах.",
+		stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	reg.NewCounterFunc("db_max_idle_closed_total", "Соединения, закрытые из-за лимита простаивающих.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+	reg.NewCounterFunc("db_max_idle_time_closed_total", "Соединения, закрытые из-за превышения времени простоя.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }))
+	reg.NewCounterFunc("db_max_lifetime_closed_total", "Соединения, закрытые из-за превышения времени жизни.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }))
+}
+
+// StorageMetrics - длительность операций хранилища пользователей.
+// Реализует storage.Observer
+type StorageMetrics struct {
+	Duration *HistogramVec // storage_operation_duration_seconds{method,result}
+}
+
+func NewStorageMetrics(reg *Registry) *StorageMetrics {
+	return &StorageMetrics{
+		Duration: reg.NewHistogramVec("storage_operation_duration_seconds",
+			"Время выполнения операции UserStorage в секундах.", DefBuckets, "method", "result"),
+	}
+}
+
+func (m *StorageMetrics) ObserveOp(op string, d time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.Duration.With(op, result).Observe(d.Seconds())
+}
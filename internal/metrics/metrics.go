@@ -0,0 +1,297 @@
+// Package metrics - минимальная реализация метрик в текстовом формате
+// Prometheus (exposition format 0.0.4) без внешних зависимостей
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType - тип ответа эндпоинта /metrics
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets - границы гистограмм длительности по умолчанию, в секундах
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector пишет HELP, TYPE и значения одной метрики
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry хранит зарегистрированные метрики и отдает их в формате Prometheus
+type Registry struct {
+	mu         sync.Mutex
+	names      map[string]bool
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (reg *Registry) register(name string, c collector) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.names[name] {
+		panic("metrics: метрика " + name + " уже зарегистрирована")
+	}
+	reg.names[name] = true
+	reg.collectors = append(reg.collectors, c)
+}
+
+// Write пишет все метрики в порядке регистрации
+func (reg *Registry) Write(w io.Writer) error {
+	reg.mu.Lock()
+	collectors := append([]collector(nil), reg.collectors...)
+	reg.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler отдает метрики по HTTP
+func (reg *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		reg.Write(w)
+	})
+}
+
+// vec - общая часть метрик с метками: значения по наборам меток
+type vec[T any] struct {
+	name, help, typ string
+	labels          []string
+	newValue        func() T
+
+	mu     sync.Mutex
+	values map[string]T // ключ - отформатированные метки {a="1",b="2"}
+}
+
+func (v *vec[T]) with(values []string) T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s: ожидается %d значений меток, передано %d", v.name, len(v.labels), len(values)))
+	}
+	key := formatLabels(v.labels, values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	val, ok := v.values[key]
+	if !ok {
+		val = v.newValue()
+		v.values[key] = val
+	}
+	return val
+}
+
+// sorted возвращает наборы меток в детерминированном порядке
+func (v *vec[T]) sorted() ([]string, []T) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	vals := make([]T, len(keys))
+	for i, k := range keys {
+		vals[i] = v.values[k]
+	}
+	return keys, vals
+}
+
+func (v *vec[T]) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.typ)
+}
+
+// Counter - монотонно растущий счетчик
+type Counter struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (c *Counter) Inc() { c.Add(1) }
+
+// Add увеличивает счетчик; отрицательные значения игнорируются
+func (c *Counter) Add(d float64) {
+	if d < 0 {
+		return
+	}
+	c.mu.Lock()
+	c.v += d
+	c.mu.Unlock()
+}
+
+func (c *Counter) value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.v
+}
+
+// CounterVec - счетчики с метками
+type CounterVec struct {
+	vec[*Counter]
+}
+
+func (reg *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	cv := &CounterVec{vec[*Counter]{
+		name: name, help: help, typ: "counter", labels: labels,
+		newValue: func() *Counter { return &Counter{} },
+		values:   make(map[string]*Counter),
+	}}
+	reg.register(name, cv)
+	return cv
+}
+
+// With возвращает счетчик для значений меток (в порядке объявления меток)
+func (cv *CounterVec) With(values ...string) *Counter {
+	return cv.with(values)
+}
+
+func (cv *CounterVec) write(w *bufio.Writer) {
+	cv.writeHeader(w)
+	keys, vals := cv.sorted()
+	for i, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", cv.name, k, formatFloat(vals[i].value()))
+	}
+}
+
+// Histogram считает наблюдения по корзинам
+type Histogram struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64 // counts[i] - наблюдения <= buckets[i] (не накопительно)
+	count  uint64
+	sum    float64
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mu.Lock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+	h.mu.Unlock()
+}
+
+// HistogramVec - гистограммы с метками
+type HistogramVec struct {
+	vec[*Histogram]
+	buckets []float64
+}
+
+func (reg *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	hv := &HistogramVec{buckets: buckets}
+	hv.vec = vec[*Histogram]{
+		name: name, help: help, typ: "histogram", labels: labels,
+		newValue: func() *Histogram {
+			return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+		},
+		values: make(map[string]*Histogram),
+	}
+	reg.register(name, hv)
+	return hv
+}
+
+// With возвращает гистограмму для значений меток (в порядке объявления меток)
+func (hv *HistogramVec) With(values ...string) *Histogram {
+	return hv.with(values)
+}
+
+func (hv *HistogramVec) write(w *bufio.Writer) {
+	hv.writeHeader(w)
+	keys, vals := hv.sorted()
+	for i, k := range keys {
+		h := vals[i]
+		h.mu.Lock()
+		var cumulative uint64
+		for j, upper := range h.buckets {
+			cumulative += h.counts[j]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", hv.name, withLabel(k, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", hv.name, withLabel(k, "le", "+Inf"), h.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", hv.name, k, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", hv.name, k, h.count)
+		h.mu.Unlock()
+	}
+}
+
+// funcMetric - значение без меток, которое вычисляется в момент выгрузки
+type funcMetric struct {
+	name, help, typ string
+	fn              func() float64
+}
+
+func (f *funcMetric) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", f.name, escapeHelp(f.help), f.name, f.typ, f.name, formatFloat(f.fn()))
+}
+
+// NewGaugeFunc регистрирует метрику-значение, которое читается через fn при каждой выгрузке
+func (reg *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	reg.register(name, &funcMetric{name: name, help: help, typ: "gauge", fn: fn})
+}
+
+// NewCounterFunc регистрирует счетчик, который ведется вне реестра и читается через fn
+func (reg *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	reg.register(name, &funcMetric{name: name, help: help, typ: "counter", fn: fn})
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(n)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// withLabel добавляет метку к уже отформатированному набору
+func withLabel(labels, name, value string) string {
+	l := name + `="` + value + `"`
+	if labels == "" {
+		return "{" + l + "}"
+	}
+	return labels[:len(labels)-1] + "," + l + "}"
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeHelp(s string) string { return helpEscaper.Replace(s) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
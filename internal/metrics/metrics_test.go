@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExposition(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.NewCounterVec("requests_total", "Запросы.", "method", "path")
+	latency := reg.NewHistogramVec("latency_seconds", "Задержка.", []float64{0.5, 0.1}, "op")
+	reg.NewGaugeFunc("temperature", "Текущее\nзначение.", func() float64 { return 36.6 })
+
+	requests.With("GET", "/b").Inc()
+	requests.With("GET", "/a").Add(2)
+	requests.With("POST", `/"q"\`).Inc()
+	requests.With("GET", "/a").Add(-5) // Счетчик не уменьшается
+	latency.With("read").Observe(0.05)
+	latency.With("read").Observe(0.3)
+	latency.With("read").Observe(7)
+
+	var buf bytes.Buffer
+	if err := reg.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP requests_total Запросы.
+# TYPE requests_total counter
+requests_total{method="GET",path="/a"} 2
+requests_total{method="GET",path="/b"} 1
+requests_total{method="POST",path="/\"q\"\\"} 1
+# HELP latency_seconds Задержка.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{op="read",le="0.1"} 1
+latency_seconds_bucket{op="read",le="0.5"} 2
+latency_seconds_bucket{op="read",le="+Inf"} 3
+latency_seconds_sum{op="read"} 7.35
+latency_seconds_count{op="read"} 3
+# HELP temperature Текущее\nзначение.
+# TYPE temperature gauge
+temperature 36.6
+`
+	if buf.String() != expected {
+		t.Errorf("Неожиданный вывод:\n%s\nожидалось:\n%s", buf.String(), expected)
+	}
+}
+
+func TestRegistryRejectsDuplicates(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounterVec("dup_total", "")
+	defer func() {
+		if recover() == nil {
+			t.Error("Ожидалась паника при повторной регистрации метрики")
+		}
+	}()
+	reg.NewGaugeFunc("dup_total", "", func() float64 { return 0 })
+}
+
+func TestHandlerAndStorageMetrics(t *testing.T) {
+	reg := NewRegistry()
+	sm := NewStorageMetrics(reg)
+	sm.ObserveOp("GetUserByID", 20*time.Millisecond, nil)
+	sm.ObserveOp("GetUserByID", time.Millisecond, errors.New("boom"))
+
+	rr := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rr.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type %q, ожидался %q", ct, ContentType)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		`storage_operation_duration_seconds_count{method="GetUserByID",result="ok"} 1`,
+		`storage_operation_duration_seconds_count{method="GetUserByID",result="error"} 1`,
+		`storage_operation_duration_seconds_bucket{method="GetUserByID",result="ok",le="0.025"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("В выводе нет %q:\n%s", want, body)
+		}
+	}
+}
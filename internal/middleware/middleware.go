@@ -0,0 +1,201 @@
+// Package middleware содержит сквозную обработку HTTP-запросов: идентификатор
+// запроса, восстановление после паники, журнал доступа и метрики
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/casanera/DlugoshSolutions/internal/metrics"
+	"github.com/casanera/DlugoshSolutions/internal/problem"
+	"github.com/casanera/DlugoshSolutions/internal/reqctx"
+	"github.com/casanera/DlugoshSolutions/internal/router"
+)
+
+// RequestIDHeader - заголовок, в котором идентификатор запроса принимается от
+// клиента (или прокси) и возвращается в ответе
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength ограничивает длину идентификатора, пришедшего извне
+const maxRequestIDLength = 128
+
+// Middleware оборачивает обработчик дополнительным поведением
+type Middleware func(http.Handler) http.Handler
+
+// Chain оборачивает h в middleware так, что первый в списке выполняется первым
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// RequestID берет идентификатор из заголовка X-Request-ID или генерирует новый,
+// кладет его в контекст запроса (reqctx) и возвращает клиенту в том же заголовке
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(reqctx.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID пропускает только короткие идентификаторы из печатных
+// ASCII-символов, чтобы клиент не мог подделать строки журнала
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand не должен отказывать; на всякий случай - уникальное по времени значение
+		return time.Now().UTC().Format("20060102T150405.000000000")
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// responseRecorder запоминает статус и размер ответа для журнала и Recover
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// record переиспользует уже обернутый ResponseWriter, чтобы цепочка
+// middleware видела один и тот же статус
+func record(w http.ResponseWriter) *responseRecorder {
+	if rec, ok := w.(*responseRecorder); ok {
+		return rec
+	}
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap открывает исходный ResponseWriter для http.ResponseController
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Recover перехватывает панику в обработчике, пишет стек в журнал и отвечает
+// 500 в формате problem+json, если ответ еще не начат
+func Recover(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := record(w)
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v) // Штатный способ прервать ответ - обрабатывает сам net/http
+				}
+				logger.ErrorContext(r.Context(), "паника в обработчике",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.Any("panic", v),
+					slog.String("stack", string(debug.Stack())))
+				if rec.status == 0 {
+					problem.Error(rec, r, http.StatusInternalServerError, problem.CodeInternal, "Внутренняя ошибка сервера")
+				}
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// AccessLog пишет по записи на каждый запрос: метод, путь, статус, размер
+// ответа и время обработки. Ответы 5xx пишутся с уровнем WARN
+func AccessLog(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := record(w)
+			next.ServeHTTP(rec, r)
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK // Обработчик ничего не записал - net/http ответит 200
+			}
+			level := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelWarn
+			}
+			logger.LogAttrs(r.Context(), level, "HTTP-запрос",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("query", r.URL.RawQuery),
+				slog.Int("status", status),
+				slog.Int64("bytes", rec.bytes),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote_addr", r.RemoteAddr))
+		})
+	}
+}
+
+// knownMethods ограничивает значения метки method, чтобы произвольные методы
+// от клиентов не раздували число временных рядов
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// Metrics считает запросы и время их обработки по методу, шаблону маршрута
+// и статусу. Запросы, не попавшие ни в один маршрут, получают route="unmatched"
+func Metrics(m *metrics.HTTPMetrics) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ctx, route := router.CaptureRoute(r.Context())
+			rec := record(w)
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			method := r.Method
+			if !knownMethods[method] {
+				method = "OTHER"
+			}
+			name := route()
+			if name == "" {
+				name = "unmatched"
+			}
+			m.Requests.With(method, name, strconv.Itoa(status)).Inc()
+			m.Duration.With(method, name).Observe(time.Since(start).Seconds())
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/casanera/DlugoshSolutions/internal/metrics"
+	"github.com/casanera/DlugoshSolutions/internal/problem"
+	"github.com/casanera/DlugoshSolutions/internal/reqctx"
+	"github.com/casanera/DlugoshSolutions/internal/router"
+)
+
+// captureLog возвращает логгер, пишущий в буфер, и сам буфер.
+// request_id в записях тестов не нужен, поэтому используется обычный TextHandler
+func captureLog() (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return slog.New(slog.NewTextHandler(&buf, nil)), &buf
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = reqctx.RequestID(r.Context())
+	}))
+
+	t.Run("Генерация", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		if len(seen) != 32 {
+			t.Fatalf("Ожидался сгенерированный ID из 32 hex-символов, получено %q", seen)
+		}
+		if got := rr.Header().Get(RequestIDHeader); got != seen {
+			t.Errorf("В ответе %q, в контексте %q", got, seen)
+		}
+	})
+
+	t.Run("Проброс от клиента", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, "abc-123")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if seen != "abc-123" || rr.Header().Get(RequestIDHeader) != "abc-123" {
+			t.Errorf("Ожидался ID клиента abc-123, в контексте %q, в ответе %q", seen, rr.Header().Get(RequestIDHeader))
+		}
+	})
+
+	t.Run("Недопустимый ID заменяется", func(t *testing.T) {
+		for _, bad := range []string{"with space", "line\nbreak", strings.Repeat("x", maxRequestIDLength+1)} {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(RequestIDHeader, bad)
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			if seen == bad || len(seen) != 32 {
+				t.Errorf("ID %q должен был быть заменен, получено %q", bad, seen)
+			}
+		}
+	})
+}
+
+func TestRecoverAndAccessLog(t *testing.T) {
+	logger, logs := captureLog()
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("сбой")
+	}), RequestID, AccessLog(logger), Recover(logger))
+
+	req := httptest.NewRequest(http.MethodGet, "/boom", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("Статус %d, ожидался 500", rr.Code)
+	}
+	var p problem.Problem
+	if err := json.NewDecoder(rr.Body).Decode(&p); err != nil || p.Code != problem.CodeInternal {
+		t.Errorf("Ожидался problem с кодом %s, получено %+v (ошибка %v)", problem.CodeInternal, p, err)
+	}
+	out := logs.String()
+	for _, want := range []string{`msg="паника в обработчике" method=GET path=/boom panic=сбой`, "goroutine", "status=500"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("В журнале нет %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRecoverAfterResponseStarted(t *testing.T) {
+	logger, _ := captureLog()
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("частичный ответ"))
+		panic("сбой")
+	}), Recover(logger))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	// Заголовки уже отправлены - тело problem дописывать нельзя
+	if rr.Code != http.StatusAccepted || rr.Body.String() != "частичный ответ" {
+		t.Errorf("Ответ изменен после паники: %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAccessLogCountsBytes(t *testing.T) {
+	logger, logs := captureLog()
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}), RequestID, AccessLog(logger))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/x?a=1", nil))
+	if out := logs.String(); !strings.Contains(out, "method=GET path=/x query=\"a=1\" status=200 bytes=5 duration=") {
+		t.Errorf("Неожиданная строка журнала: %s", out)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	rt := router.New()
+	rt.HandleFunc(http.MethodGet, "/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	h := Chain(rt, Metrics(metrics.NewHTTPMetrics(reg)))
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/items/1", nil),
+		httptest.NewRequest(http.MethodGet, "/items/2", nil),
+		httptest.NewRequest(http.MethodDelete, "/items/2", nil),
+		httptest.NewRequest("BREW", "/coffee", nil),
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var buf bytes.Buffer
+	reg.Write(&buf)
+	out := buf.String()
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/items/{id}",status="204"} 2`,
+		`http_requests_total{method="DELETE",route="/items/{id}",status="405"} 1`,
+		`http_requests_total{method="OTHER",route="unmatched",status="404"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/items/{id}"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("В метриках нет %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+// Package migrate применяет SQL-миграции из db/migrations к PostgreSQL.
+// Примененные версии хранятся в таблице schema_migrations, одновременный
+// запуск из нескольких экземпляров исключается advisory-блокировкой
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/casanera/DlugoshSolutions/internal/logging"
+)
+
+// lockKey - ключ pg_advisory_lock, общий для всех экземпляров приложения
+const lockKey int64 = 0x646c7567_6f736800 // "dlugosh"
+
+// fileNameRe описывает имя файла миграции: 001_create_users_table.up.sql
+var fileNameRe = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration - одна версия схемы с SQL для применения и отката
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status - состояние одной миграции в БД
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Load читает миграции из fsys и упорядочивает их по версии.
+// У каждой версии должны быть оба файла: up и down
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("migrate.Load: %w", err)
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".sql" {
+			continue
+		}
+		m := fileNameRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migrate.Load: некорректное имя файла миграции %q", e.Name())
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("migrate.Load: %w", err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migrate.Load: у версии %d разные имена: %q и %q", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migrate.Load: у версии %d (%s) нет пары up/down", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator применяет и откатывает миграции
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+	Logger     *slog.Logger
+}
+
+func (m *Migrator) logger() *slog.Logger {
+	if m.Logger == nil {
+		return slog.Default()
+	}
+	return m.Logger
+}
+
+// New загружает миграции из fsys
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Migrations: migrations, Logger: slog.Default()}, nil
+}
+
+// withLock выполняет fn на выделенном соединении под advisory-блокировкой.
+// Сессионная блокировка привязана к соединению, поэтому весь процесс идет через conn
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate: получение соединения: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("migrate: захват блокировки: %w", err)
+	}
+	defer func() {
+		// Контекст мог быть отменен - снимаем блокировку независимо от него
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey); err != nil {
+			m.logger().Error("не удалось снять блокировку миграций", logging.Err(err))
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return fmt.Errorf("migrate: создание schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+// applied возвращает время применения каждой версии
+func applied(ctx context.Context, q interface {
+	QueryContext(context.Context, string, ...any) (*sql.Rows, error)
+}) (map[int64]time.Time, error) {
+	rows, err := q.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("migrate: чтение schema_migrations: %w", err)
+	}
+	defer rows.Close()
+	result := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version int64
+			at      time.Time
+		)
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("migrate: чтение schema_migrations: %w", err)
+		}
+		result[version] = at
+	}
+	return result, rows.Err()
+}
+
+// runInTx выполняет SQL миграции и запись в schema_migrations в одной транзакции:
+// DDL в PostgreSQL транзакционен, поэтому неудачная миграция не оставляет следов
+func runInTx(ctx context.Context, conn *sql.Conn, query, bookkeeping string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Up применяет все непримененные миграции по возрастанию версии.
+// Возвращает количество примененных миграций
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	count := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.Migrations {
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+			m.logger().InfoContext(ctx, "применение миграции", slog.Int64("version", mig.Version), slog.String("name", mig.Name))
+			if err := runInTx(ctx, conn, mig.Up,
+				"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", mig.Version, mig.Name); err != nil {
+				return fmt.Errorf("migrate: миграция %03d_%s: %w", mig.Version, mig.Name, err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down откатывает steps последних примененных миграций.
+// Возвращает количество откаченных миграций
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	if steps <= 0 {
+		return 0, errors.New("migrate: количество шагов отката должно быть положительным")
+	}
+	count := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.Migrations) - 1; i >= 0 && count < steps; i-- {
+			mig := m.Migrations[i]
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+			m.logger().InfoContext(ctx, "откат миграции", slog.Int64("version", mig.Version), slog.String("name", mig.Name))
+			if err := runInTx(ctx, conn, mig.Down,
+				"DELETE FROM schema_migrations WHERE version = $1", mig.Version); err != nil {
+				return fmt.Errorf("migrate: откат %03d_%s: %w", mig.Version, mig.Name, err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Status возвращает состояние всех известных миграций
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var result []Status
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.Migrations {
+			at, ok := done[mig.Version]
+			result = append(result, Status{Migration: mig, Applied: ok, AppliedAt: at})
+		}
+		return nil
+	})
+	return result, err
+}
+
+// Pending возвращает количество непримененных миграций. Не создает таблиц
+// и не берет блокировку, поэтому подходит для проверок готовности
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	var exists bool
+	if err := m.DB.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return 0, fmt.Errorf("migrate: проверка schema_migrations: %w", err)
+	}
+	if !exists {
+		return len(m.Migrations), nil
+	}
+	done, err := applied(ctx, m.DB)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, mig := range m.Migrations {
+		if _, ok := done[mig.Version]; !ok {
+			pending++
+		}
+	}
+	return pending, nil
+}
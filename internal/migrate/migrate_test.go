@@ -0,0 +1,65 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/casanera/DlugoshSolutions/db/migrations"
+)
+
+func TestLoadEmbeddedMigrations(t *testing.T) {
+	loaded, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatalf("Встроенные миграции не загружаются: %v", err)
+	}
+	if len(loaded) == 0 {
+		t.Fatal("Не найдено ни одной встроенной миграции")
+	}
+	for i, m := range loaded {
+		if i > 0 && m.Version <= loaded[i-1].Version {
+			t.Errorf("Миграции не упорядочены по версии: %d после %d", m.Version, loaded[i-1].Version)
+		}
+	}
+	if loaded[0].Version != 1 || loaded[0].Name != "create_users_table" {
+		t.Errorf("Первой должна быть миграция 001_create_users_table, получено %03d_%s", loaded[0].Version, loaded[0].Name)
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	testCases := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{"Нет down-файла", fstest.MapFS{
+			"001_init.up.sql": {Data: []byte("CREATE TABLE t (id INT);")},
+		}},
+		{"Некорректное имя файла", fstest.MapFS{
+			"init.sql": {Data: []byte("SELECT 1;")},
+		}},
+		{"Разные имена у одной версии", fstest.MapFS{
+			"001_init.up.sql":    {Data: []byte("SELECT 1;")},
+			"001_other.down.sql": {Data: []byte("SELECT 1;")},
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Load(tc.fsys); err == nil {
+				t.Errorf("Ожидалась ошибка загрузки")
+			}
+		})
+	}
+
+	loaded, err := Load(fstest.MapFS{
+		"010_b.up.sql":   {Data: []byte("up b")},
+		"010_b.down.sql": {Data: []byte("down b")},
+		"002_a.up.sql":   {Data: []byte("up a")},
+		"002_a.down.sql": {Data: []byte("down a")},
+		"README.md":      {Data: []byte("не миграция")},
+	})
+	if err != nil {
+		t.Fatalf("Неожиданная ошибка: %v", err)
+	}
+	if len(loaded) != 2 || loaded[0].Version != 2 || loaded[1].Up != "up b" || loaded[1].Down != "down b" {
+		t.Errorf("Неверный результат загрузки: %+v", loaded)
+	}
+}
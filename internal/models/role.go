@@ -0,0 +1,8 @@
+package models
+
+// Role - именованный набор разрешений, который назначается пользователям
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"` // например users:read или users:write:self
+}
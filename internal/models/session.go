@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Credentials - пароль пользователя и состояние блокировки входа
+type Credentials struct {
+	UserID         int64
+	PasswordHash   string
+	FailedAttempts int
+	LockedUntil    *time.Time
+}
+
+// Session - серверная сессия пользователя. Идентификатор сессии известен
+// только клиенту (cookie), в хранилище лежит его хеш
+type Session struct {
+	UserID     int64
+	CSRFToken  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time // абсолютный срок жизни, не продлевается активностью
+}
@@ -1,8 +1,14 @@
 package models
 
+import "time"
+
 // структура пользователя в системе
 type User struct {
-	ID    int64  `json:"id"` // как это поле будет называться при (де)сериализации в JSON
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID      int64  `json:"id"` // как это поле будет называться при (де)сериализации в JSON
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Version int64  `json:"version"` // увеличивается при каждом изменении, используется в ETag
+	// DeletedAt - время удаления; удаленный пользователь хранится до
+	// окончательного удаления и может быть восстановлен
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
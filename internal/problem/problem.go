@@ -0,0 +1,130 @@
+// Package problem формирует ответы об ошибках в формате RFC 7807
+// (application/problem+json), единые для всех обработчиков API
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/casanera/DlugoshSolutions/internal/logging"
+)
+
+// ContentType - MIME-тип ответа с описанием проблемы
+const ContentType = "application/problem+json"
+
+// Машиночитаемые коды ошибок. Клиенты ветвятся по полю code, а не по тексту
+const (
+	CodeInvalidJSON        = "invalid_json"
+	CodeInvalidPatch       = "invalid_patch"
+	CodeUnsupportedMedia   = "unsupported_media_type"
+	CodeInvalidID          = "invalid_id"
+	CodeInvalidQuery       = "invalid_query"
+	CodeValidation         = "validation_failed"
+	CodeNotFound           = "not_found"
+	CodeDuplicateEmail     = "duplicate_email"
+	CodeConflict           = "conflict"
+	CodePreconditionFailed = "precondition_failed"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeCSRF               = "csrf_failed"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeAccountLocked      = "account_locked"
+	CodeTimeout            = "timeout"
+	CodeBatchAborted       = "batch_aborted"
+	CodeInvalidImport      = "invalid_import"
+	CodeInternal           = "internal_error"
+)
+
+// titles - краткие описания типов проблем (поле title не зависит от конкретного случая)
+var titles = map[string]string{
+	CodeInvalidJSON:        "Некорректный JSON",
+	CodeInvalidPatch:       "Некорректный патч",
+	CodeUnsupportedMedia:   "Неподдерживаемый тип содержимого",
+	CodeInvalidID:          "Некорректный идентификатор",
+	CodeInvalidQuery:       "Некорректные параметры запроса",
+	CodeValidation:         "Ошибка валидации",
+	CodeNotFound:           "Ресурс не найден",
+	CodeDuplicateEmail:     "Email уже используется",
+	CodeConflict:           "Конфликт изменений",
+	CodePreconditionFailed: "Предусловие не выполнено",
+	CodeMethodNotAllowed:   "Метод не разрешен",
+	CodeUnauthorized:       "Требуется аутентификация",
+	CodeForbidden:          "Доступ запрещен",
+	CodeCSRF:               "Ошибка проверки CSRF",
+	CodeInvalidCredentials: "Неверные учетные данные",
+	CodeAccountLocked:      "Вход временно заблокирован",
+	CodeTimeout:            "Превышено время ожидания",
+	CodeBatchAborted:       "Пакет операций отменен",
+	CodeInvalidImport:      "Некорректный файл импорта",
+	CodeInternal:           "Внутренняя ошибка сервера",
+}
+
+// FieldError описывает ошибку в конкретном поле запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Problem - тело ответа об ошибке по RFC 7807 с расширениями code и errors
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// New создает описание проблемы. Тип проблемы выводится из кода
+func New(status int, code, detail string) *Problem {
+	title, ok := titles[code]
+	if !ok {
+		title = http.StatusText(status)
+	}
+	return &Problem{
+		Type:   "/problems/" + code,
+		Title:  title,
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// WithErrors добавляет к проблеме ошибки по отдельным полям
+func (p *Problem) WithErrors(errs ...FieldError) *Problem {
+	p.Errors = append(p.Errors, errs...)
+	return p
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// Write отправляет проблему клиенту. Если instance не задан, им становится путь запроса
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" && r != nil {
+		p.Instance = r.URL.Path
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		ctx := context.Background()
+		if r != nil {
+			ctx = r.Context()
+		}
+		slog.ErrorContext(ctx, "ошибка записи ответа с проблемой", logging.Err(err))
+	}
+}
+
+// Error - сокращение для Write(w, r, New(status, code, detail))
+func Error(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	Write(w, r, New(status, code, detail))
+}
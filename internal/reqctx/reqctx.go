@@ -0,0 +1,19 @@
+// Package reqctx хранит в контексте данные запроса, нужные на всех уровнях
+// приложения: HTTP-слой их записывает, журнал и хранилища читают, не завися
+// от пакетов HTTP
+package reqctx
+
+import "context"
+
+type requestIDKey struct{}
+
+// WithRequestID возвращает контекст с идентификатором запроса
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID возвращает идентификатор запроса или "", если его нет
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,171 @@
+// Package router - обертка над http.ServeMux (шаблоны Go 1.22 вида
+// "GET /api/v1/users/{id}"), которая отвечает на OPTIONS и на неподдерживаемые
+// методы с заголовком Allow и телом в формате problem+json
+package router
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/casanera/DlugoshSolutions/internal/problem"
+)
+
+// Resource описывает REST-ресурс. Незаданные обработчики не регистрируются
+type Resource struct {
+	List   http.HandlerFunc // GET    /path
+	Create http.HandlerFunc // POST   /path
+	Get    http.HandlerFunc // GET    /path/{id}
+	Update http.HandlerFunc // PUT    /path/{id}
+	Patch  http.HandlerFunc // PATCH  /path/{id}
+	Delete http.HandlerFunc // DELETE /path/{id}
+}
+
+// Router регистрирует маршруты по методу и пути
+type Router struct {
+	mux *http.ServeMux
+	// paths сопоставляет запрос с путями маршрутов без учета метода; нужен
+	// только для 405 и OPTIONS. В mux шаблоны без метода не попадают: шаблон
+	// "/users/import" конфликтовал бы там с "PUT /users/{id}"
+	paths *http.ServeMux
+
+	mu      sync.RWMutex
+	methods map[string][]string // путь -> зарегистрированные методы
+	mounts  map[string]bool     // шаблоны Mount
+}
+
+func New() *Router {
+	return &Router{
+		mux:     http.NewServeMux(),
+		paths:   http.NewServeMux(),
+		methods: make(map[string][]string),
+		mounts:  make(map[string]bool),
+	}
+}
+
+// Handle регистрирует обработчик для метода и пути. Путь может содержать
+// шаблоны ServeMux, значения доступны через r.PathValue
+func (rt *Router) Handle(method, path string, h http.Handler) {
+	rt.mux.Handle(method+" "+path, tagRoute(path, h))
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if _, seen := rt.methods[path]; !seen {
+		rt.paths.Handle(path, http.NotFoundHandler()) // обработчик не вызывается
+	}
+	rt.methods[path] = append(rt.methods[path], method)
+}
+
+// HandleFunc - то же, что Handle, для функции-обработчика
+func (rt *Router) HandleFunc(method, path string, h http.HandlerFunc) {
+	rt.Handle(method, path, h)
+}
+
+// Mount регистрирует обработчик для всех методов (статика, поддеревья).
+// Пути, зарегистрированные через Handle, Mount не перехватывает: на другие
+// методы для них роутер отвечает 405
+func (rt *Router) Mount(pattern string, h http.Handler) {
+	rt.mux.Handle(pattern, tagRoute(pattern, h))
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.mounts[pattern] = true
+}
+
+// Resource регистрирует коллекцию path и элемент path/{id}
+func (rt *Router) Resource(path string, res Resource) {
+	item := path + "/{id}"
+	for _, r := range []struct {
+		method, path string
+		h            http.HandlerFunc
+	}{
+		{http.MethodGet, path, res.List},
+		{http.MethodPost, path, res.Create},
+		{http.MethodGet, item, res.Get},
+		{http.MethodPut, item, res.Update},
+		{http.MethodPatch, item, res.Patch},
+		{http.MethodDelete, item, res.Delete},
+	} {
+		if r.h != nil {
+			rt.HandleFunc(r.method, r.path, r.h)
+		}
+	}
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, pattern := rt.mux.Handler(r); pattern == "" || rt.mounted(pattern) {
+		// Для метода запроса маршрута нет. Если путь зарегистрирован с другими
+		// методами - это 405 (или ответ на OPTIONS), а не 404 или поддерево Mount
+		if _, path := rt.paths.Handler(r); path != "" {
+			tagRoute(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				rt.methodNotAllowed(w, r, path)
+			})).ServeHTTP(w, r)
+			return
+		}
+	}
+	// Handler не заполняет r.PathValue, поэтому запрос обслуживает сам mux
+	rt.mux.ServeHTTP(w, r)
+}
+
+func (rt *Router) mounted(pattern string) bool {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	return rt.mounts[pattern]
+}
+
+// Allowed возвращает методы, допустимые для пути (с учетом HEAD и OPTIONS)
+func (rt *Router) Allowed(path string) []string {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	set := map[string]bool{http.MethodOptions: true}
+	for _, m := range rt.methods[path] {
+		set[m] = true
+		if m == http.MethodGet {
+			set[http.MethodHead] = true // ServeMux отдает GET-обработчику и HEAD
+		}
+	}
+	allowed := make([]string, 0, len(set))
+	for m := range set {
+		allowed = append(allowed, m)
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+func (rt *Router) methodNotAllowed(w http.ResponseWriter, r *http.Request, path string) {
+	allow := strings.Join(rt.Allowed(path), ", ")
+	w.Header().Set("Allow", allow)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed,
+		"Метод "+r.Method+" не поддерживается для этого ресурса. Допустимые методы: "+allow)
+}
+
+type routeKey struct{}
+
+// CaptureRoute готовит контекст, в который роутер запишет шаблон пути
+// сработавшего маршрута (например, "/api/v1/users/{id}"). Шаблон нужен для
+// меток метрик; r.Pattern появился только в Go 1.23.
+// route возвращает "", если запрос не дошел ни до одного маршрута
+func CaptureRoute(ctx context.Context) (_ context.Context, route func() string) {
+	pattern := new(string)
+	return context.WithValue(ctx, routeKey{}, pattern), func() string { return *pattern }
+}
+
+func tagRoute(pattern string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := r.Context().Value(routeKey{}).(*string); ok {
+			*p = pattern
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// NotFound отвечает 404 в формате problem+json
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "Маршрут "+r.URL.Path+" не найден")
+}
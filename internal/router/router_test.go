@@ -0,0 +1,132 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/casanera/DlugoshSolutions/internal/problem"
+)
+
+func newTestRouter() *Router {
+	rt := New()
+	echoID := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method + " " + r.PathValue("id")))
+	}
+	rt.Resource("/items", Resource{
+		List:   echoID,
+		Create: echoID,
+		Get:    echoID,
+		Delete: echoID,
+	})
+	// Литеральный путь рядом с /items/{id} не должен конфликтовать в ServeMux
+	rt.HandleFunc(http.MethodPost, "/items/import", echoID)
+	rt.HandleFunc(http.MethodPost, "/api/echo", echoID) // другие методы - 405, а не 404 из Mount
+	rt.Mount("/api/", http.HandlerFunc(NotFound))
+	return rt
+}
+
+func TestRouterDispatch(t *testing.T) {
+	rt := newTestRouter()
+	testCases := []struct {
+		method, target string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{http.MethodGet, "/items", http.StatusOK, "GET "},
+		{http.MethodPost, "/items", http.StatusOK, "POST "},
+		{http.MethodGet, "/items/42", http.StatusOK, "GET 42"},
+		{http.MethodDelete, "/items/7", http.StatusOK, "DELETE 7"},
+		{http.MethodHead, "/items/42", http.StatusOK, ""},
+		{http.MethodPost, "/items/import", http.StatusOK, "POST "},
+		{http.MethodGet, "/items/import", http.StatusOK, "GET import"}, // GET есть только у /items/{id}
+	}
+	for _, tc := range testCases {
+		t.Run(tc.method+" "+tc.target, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			rt.ServeHTTP(rr, httptest.NewRequest(tc.method, tc.target, nil))
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Статус %d, ожидался %d", rr.Code, tc.expectedStatus)
+			}
+			// httptest.ResponseRecorder не отбрасывает тело HEAD-ответа - это делает сервер
+			if tc.method != http.MethodHead && rr.Body.String() != tc.expectedBody {
+				t.Errorf("Тело %q, ожидалось %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestRouterMethodNotAllowed(t *testing.T) {
+	rt := newTestRouter()
+	testCases := []struct {
+		target, expectedAllow string
+	}{
+		{"/items", "GET, HEAD, OPTIONS, POST"},
+		{"/items/1", "DELETE, GET, HEAD, OPTIONS"},
+		{"/items/import", "OPTIONS, POST"},
+		{"/api/echo", "OPTIONS, POST"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.target, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			rt.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, tc.target, nil))
+			if rr.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("Статус %d, ожидался 405", rr.Code)
+			}
+			if got := rr.Header().Get("Allow"); got != tc.expectedAllow {
+				t.Errorf("Allow %q, ожидался %q", got, tc.expectedAllow)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != problem.ContentType {
+				t.Errorf("Content-Type %q, ожидался %q", ct, problem.ContentType)
+			}
+			var p problem.Problem
+			if err := json.NewDecoder(rr.Body).Decode(&p); err != nil || p.Code != problem.CodeMethodNotAllowed {
+				t.Errorf("Ожидался problem с кодом %s, получено %+v (ошибка %v)", problem.CodeMethodNotAllowed, p, err)
+			}
+
+			rr = httptest.NewRecorder()
+			rt.ServeHTTP(rr, httptest.NewRequest(http.MethodOptions, tc.target, nil))
+			if rr.Code != http.StatusNoContent {
+				t.Fatalf("OPTIONS: статус %d, ожидался 204", rr.Code)
+			}
+			if got := rr.Header().Get("Allow"); got != tc.expectedAllow {
+				t.Errorf("OPTIONS: Allow %q, ожидался %q", got, tc.expectedAllow)
+			}
+		})
+	}
+}
+
+func TestRouterNotFound(t *testing.T) {
+	rt := newTestRouter()
+	rr := httptest.NewRecorder()
+	rt.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/unknown", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("Статус %d, ожидался 404", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Errorf("Content-Type %q, ожидался %q", ct, problem.ContentType)
+	}
+}
+
+func TestCaptureRoute(t *testing.T) {
+	rt := newTestRouter()
+	testCases := []struct {
+		method, target, expectedRoute string
+	}{
+		{http.MethodGet, "/items/5", "/items/{id}"},
+		{http.MethodPut, "/items", "/items"}, // 405 тоже относится к маршруту
+		{http.MethodGet, "/api/missing", "/api/"},
+		{http.MethodPut, "/items/import", "/items/import"},
+		{http.MethodGet, "/nowhere", ""},
+	}
+	for _, tc := range testCases {
+		ctx, route := CaptureRoute(context.Background())
+		req := httptest.NewRequest(tc.method, tc.target, nil).WithContext(ctx)
+		rt.ServeHTTP(httptest.NewRecorder(), req)
+		if got := route(); got != tc.expectedRoute {
+			t.Errorf("%s %s: маршрут %q, ожидался %q", tc.method, tc.target, got, tc.expectedRoute)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/casanera/DlugoshSolutions/internal/logging"
+	"github.com/casanera/DlugoshSolutions/internal/models"
+)
+
+// lastUsedResolution - как часто обновляется last_used_at. Запись при каждом
+// запросе превратила бы любое чтение API в запись в БД
+const lastUsedResolution = time.Minute
+
+// APIKeyStorage хранит API-ключи. Ключи ищутся по хешу, открытый ключ
+// в хранилище не попадает
+type APIKeyStorage interface {
+	CreateAPIKey(ctx context.Context, key *models.APIKey, hash string) (int64, error)
+	// AuthenticateAPIKey находит действующий ключ по хешу и отмечает его использование.
+	// Возвращает ErrAPIKeyNotFound, ErrAPIKeyRevoked или ErrAPIKeyExpired
+	AuthenticateAPIKey(ctx context.Context, hash string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int64) error
+}
+
+const apiKeyColumns = "id, name, prefix, scopes, created_at, last_used_at, expires_at, revoked_at"
+
+func scanAPIKey(row rowScanner, k *models.APIKey) error {
+	var lastUsed, expires, revoked sql.NullTime
+	err := row.Scan(&k.ID, &k.Name, &k.Prefix, pq.Array(&k.Scopes), &k.CreatedAt, &lastUsed, &expires, &revoked)
+	k.LastUsedAt = nullTime(lastUsed)
+	k.ExpiresAt = nullTime(expires)
+	k.RevokedAt = nullTime(revoked)
+	return err
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+type PostgresAPIKeyStorage struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+	Logger       *slog.Logger
+}
+
+func NewPostgresAPIKeyStorage(db *sql.DB) *PostgresAPIKeyStorage {
+	return &PostgresAPIKeyStorage{DB: db, QueryTimeout: DefaultQueryTimeout, Logger: slog.Default()}
+}
+
+func (s *PostgresAPIKeyStorage) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withQueryTimeout(ctx, s.QueryTimeout)
+}
+
+// CreateAPIKey сохраняет ключ; ID и CreatedAt заполняются из БД
+func (s *PostgresAPIKeyStorage) CreateAPIKey(ctx context.Context, key *models.APIKey, hash string) (int64, error) {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	query := `INSERT INTO api_keys (name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
+	err := s.DB.QueryRowContext(ctx, query, key.Name, key.Prefix, hash, pq.Array(key.Scopes), key.ExpiresAt).
+		Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return 0, fmt.Errorf("storage.CreateAPIKey: %w", err)
+	}
+	return key.ID, nil
+}
+
+func (s *PostgresAPIKeyStorage) AuthenticateAPIKey(ctx context.Context, hash string) (*models.APIKey, error) {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	key := &models.APIKey{}
+	err := scanAPIKey(s.DB.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = $1", hash), key)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("storage.AuthenticateAPIKey: %w", ErrAPIKeyNotFound)
+		}
+		return nil, fmt.Errorf("storage.AuthenticateAPIKey: %w", err)
+	}
+	if err := checkAPIKey(key, time.Now()); err != nil {
+		return nil, fmt.Errorf("storage.AuthenticateAPIKey: ID %d: %w", key.ID, err)
+	}
+
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) >= lastUsedResolution {
+		// Ошибка отметки не должна мешать запросу с действующим ключом
+		if _, err := s.DB.ExecContext(ctx, "UPDATE api_keys SET last_used_at = now() WHERE id = $1", key.ID); err != nil && s.Logger != nil {
+			s.Logger.WarnContext(ctx, "не удалось обновить last_used_at API-ключа",
+				slog.Int64("api_key_id", key.ID), logging.Err(err))
+		}
+	}
+	return key, nil
+}
+
+// checkAPIKey проверяет, что ключ не отозван и не просрочен на момент now
+func checkAPIKey(key *models.APIKey, now time.Time) error {
+	switch {
+	case key.RevokedAt != nil:
+		return ErrAPIKeyRevoked
+	case key.ExpiresAt != nil && !now.Before(*key.ExpiresAt):
+		return ErrAPIKeyExpired
+	}
+	return nil
+}
+
+func (s *PostgresAPIKeyStorage) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("storage.ListAPIKeys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		var k models.APIKey
+		if err := scanAPIKey(rows, &k); err != nil {
+			return nil, fmt.Errorf("storage.ListAPIKeys: ошибка сканирования строки: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("storage.ListAPIKeys: ошибка после итерации: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey отзывает ключ. Действует сразу: ключ проверяется по БД
+// при каждом запросе. Повторный отзыв не меняет исходное время отзыва
+func (s *PostgresAPIKeyStorage) RevokeAPIKey(ctx context.Context, id int64) error {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("storage.RevokeAPIKey: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("storage.RevokeAPIKey: не удалось получить количество измененных строк: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("storage.RevokeAPIKey: ID %d: %w", id, ErrAPIKeyNotFound)
+	}
+	return nil
+}
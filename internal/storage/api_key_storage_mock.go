@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/casanera/DlugoshSolutions/internal/models"
+)
+
+// MockAPIKeyStorage является мок-реализацией APIKeyStorage для тестов
+type MockAPIKeyStorage struct {
+	Keys        map[string]*models.APIKey // ключи по хешу
+	NextID      int64
+	ReturnError error // Какую ошибку возвращать
+}
+
+func NewMockAPIKeyStorage() *MockAPIKeyStorage {
+	return &MockAPIKeyStorage{Keys: make(map[string]*models.APIKey), NextID: 1}
+}
+
+func (m *MockAPIKeyStorage) CreateAPIKey(ctx context.Context, key *models.APIKey, hash string) (int64, error) {
+	if m.ReturnError != nil {
+		return 0, m.ReturnError
+	}
+	key.ID = m.NextID
+	key.CreatedAt = time.Now()
+	m.NextID++
+	stored := *key
+	m.Keys[hash] = &stored
+	return key.ID, nil
+}
+
+func (m *MockAPIKeyStorage) AuthenticateAPIKey(ctx context.Context, hash string) (*models.APIKey, error) {
+	if m.ReturnError != nil {
+		return nil, m.ReturnError
+	}
+	key, ok := m.Keys[hash]
+	if !ok {
+		return nil, fmt.Errorf("мок: AuthenticateAPIKey: %w", ErrAPIKeyNotFound)
+	}
+	if err := checkAPIKey(key, time.Now()); err != nil {
+		return nil, fmt.Errorf("мок: AuthenticateAPIKey: ID %d: %w", key.ID, err)
+	}
+	now := time.Now()
+	key.LastUsedAt = &now
+	k := *key
+	return &k, nil
+}
+
+func (m *MockAPIKeyStorage) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	if m.ReturnError != nil {
+		return nil, m.ReturnError
+	}
+	keys := make([]models.APIKey, 0, len(m.Keys))
+	for _, k := range m.Keys {
+		keys = append(keys, *k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+func (m *MockAPIKeyStorage) RevokeAPIKey(ctx context.Context, id int64) error {
+	if m.ReturnError != nil {
+		return m.ReturnError
+	}
+	for _, k := range m.Keys {
+		if k.ID == id {
+			if k.RevokedAt == nil {
+				now := time.Now()
+				k.RevokedAt = &now
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("мок: RevokeAPIKey: ID %d: %w", id, ErrAPIKeyNotFound)
+}
@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/casanera/DlugoshSolutions/internal/audit"
+	"github.com/casanera/DlugoshSolutions/internal/models"
+	"github.com/casanera/DlugoshSolutions/internal/reqctx"
+)
+
+// AuditFilter ограничивает выборку событий аудита. Пустые поля не
+// применяются, заданные объединяются через AND. События отдаются от новых
+// к старым
+type AuditFilter struct {
+	Actor     string
+	Action    string
+	Resource  string
+	Outcome   string
+	RequestID string
+	Since     time.Time // не раньше (включительно)
+	Until     time.Time // раньше (не включительно)
+	Before    int64     // курсор: только события с меньшим id
+	Limit     int
+}
+
+// AuditPage - страница событий аудита
+type AuditPage struct {
+	Events  []audit.Event
+	HasNext bool // есть более старые события
+}
+
+// AuditStorage хранит журнал аудита. Изменения пользователей записывает
+// само хранилище пользователей в своей транзакции, Record - для остальных
+// событий (отказы в доступе, попытки входа)
+type AuditStorage interface {
+	audit.Recorder
+	ListAuditEvents(ctx context.Context, filter AuditFilter) (*AuditPage, error)
+}
+
+type PostgresAuditStorage struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+	Logger       *slog.Logger
+
+	tx *sql.Tx // задана у хранилища, полученного из WithTx
+}
+
+func NewPostgresAuditStorage(db *sql.DB) *PostgresAuditStorage {
+	return &PostgresAuditStorage{DB: db, QueryTimeout: DefaultQueryTimeout, Logger: slog.Default()}
+}
+
+func (s *PostgresAuditStorage) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withQueryTimeout(ctx, s.QueryTimeout)
+}
+
+// conn возвращает транзакцию unit of work, если она задана, иначе пул соединений
+func (s *PostgresAuditStorage) conn() dbtx {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.DB
+}
+
+// execer - общий интерфейс *sql.DB и *sql.Tx для запросов без результата
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// insertAuditEvent записывает событие через db - подключение или транзакцию
+// изменения, к которому относится событие. Пустой RequestID берется из контекста
+func insertAuditEvent(ctx context.Context, db execer, e audit.Event) error {
+	return insertAuditEvents(ctx, db, []audit.Event{e})
+}
+
+// insertAuditEvents записывает события одним многострочным INSERT. На событие
+// приходится 8 параметров, поэтому вызывающий код передает не больше нескольких
+// тысяч событий за раз (PostgreSQL принимает до 65535 параметров в запросе)
+func insertAuditEvents(ctx context.Context, db execer, events []audit.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	requestID := reqctx.RequestID(ctx)
+	values := make([]string, 0, len(events))
+	args := make([]any, 0, 8*len(events))
+	for _, e := range events {
+		if e.RequestID == "" {
+			e.RequestID = requestID
+		}
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8))
+		args = append(args, e.Actor, e.RequestID, e.Action, e.Resource, e.Outcome, e.Reason, nullJSON(e.Before), nullJSON(e.After))
+	}
+	query := "INSERT INTO audit_events (actor, request_id, action, resource, outcome, reason, before, after) VALUES " +
+		strings.Join(values, ", ")
+	if _, err := db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("запись события аудита: %w", err)
+	}
+	return nil
+}
+
+// userEvent описывает изменение пользователя субъектом из контекста.
+// before или after равен nil при создании и удалении
+func userEvent(ctx context.Context, action string, id int64, before, after *models.User) (audit.Event, error) {
+	e := audit.Event{
+		Actor:    audit.ActorFromContext(ctx),
+		Action:   action,
+		Resource: UserResource(id),
+		Outcome:  audit.OutcomeSuccess,
+	}
+	var err error
+	if before != nil {
+		if e.Before, err = json.Marshal(before); err != nil {
+			return e, fmt.Errorf("событие аудита: %w", err)
+		}
+	}
+	if after != nil {
+		if e.After, err = json.Marshal(after); err != nil {
+			return e, fmt.Errorf("событие аудита: %w", err)
+		}
+	}
+	return e, nil
+}
+
+// UserResource - имя пользователя как объекта в журнале аудита
+func UserResource(id int64) string {
+	return "users/" + strconv.FormatInt(id, 10)
+}
+
+// nullJSON передает пустой документ как NULL
+func nullJSON(b json.RawMessage) any {
+	if len(b) == 0 {
+		return nil
+	}
+	return []byte(b)
+}
+
+func (s *PostgresAuditStorage) Record(ctx context.Context, e audit.Event) error {
+	if e.Actor == "" {
+		e.Actor = audit.ActorFromContext(ctx)
+	}
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+	if err := insertAuditEvent(ctx, s.conn(), e); err != nil {
+		return fmt.Errorf("storage.Record: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEvents возвращает страницу событий от новых к старым.
+// Запрашивается на одно событие больше Limit, чтобы узнать, есть ли следующая страница
+func (s *PostgresAuditStorage) ListAuditEvents(ctx context.Context, f AuditFilter) (*AuditPage, error) {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	var (
+		conds []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	for _, c := range []struct {
+		column, value string
+	}{
+		{"actor", f.Actor}, {"action", f.Action}, {"resource", f.Resource},
+		{"outcome", f.Outcome}, {"request_id", f.RequestID},
+	} {
+		if c.value != "" {
+			add(c.column+" = $%d", c.value)
+		}
+	}
+	if !f.Since.IsZero() {
+		add("occurred_at >= $%d", f.Since)
+	}
+	if !f.Until.IsZero() {
+		add("occurred_at < $%d", f.Until)
+	}
+	if f.Before > 0 {
+		add("id < $%d", f.Before)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	args = append(args, f.Limit+1)
+	query := `SELECT id, occurred_at, actor, request_id, action, resource, outcome, reason, before, after
+		FROM audit_events` + where + fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := s.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("storage.ListAuditEvents: %w", err)
+	}
+	defer rows.Close()
+
+	page := &AuditPage{Events: make([]audit.Event, 0, f.Limit+1)}
+	for rows.Next() {
+		var (
+			e             audit.Event
+			before, after []byte
+		)
+		if err := rows.Scan(&e.ID, &e.Time, &e.Actor, &e.RequestID, &e.Action, &e.Resource, &e.Outcome, &e.Reason,
+			&before, &after); err != nil {
+			return nil, fmt.Errorf("storage.ListAuditEvents: ошибка сканирования строки: %w", err)
+		}
+		e.Before, e.After = before, after
+		page.Events = append(page.Events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("storage.ListAuditEvents: ошибка после итерации: %w", err)
+	}
+	if len(page.Events) > f.Limit {
+		page.Events, page.HasNext = page.Events[:f.Limit], true
+	}
+	return page, nil
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/casanera/DlugoshSolutions/internal/audit"
+	"github.com/casanera/DlugoshSolutions/internal/reqctx"
+)
+
+// MockAuditStorage является мок-реализацией AuditStorage для тестов.
+// MockUserStorage пишет в него изменения, если он задан в поле Audit
+type MockAuditStorage struct {
+	Events      []audit.Event // события в порядке записи
+	ReturnError error         // Какую ошибку возвращать
+}
+
+func NewMockAuditStorage() *MockAuditStorage {
+	return &MockAuditStorage{}
+}
+
+func (m *MockAuditStorage) Record(ctx context.Context, e audit.Event) error {
+	if m.ReturnError != nil {
+		return m.ReturnError
+	}
+	if e.Actor == "" {
+		e.Actor = audit.ActorFromContext(ctx)
+	}
+	if e.RequestID == "" {
+		e.RequestID = reqctx.RequestID(ctx)
+	}
+	e.ID = int64(len(m.Events) + 1)
+	e.Time = time.Now()
+	m.Events = append(m.Events, e)
+	return nil
+}
+
+func (m *MockAuditStorage) ListAuditEvents(ctx context.Context, f AuditFilter) (*AuditPage, error) {
+	if m.ReturnError != nil {
+		return nil, m.ReturnError
+	}
+	page := &AuditPage{Events: []audit.Event{}}
+	for i := len(m.Events) - 1; i >= 0; i-- {
+		e := m.Events[i]
+		switch {
+		case f.Actor != "" && e.Actor != f.Actor,
+			f.Action != "" && e.Action != f.Action,
+			f.Resource != "" && e.Resource != f.Resource,
+			f.Outcome != "" && e.Outcome != f.Outcome,
+			f.RequestID != "" && e.RequestID != f.RequestID,
+			!f.Since.IsZero() && e.Time.Before(f.Since),
+			!f.Until.IsZero() && !e.Time.Before(f.Until),
+			f.Before > 0 && e.ID >= f.Before:
+			continue
+		}
+		if len(page.Events) == f.Limit {
+			page.HasNext = true
+			break
+		}
+		page.Events = append(page.Events, e)
+	}
+	return page, nil
+}
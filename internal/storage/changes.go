@@ -0,0 +1,14 @@
+package storage
+
+// UserChanges - набор полей для частичного обновления пользователя.
+// nil означает, что поле не меняется
+type UserChanges struct {
+	Name    *string
+	Email   *string
+	Version int64 // Ожидаемая текущая версия; 0 - без проверки
+}
+
+// IsEmpty сообщает, что ни одно поле не меняется
+func (c UserChanges) IsEmpty() bool {
+	return c.Name == nil && c.Email == nil
+}
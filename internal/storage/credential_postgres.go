@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/casanera/DlugoshSolutions/internal/models"
+)
+
+// CredentialStorage хранит пароли пользователей (только хеши) и счетчики
+// неудачных попыток входа
+type CredentialStorage interface {
+	// SetPassword задает или заменяет пароль и снимает блокировку входа.
+	// Возвращает ErrNotFound, если пользователя нет
+	SetPassword(ctx context.Context, userID int64, hash string) error
+	GetCredentials(ctx context.Context, userID int64) (*models.Credentials, error)
+	// GetCredentialsByEmail возвращает ErrCredentialsNotFound, если нет
+	// пользователя с таким email, он удален или у него не задан пароль
+	GetCredentialsByEmail(ctx context.Context, email string) (*models.Credentials, error)
+	// ReserveLoginAttempt учитывает попытку входа до проверки пароля, поэтому
+	// параллельные попытки не могут проверить больше maxAttempts паролей за
+	// блокировку. maxAttempts-я попытка подряд сразу блокирует вход на lockout
+	// и обнуляет счетчик. Во время блокировки попытка не учитывается
+	ReserveLoginAttempt(ctx context.Context, userID int64, maxAttempts int, lockout time.Duration) (LoginAttempt, error)
+	// RecordLoginSuccess обнуляет счетчик попыток после верного пароля. Пока
+	// действует блокировка, поставленная другой попыткой, ничего не меняет
+	RecordLoginSuccess(ctx context.Context, userID int64, attempt LoginAttempt) error
+}
+
+// LoginAttempt - итог ReserveLoginAttempt
+type LoginAttempt struct {
+	// Allowed - попытка учтена и пароль можно проверять; иначе вход заблокирован
+	Allowed bool
+	// LockedUntil - конец блокировки: действующей (попытка отклонена) или
+	// поставленной этой попыткой; nil - блокировки нет
+	LockedUntil *time.Time
+}
+
+type PostgresCredentialStorage struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+	Logger       *slog.Logger
+
+	tx *sql.Tx // задана у хранилища, полученного из WithTx
+}
+
+func NewPostgresCredentialStorage(db *sql.DB) *PostgresCredentialStorage {
+	return &PostgresCredentialStorage{DB: db, QueryTimeout: DefaultQueryTimeout, Logger: slog.Default()}
+}
+
+func (s *PostgresCredentialStorage) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withQueryTimeout(ctx, s.QueryTimeout)
+}
+
+// conn возвращает транзакцию unit of work, если она задана, иначе пул соединений
+func (s *PostgresCredentialStorage) conn() dbtx {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.DB
+}
+
+func scanCredentials(row rowScanner, c *models.Credentials) error {
+	var locked sql.NullTime
+	err := row.Scan(&c.UserID, &c.PasswordHash, &c.FailedAttempts, &locked)
+	c.LockedUntil = nullTime(locked)
+	return err
+}
+
+func (s *PostgresCredentialStorage) SetPassword(ctx context.Context, userID int64, hash string) error {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	query := `INSERT INTO user_credentials (user_id, password_hash) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET password_hash = EXCLUDED.password_hash, failed_attempts = 0, locked_until = NULL, updated_at = now()`
+	_, err := s.conn().ExecContext(ctx, query, userID, hash)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pgForeignKeyViolation {
+		return fmt.Errorf("storage.SetPassword: ID %d: %w", userID, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("storage.SetPassword: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresCredentialStorage) GetCredentials(ctx context.Context, userID int64) (*models.Credentials, error) {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	c := &models.Credentials{}
+	err := scanCredentials(s.conn().QueryRowContext(ctx,
+		"SELECT user_id, password_hash, failed_attempts, locked_until FROM user_credentials WHERE user_id = $1", userID), c)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("storage.GetCredentials: ID %d: %w", userID, ErrCredentialsNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetCredentials: %w", err)
+	}
+	return c, nil
+}
+
+func (s *PostgresCredentialStorage) GetCredentialsByEmail(ctx context.Context, email string) (*models.Credentials, error) {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	query := `SELECT c.user_id, c.password_hash, c.failed_attempts, c.locked_until
+		FROM user_credentials c JOIN users u ON u.id = c.user_id
+		WHERE u.email = $1 AND u.deleted_at IS NULL`
+	c := &models.Credentials{}
+	err := scanCredentials(s.conn().QueryRowContext(ctx, query, email), c)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("storage.GetCredentialsByEmail: %w", ErrCredentialsNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetCredentialsByEmail: %w", err)
+	}
+	return c, nil
+}
+
+// ReserveLoginAttempt меняет счетчик одним условным UPDATE: из параллельных
+// попыток учитываются только начатые до блокировки, остальные отклоняются
+func (s *PostgresCredentialStorage) ReserveLoginAttempt(ctx context.Context, userID int64, maxAttempts int, lockout time.Duration) (LoginAttempt, error) {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	query := `UPDATE user_credentials SET
+			locked_until = CASE WHEN failed_attempts + 1 >= $2 THEN now() + make_interval(secs => $3) END,
+			failed_attempts = CASE WHEN failed_attempts + 1 >= $2 THEN 0 ELSE failed_attempts + 1 END
+		WHERE user_id = $1 AND (locked_until IS NULL OR locked_until <= now())
+		RETURNING locked_until`
+	for {
+		var locked sql.NullTime
+		err := s.conn().QueryRowContext(ctx, query, userID, maxAttempts, lockout.Seconds()).Scan(&locked)
+		if err == nil {
+			return LoginAttempt{Allowed: true, LockedUntil: nullTime(locked)}, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return LoginAttempt{}, fmt.Errorf("storage.ReserveLoginAttempt: %w", err)
+		}
+		// Строка не изменилась: пароля нет или вход заблокирован
+		err = s.conn().QueryRowContext(ctx, "SELECT locked_until FROM user_credentials WHERE user_id = $1", userID).Scan(&locked)
+		if errors.Is(err, sql.ErrNoRows) {
+			return LoginAttempt{}, fmt.Errorf("storage.ReserveLoginAttempt: ID %d: %w", userID, ErrCredentialsNotFound)
+		}
+		if err != nil {
+			return LoginAttempt{}, fmt.Errorf("storage.ReserveLoginAttempt: %w", err)
+		}
+		if locked.Valid {
+			return LoginAttempt{LockedUntil: &locked.Time}, nil
+		}
+		// Блокировку сняли между запросами - повторяем попытку
+	}
+}
+
+// RecordLoginSuccess снимает только блокировку, которую поставила сама эта
+// попытка (она была последней разрешенной); чужую действующую не трогает
+func (s *PostgresCredentialStorage) RecordLoginSuccess(ctx context.Context, userID int64, attempt LoginAttempt) error {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	var own sql.NullTime
+	if attempt.LockedUntil != nil {
+		own = sql.NullTime{Time: *attempt.LockedUntil, Valid: true}
+	}
+	_, err := s.conn().ExecContext(ctx,
+		`UPDATE user_credentials SET failed_attempts = 0, locked_until = NULL
+		WHERE user_id = $1 AND (failed_attempts <> 0 OR locked_until IS NOT NULL)
+			AND (locked_until IS NULL OR locked_until <= now() OR locked_until = $2)`, userID, own)
+	if err != nil {
+		return fmt.Errorf("storage.RecordLoginSuccess: %w", err)
+	}
+	return nil
+}
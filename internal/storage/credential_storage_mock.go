@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/casanera/DlugoshSolutions/internal/models"
+)
+
+// MockCredentialStorage является мок-реализацией CredentialStorage для тестов.
+// Пользователи по email ищутся в Users
+type MockCredentialStorage struct {
+	Users       *MockUserStorage
+	Credentials map[int64]*models.Credentials // пароли по ID пользователя
+	ReturnError error                         // Какую ошибку возвращать
+
+	mu sync.Mutex // попытки входа в тестах бывают параллельными
+}
+
+func NewMockCredentialStorage(users *MockUserStorage) *MockCredentialStorage {
+	return &MockCredentialStorage{Users: users, Credentials: make(map[int64]*models.Credentials)}
+}
+
+func (m *MockCredentialStorage) SetPassword(ctx context.Context, userID int64, hash string) error {
+	if m.ReturnError != nil {
+		return m.ReturnError
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.Users.Users[userID]; !ok {
+		return fmt.Errorf("мок: SetPassword: ID %d: %w", userID, ErrNotFound)
+	}
+	m.Credentials[userID] = &models.Credentials{UserID: userID, PasswordHash: hash}
+	return nil
+}
+
+func (m *MockCredentialStorage) GetCredentials(ctx context.Context, userID int64) (*models.Credentials, error) {
+	if m.ReturnError != nil {
+		return nil, m.ReturnError
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.get(userID)
+}
+
+func (m *MockCredentialStorage) get(userID int64) (*models.Credentials, error) {
+	c, ok := m.Credentials[userID]
+	if !ok {
+		return nil, fmt.Errorf("мок: GetCredentials: ID %d: %w", userID, ErrCredentialsNotFound)
+	}
+	copied := *c
+	return &copied, nil
+}
+
+func (m *MockCredentialStorage) GetCredentialsByEmail(ctx context.Context, email string) (*models.Credentials, error) {
+	if m.ReturnError != nil {
+		return nil, m.ReturnError
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, u := range m.Users.Users {
+		if u.Email == email {
+			return m.get(id)
+		}
+	}
+	return nil, fmt.Errorf("мок: GetCredentialsByEmail: %w", ErrCredentialsNotFound)
+}
+
+func (m *MockCredentialStorage) ReserveLoginAttempt(ctx context.Context, userID int64, maxAttempts int, lockout time.Duration) (LoginAttempt, error) {
+	if m.ReturnError != nil {
+		return LoginAttempt{}, m.ReturnError
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.Credentials[userID]
+	if !ok {
+		return LoginAttempt{}, fmt.Errorf("мок: ReserveLoginAttempt: ID %d: %w", userID, ErrCredentialsNotFound)
+	}
+	if c.LockedUntil != nil && time.Now().Before(*c.LockedUntil) {
+		until := *c.LockedUntil
+		return LoginAttempt{LockedUntil: &until}, nil
+	}
+	c.FailedAttempts++
+	c.LockedUntil = nil
+	if c.FailedAttempts < maxAttempts {
+		return LoginAttempt{Allowed: true}, nil
+	}
+	until := time.Now().Add(lockout)
+	c.FailedAttempts, c.LockedUntil = 0, &until
+	return LoginAttempt{Allowed: true, LockedUntil: &until}, nil
+}
+
+func (m *MockCredentialStorage) RecordLoginSuccess(ctx context.Context, userID int64, attempt LoginAttempt) error {
+	if m.ReturnError != nil {
+		return m.ReturnError
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.Credentials[userID]
+	if !ok {
+		return nil
+	}
+	if l := c.LockedUntil; l != nil && time.Now().Before(*l) && (attempt.LockedUntil == nil || !l.Equal(*attempt.LockedUntil)) {
+		return nil // блокировку поставила другая попытка
+	}
+	c.FailedAttempts, c.LockedUntil = 0, nil
+	return nil
+}
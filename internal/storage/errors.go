@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/casanera/DlugoshSolutions/internal/models"
+)
+
+// Ошибки хранилища. Обе реализации UserStorage оборачивают их через %w,
+// поэтому вызывающий код проверяет их с помощью errors.Is, а не по тексту
+var (
+	ErrNotFound       = errors.New("пользователь не найден")
+	ErrDuplicateEmail = errors.New("пользователь с таким email уже существует")
+	ErrConflict       = errors.New("конфликт при изменении пользователя")
+
+	// ErrVersionMismatch - частный случай ErrConflict: запись изменилась
+	// после того, как клиент ее прочитал (оптимистичная блокировка)
+	ErrVersionMismatch = fmt.Errorf("%w: версия пользователя изменилась", ErrConflict)
+
+	// ErrNotDeleted - восстановить можно только удаленного пользователя
+	ErrNotDeleted = errors.New("пользователь не удален")
+)
+
+// Ошибки проверки API-ключа
+var (
+	ErrAPIKeyNotFound = errors.New("API-ключ не найден")
+	ErrAPIKeyRevoked  = errors.New("API-ключ отозван")
+	ErrAPIKeyExpired  = errors.New("срок действия API-ключа истек")
+)
+
+// ErrRoleNotFound - роль с таким именем не существует
+var ErrRoleNotFound = errors.New("роль не найдена")
+
+// Ошибки входа по паролю и сессий
+var (
+	ErrCredentialsNotFound = errors.New("пароль пользователя не задан")
+	ErrSessionNotFound     = errors.New("сессия не найдена")
+)
+
+// Ограничения колонок таблицы users (см. db/migrations)
+const (
+	MaxNameLength  = 100
+	MaxEmailLength = 100
+)
+
+// ValidationError сообщает о недопустимом значении поля пользователя
+type ValidationError struct {
+	Field   string // Имя поля в JSON-представлении
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("некорректное поле %s: %s", e.Field, e.Message)
+}
+
+func validateName(name string) error {
+	switch {
+	case strings.TrimSpace(name) == "":
+		return &ValidationError{Field: "name", Message: "не может быть пустым"}
+	case utf8.RuneCountInString(name) > MaxNameLength:
+		return &ValidationError{Field: "name", Message: fmt.Sprintf("длина не может превышать %d символов", MaxNameLength)}
+	}
+	return nil
+}
+
+func validateEmail(email string) error {
+	switch {
+	case strings.TrimSpace(email) == "":
+		return &ValidationError{Field: "email", Message: "не может быть пустым"}
+	case utf8.RuneCountInString(email) > MaxEmailLength:
+		return &ValidationError{Field: "email", Message: fmt.Sprintf("длина не может превышать %d символов", MaxEmailLength)}
+	}
+	return nil
+}
+
+// ValidateUser проверяет, что пользователь может быть сохранен в хранилище
+func ValidateUser(user *models.User) error {
+	if err := validateName(user.Name); err != nil {
+		return err
+	}
+	return validateEmail(user.Email)
+}
+
+// ValidateChanges проверяет только изменяемые поля частичного обновления
+func ValidateChanges(c UserChanges) error {
+	if c.Name != nil {
+		if err := validateName(*c.Name); err != nil {
+			return err
+		}
+	}
+	if c.Email != nil {
+		return validateEmail(*c.Email)
+	}
+	return nil
+}
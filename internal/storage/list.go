@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/casanera/DlugoshSolutions/internal/models"
+)
+
+// UserFilter ограничивает выборку пользователей. Пустые поля не применяются,
+// заданные объединяются через AND
+type UserFilter struct {
+	Email        string // Точное совпадение email
+	EmailPrefix  string // email начинается с
+	EmailSuffix  string // email заканчивается на (например, "@example.com")
+	NameContains string // Подстрока в имени без учета регистра
+	// IncludeDeleted - включать удаленных пользователей, которые еще не удалены окончательно
+	IncludeDeleted bool
+}
+
+// SortField - одно поле сортировки списка
+type SortField struct {
+	Field string // Одно из SortableFields
+	Desc  bool
+}
+
+// SortableFields - белый список полей, по которым разрешена сортировка.
+// Ключ - имя поля в API, значение - колонка таблицы users
+var SortableFields = map[string]string{
+	"id":    "id",
+	"name":  "name",
+	"email": "email",
+}
+
+// ParseSort разбирает строку вида "name,-id": поля через запятую,
+// минус перед полем означает сортировку по убыванию
+func ParseSort(s string) ([]SortField, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var fields []SortField
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		desc := strings.HasPrefix(part, "-")
+		name := strings.TrimPrefix(part, "-")
+		if _, ok := SortableFields[name]; !ok {
+			return nil, fmt.Errorf("сортировка по полю %q не поддерживается", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("поле %q указано в сортировке дважды", name)
+		}
+		seen[name] = true
+		fields = append(fields, SortField{Field: name, Desc: desc})
+	}
+	return fields, nil
+}
+
+// IsDefaultSort сообщает, совпадает ли порядок с порядком по умолчанию (id по возрастанию).
+// Только в этом случае применима курсорная пагинация
+func IsDefaultSort(sort []SortField) bool {
+	return len(sort) == 0 || (len(sort) == 1 && sort[0].Field == "id" && !sort[0].Desc)
+}
+
+// ListParams задает страницу списка пользователей.
+// Используется либо курсор (After/Before - keyset по id), либо смещение Offset.
+// Курсоры допустимы только при сортировке по умолчанию
+type ListParams struct {
+	Limit  int   // Размер страницы, должен быть > 0
+	After  int64 // Вернуть пользователей с id > After
+	Before int64 // Вернуть пользователей с id < Before (страница "назад")
+	Offset int   // Смещение для постраничной навигации page/per_page
+	Filter UserFilter
+	Sort   []SortField // Пусто - по id; id всегда добавляется последним для стабильного порядка
+}
+
+// UserPage - одна страница списка пользователей
+type UserPage struct {
+	Users   []models.User
+	Total   int64 // Общее количество пользователей, подходящих под фильтр
+	HasNext bool  // Есть ли пользователи после последнего на странице
+	HasPrev bool  // Есть ли пользователи перед первым на странице
+}
+
+// fillPage раскладывает выборку из Limit+1 строк по странице.
+// Для Before строки приходят в обратном порядке и разворачиваются
+func fillPage(page *UserPage, users []models.User, params ListParams) {
+	hasMore := len(users) > params.Limit
+	if hasMore {
+		users = users[:params.Limit]
+	}
+	switch {
+	case params.After > 0:
+		page.HasNext = hasMore
+		page.HasPrev = true
+	case params.Before > 0:
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+		page.HasNext = true
+		page.HasPrev = hasMore
+	default:
+		page.HasNext = hasMore
+		page.HasPrev = params.Offset > 0
+	}
+	page.Users = users
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/casanera/DlugoshSolutions/internal/models"
+)
+
+const pgForeignKeyViolation = "23503"
+
+// RoleStorage хранит роли и их назначение пользователям
+type RoleStorage interface {
+	ListRoles(ctx context.Context) ([]models.Role, error)
+	// UserRoles возвращает имена ролей пользователя
+	UserRoles(ctx context.Context, userID int64) ([]string, error)
+	// UserPermissions возвращает объединение разрешений всех ролей пользователя.
+	// У удаленного пользователя разрешений нет
+	UserPermissions(ctx context.Context, userID int64) ([]string, error)
+	// GrantRole назначает роль; повторное назначение не считается ошибкой.
+	// Возвращает ErrNotFound или ErrRoleNotFound
+	GrantRole(ctx context.Context, userID int64, role string) error
+	// RevokeRole снимает роль; снятие неназначенной роли не считается ошибкой
+	RevokeRole(ctx context.Context, userID int64, role string) error
+}
+
+type PostgresRoleStorage struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+	Logger       *slog.Logger
+
+	tx *sql.Tx // задана у хранилища, полученного из WithTx
+}
+
+func NewPostgresRoleStorage(db *sql.DB) *PostgresRoleStorage {
+	return &PostgresRoleStorage{DB: db, QueryTimeout: DefaultQueryTimeout, Logger: slog.Default()}
+}
+
+func (s *PostgresRoleStorage) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withQueryTimeout(ctx, s.QueryTimeout)
+}
+
+// conn возвращает транзакцию unit of work, если она задана, иначе пул соединений
+func (s *PostgresRoleStorage) conn() dbtx {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.DB
+}
+
+func (s *PostgresRoleStorage) ListRoles(ctx context.Context) ([]models.Role, error) {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	rows, err := s.conn().QueryContext(ctx, "SELECT name, description, permissions FROM roles ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("storage.ListRoles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		var r models.Role
+		if err := rows.Scan(&r.Name, &r.Description, pq.Array(&r.Permissions)); err != nil {
+			return nil, fmt.Errorf("storage.ListRoles: ошибка сканирования строки: %w", err)
+		}
+		roles = append(roles, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("storage.ListRoles: ошибка после итерации: %w", err)
+	}
+	return roles, nil
+}
+
+func (s *PostgresRoleStorage) UserRoles(ctx context.Context, userID int64) ([]string, error) {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	var roles []string
+	err := s.conn().QueryRowContext(ctx,
+		"SELECT COALESCE(array_agg(role ORDER BY role), '{}') FROM user_roles WHERE user_id = $1", userID).
+		Scan(pq.Array(&roles))
+	if err != nil {
+		return nil, fmt.Errorf("storage.UserRoles: ID %d: %w", userID, err)
+	}
+	return roles, nil
+}
+
+func (s *PostgresRoleStorage) UserPermissions(ctx context.Context, userID int64) ([]string, error) {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	query := `SELECT COALESCE(array_agg(DISTINCT p ORDER BY p), '{}')
+		FROM user_roles ur
+		JOIN roles r ON r.name = ur.role
+		JOIN users u ON u.id = ur.user_id AND u.deleted_at IS NULL
+		CROSS JOIN LATERAL unnest(r.permissions) AS p
+		WHERE ur.user_id = $1`
+	var perms []string
+	if err := s.conn().QueryRowContext(ctx, query, userID).Scan(pq.Array(&perms)); err != nil {
+		return nil, fmt.Errorf("storage.UserPermissions: ID %d: %w", userID, err)
+	}
+	return perms, nil
+}
+
+func (s *PostgresRoleStorage) GrantRole(ctx context.Context, userID int64, role string) error {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	_, err := s.conn().ExecContext(ctx,
+		"INSERT INTO user_roles (user_id, role) VALUES ($1, $2) ON CONFLICT DO NOTHING", userID, role)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pgForeignKeyViolation {
+		// Какая из ссылок нарушена, видно по имени ограничения
+		if pqErr.Constraint == "user_roles_role_fkey" {
+			return fmt.Errorf("storage.GrantRole: %q: %w", role, ErrRoleNotFound)
+		}
+		return fmt.Errorf("storage.GrantRole: ID %d: %w", userID, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("storage.GrantRole: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresRoleStorage) RevokeRole(ctx context.Context, userID int64, role string) error {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	if _, err := s.conn().ExecContext(ctx, "DELETE FROM user_roles WHERE user_id = $1 AND role = $2", userID, role); err != nil {
+		return fmt.Errorf("storage.RevokeRole: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/casanera/DlugoshSolutions/internal/models"
+)
+
+// MockRoleStorage является мок-реализацией RoleStorage для тестов.
+// Роли по умолчанию совпадают с создаваемыми миграцией 004
+type MockRoleStorage struct {
+	Roles       map[string]models.Role
+	Assigned    map[int64][]string // роли по ID пользователя
+	ReturnError error              // Какую ошибку возвращать
+}
+
+func NewMockRoleStorage() *MockRoleStorage {
+	return &MockRoleStorage{
+		Roles: map[string]models.Role{
+			"admin":    {Name: "admin", Permissions: []string{"users:read", "users:write", "users:delete"}},
+			"operator": {Name: "operator", Permissions: []string{"users:read"}},
+			"user":     {Name: "user", Permissions: []string{"users:read:self", "users:write:self"}},
+		},
+		Assigned: make(map[int64][]string),
+	}
+}
+
+func (m *MockRoleStorage) ListRoles(ctx context.Context) ([]models.Role, error) {
+	if m.ReturnError != nil {
+		return nil, m.ReturnError
+	}
+	roles := make([]models.Role, 0, len(m.Roles))
+	for _, r := range m.Roles {
+		roles = append(roles, r)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+func (m *MockRoleStorage) UserRoles(ctx context.Context, userID int64) ([]string, error) {
+	if m.ReturnError != nil {
+		return nil, m.ReturnError
+	}
+	roles := slices.Clone(m.Assigned[userID])
+	slices.Sort(roles)
+	return roles, nil
+}
+
+func (m *MockRoleStorage) UserPermissions(ctx context.Context, userID int64) ([]string, error) {
+	if m.ReturnError != nil {
+		return nil, m.ReturnError
+	}
+	perms := []string{}
+	for _, role := range m.Assigned[userID] {
+		perms = append(perms, m.Roles[role].Permissions...)
+	}
+	slices.Sort(perms)
+	return slices.Compact(perms), nil
+}
+
+func (m *MockRoleStorage) GrantRole(ctx context.Context, userID int64, role string) error {
+	if m.ReturnError != nil {
+		return m.ReturnError
+	}
+	if _, ok := m.Roles[role]; !ok {
+		return fmt.Errorf("мок: GrantRole: %q: %w", role, ErrRoleNotFound)
+	}
+	if !slices.Contains(m.Assigned[userID], role) {
+		m.Assigned[userID] = append(m.Assigned[userID], role)
+	}
+	return nil
+}
+
+func (m *MockRoleStorage) RevokeRole(ctx context.Context, userID int64, role string) error {
+	if m.ReturnError != nil {
+		return m.ReturnError
+	}
+	m.Assigned[userID] = slices.DeleteFunc(m.Assigned[userID], func(r string) bool { return r == role })
+	return nil
+}
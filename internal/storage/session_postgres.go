@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/casanera/DlugoshSolutions/internal/models"
+)
+
+// SessionStorage хранит серверные сессии пользователей по хешу идентификатора
+type SessionStorage interface {
+	CreateSession(ctx context.Context, idHash string, session *models.Session) error
+	// GetSession возвращает сессию или ErrSessionNotFound. Сроки действия
+	// проверяет вызывающий код
+	GetSession(ctx context.Context, idHash string) (*models.Session, error)
+	// TouchSession отмечает активность в сессии (продлевает срок бездействия)
+	TouchSession(ctx context.Context, idHash string) error
+	DeleteSession(ctx context.Context, idHash string) error
+	// DeleteUserSessions завершает все сессии пользователя, кроме exceptHash
+	DeleteUserSessions(ctx context.Context, userID int64, exceptHash string) error
+	// DeleteExpiredSessions удаляет сессии с истекшим абсолютным сроком
+	// или без активности дольше idle. Возвращает число удаленных
+	DeleteExpiredSessions(ctx context.Context, idle time.Duration) (int64, error)
+}
+
+type PostgresSessionStorage struct {
+	DB           *sql.DB
+	QueryTimeout time.Duration
+	Logger       *slog.Logger
+
+	tx *sql.Tx // задана у хранилища, полученного из WithTx
+}
+
+func NewPostgresSessionStorage(db *sql.DB) *PostgresSessionStorage {
+	return &PostgresSessionStorage{DB: db, QueryTimeout: DefaultQueryTimeout, Logger: slog.Default()}
+}
+
+func (s *PostgresSessionStorage) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withQueryTimeout(ctx, s.QueryTimeout)
+}
+
+// conn возвращает транзакцию unit of work, если она задана, иначе пул соединений
+func (s *PostgresSessionStorage) conn() dbtx {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.DB
+}
+
+// CreateSession сохраняет сессию; CreatedAt и LastSeenAt заполняются из БД
+func (s *PostgresSessionStorage) CreateSession(ctx context.Context, idHash string, session *models.Session) error {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	query := `INSERT INTO sessions (id_hash, user_id, csrf_token, expires_at)
+		VALUES ($1, $2, $3, $4) RETURNING created_at, last_seen_at`
+	err := s.conn().QueryRowContext(ctx, query, idHash, session.UserID, session.CSRFToken, session.ExpiresAt).
+		Scan(&session.CreatedAt, &session.LastSeenAt)
+	if err != nil {
+		return fmt.Errorf("storage.CreateSession: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresSessionStorage) GetSession(ctx context.Context, idHash string) (*models.Session, error) {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	session := &models.Session{}
+	err := s.conn().QueryRowContext(ctx,
+		"SELECT user_id, csrf_token, created_at, last_seen_at, expires_at FROM sessions WHERE id_hash = $1", idHash).
+		Scan(&session.UserID, &session.CSRFToken, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("storage.GetSession: %w", ErrSessionNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage.GetSession: %w", err)
+	}
+	return session, nil
+}
+
+func (s *PostgresSessionStorage) TouchSession(ctx context.Context, idHash string) error {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	if _, err := s.conn().ExecContext(ctx, "UPDATE sessions SET last_seen_at = now() WHERE id_hash = $1", idHash); err != nil {
+		return fmt.Errorf("storage.TouchSession: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresSessionStorage) DeleteSession(ctx context.Context, idHash string) error {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	if _, err := s.conn().ExecContext(ctx, "DELETE FROM sessions WHERE id_hash = $1", idHash); err != nil {
+		return fmt.Errorf("storage.DeleteSession: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresSessionStorage) DeleteUserSessions(ctx context.Context, userID int64, exceptHash string) error {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	if _, err := s.conn().ExecContext(ctx, "DELETE FROM sessions WHERE user_id = $1 AND id_hash <> $2", userID, exceptHash); err != nil {
+		return fmt.Errorf("storage.DeleteUserSessions: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresSessionStorage) DeleteExpiredSessions(ctx context.Context, idle time.Duration) (int64, error) {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	result, err := s.conn().ExecContext(ctx,
+		"DELETE FROM sessions WHERE expires_at <= now() OR last_seen_at <= now() - make_interval(secs => $1)", idle.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("storage.DeleteExpiredSessions: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("storage.DeleteExpiredSessions: не удалось получить количество удаленных строк: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/casanera/DlugoshSolutions/internal/models"
+)
+
+// MockSessionStorage является мок-реализацией SessionStorage для тестов
+type MockSessionStorage struct {
+	Sessions    map[string]*models.Session // сессии по хешу идентификатора
+	ReturnError error                      // Какую ошибку возвращать
+}
+
+func NewMockSessionStorage() *MockSessionStorage {
+	return &MockSessionStorage{Sessions: make(map[string]*models.Session)}
+}
+
+func (m *MockSessionStorage) CreateSession(ctx context.Context, idHash string, session *models.Session) error {
+	if m.ReturnError != nil {
+		return m.ReturnError
+	}
+	now := time.Now()
+	session.CreatedAt, session.LastSeenAt = now, now
+	stored := *session
+	m.Sessions[idHash] = &stored
+	return nil
+}
+
+func (m *MockSessionStorage) GetSession(ctx context.Context, idHash string) (*models.Session, error) {
+	if m.ReturnError != nil {
+		return nil, m.ReturnError
+	}
+	s, ok := m.Sessions[idHash]
+	if !ok {
+		return nil, fmt.Errorf("мок: GetSession: %w", ErrSessionNotFound)
+	}
+	copied := *s
+	return &copied, nil
+}
+
+func (m *MockSessionStorage) TouchSession(ctx context.Context, idHash string) error {
+	if m.ReturnError != nil {
+		return m.ReturnError
+	}
+	if s, ok := m.Sessions[idHash]; ok {
+		s.LastSeenAt = time.Now()
+	}
+	return nil
+}
+
+func (m *MockSessionStorage) DeleteSession(ctx context.Context, idHash string) error {
+	if m.ReturnError != nil {
+		return m.ReturnError
+	}
+	delete(m.Sessions, idHash)
+	return nil
+}
+
+func (m *MockSessionStorage) DeleteUserSessions(ctx context.Context, userID int64, exceptHash string) error {
+	if m.ReturnError != nil {
+		return m.ReturnError
+	}
+	for hash, s := range m.Sessions {
+		if s.UserID == userID && hash != exceptHash {
+			delete(m.Sessions, hash)
+		}
+	}
+	return nil
+}
+
+func (m *MockSessionStorage) DeleteExpiredSessions(ctx context.Context, idle time.Duration) (int64, error) {
+	if m.ReturnError != nil {
+		return 0, m.ReturnError
+	}
+	now := time.Now()
+	var n int64
+	for hash, s := range m.Sessions {
+		if !now.Before(s.ExpiresAt) || !now.Before(s.LastSeenAt.Add(idle)) {
+			delete(m.Sessions, hash)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// pgSerializationFailure - код ошибки PostgreSQL, когда транзакцию нельзя
+// сериализовать с параллельными; ее можно повторить целиком
+const pgSerializationFailure = "40001"
+
+// DefaultTxRetries - сколько раз WithTx повторяет транзакцию после ошибки сериализации
+const DefaultTxRetries = 3
+
+// txRetryDelay - пауза перед первым повтором; каждая следующая вдвое длиннее
+const txRetryDelay = 10 * time.Millisecond
+
+// ErrSerialization - транзакция не прошла из-за параллельных изменений и
+// после всех повторов. Это конфликт: клиент может повторить запрос
+var ErrSerialization = fmt.Errorf("%w: транзакция конфликтует с параллельными изменениями", ErrConflict)
+
+// Store - хранилища, работающие в одной транзакции unit of work
+type Store interface {
+	Users() UserStorage
+	Roles() RoleStorage
+	Credentials() CredentialStorage
+	Sessions() SessionStorage
+	Audit() AuditStorage
+}
+
+// TxOptions - параметры транзакции unit of work
+type TxOptions struct {
+	// Isolation - уровень изоляции; sql.LevelDefault - уровень сервера (READ COMMITTED)
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+}
+
+// Transactor выполняет unit of work: fn получает хранилища, разделяющие одну
+// транзакцию. Ошибка fn откатывает все изменения, иначе они фиксируются вместе.
+// При ошибке сериализации fn вызывается повторно с начала, поэтому fn должна
+// быть повторяемой: все ее входные данные готовы до WithTx (а не читаются из
+// однократного потока вроде тела запроса), состояние вне хранилищ каждый вызов
+// собирает заново, а побочные эффекты (ответ клиенту, внешние вызовы)
+// выполняются после WithTx
+type Transactor interface {
+	WithTx(ctx context.Context, opts TxOptions, fn func(tx Store) error) error
+}
+
+// dbtx - общий интерфейс *sql.DB и *sql.Tx
+type dbtx interface {
+	execer
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// isSerializationFailure сообщает, можно ли исправить ошибку повтором транзакции
+func isSerializationFailure(err error) bool {
+	var pqErr *pq.Error
+	return errors.Is(err, ErrSerialization) || errors.As(err, &pqErr) && pqErr.Code == pgSerializationFailure
+}
+
+// retryTx выполняет attempt и повторяет его не более retries раз, пока он
+// завершается ошибкой сериализации. Пауза между попытками растет вдвое и
+// случайно растягивается, чтобы конкурирующие транзакции не столкнулись снова
+func retryTx(ctx context.Context, retries int, logger *slog.Logger, attempt func() error) error {
+	for i := 0; ; i++ {
+		err := attempt()
+		if err == nil || !isSerializationFailure(err) {
+			return err
+		}
+		if !errors.Is(err, ErrSerialization) {
+			err = fmt.Errorf("%w: %w", ErrSerialization, err)
+		}
+		if i >= retries {
+			return err
+		}
+		delay := txRetryDelay << i
+		delay += rand.N(delay)
+		if logger != nil {
+			logger.LogAttrs(ctx, slog.LevelDebug, "повтор транзакции после ошибки сериализации",
+				slog.Int("attempt", i+1), slog.Duration("delay", delay))
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// inSavepoint выполняет fn в точке сохранения транзакции tx: ошибка fn
+// откатывает только ее изменения, и транзакцию можно продолжать
+func inSavepoint(ctx context.Context, tx *sql.Tx, fn func(tx *sql.Tx) error) error {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT storage_op"); err != nil {
+		return fmt.Errorf("точка сохранения: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		if _, rbErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT storage_op"); rbErr != nil {
+			return errors.Join(err, fmt.Errorf("откат к точке сохранения: %w", rbErr))
+		}
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT storage_op"); err != nil {
+		return fmt.Errorf("освобождение точки сохранения: %w", err)
+	}
+	return nil
+}
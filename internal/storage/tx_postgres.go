@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// PostgresStore выполняет unit of work в транзакции PostgreSQL. Хранилища
+// внутри транзакции - копии заданных здесь, с их таймаутами, журналом и метриками
+type PostgresStore struct {
+	DB          *sql.DB
+	Users       *PostgresUserStorage
+	Roles       *PostgresRoleStorage
+	Credentials *PostgresCredentialStorage
+	Sessions    *PostgresSessionStorage
+	Audit       *PostgresAuditStorage
+	MaxRetries  int // Повторы после ошибки сериализации
+	Logger      *slog.Logger
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{
+		DB:          db,
+		Users:       NewPostgresUserStorage(db),
+		Roles:       NewPostgresRoleStorage(db),
+		Credentials: NewPostgresCredentialStorage(db),
+		Sessions:    NewPostgresSessionStorage(db),
+		Audit:       NewPostgresAuditStorage(db),
+		MaxRetries:  DefaultTxRetries,
+		Logger:      slog.Default(),
+	}
+}
+
+// WithTx выполняет fn в транзакции с уровнем изоляции opts.Isolation. Ошибка
+// сериализации (SQLSTATE 40001), в том числе при фиксации, повторяет
+// транзакцию целиком до MaxRetries раз
+func (s *PostgresStore) WithTx(ctx context.Context, opts TxOptions, fn func(tx Store) error) error {
+	err := retryTx(ctx, s.MaxRetries, s.Logger, func() error {
+		tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+		if err != nil {
+			return fmt.Errorf("начало транзакции: %w", err)
+		}
+		if err := fn(s.bind(tx)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("фиксация транзакции: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("storage.WithTx: %w", err)
+	}
+	return nil
+}
+
+// bind возвращает копии хранилищ, выполняющие запросы в транзакции tx
+func (s *PostgresStore) bind(tx *sql.Tx) Store {
+	users, roles, credentials, sessions, audit := *s.Users, *s.Roles, *s.Credentials, *s.Sessions, *s.Audit
+	users.tx, roles.tx, credentials.tx, sessions.tx, audit.tx = tx, tx, tx, tx, tx
+	return &postgresTxStore{users: &users, roles: &roles, credentials: &credentials, sessions: &sessions, audit: &audit}
+}
+
+type postgresTxStore struct {
+	users       *PostgresUserStorage
+	roles       *PostgresRoleStorage
+	credentials *PostgresCredentialStorage
+	sessions    *PostgresSessionStorage
+	audit       *PostgresAuditStorage
+}
+
+func (s *postgresTxStore) Users() UserStorage             { return s.users }
+func (s *postgresTxStore) Roles() RoleStorage             { return s.roles }
+func (s *postgresTxStore) Credentials() CredentialStorage { return s.credentials }
+func (s *postgresTxStore) Sessions() SessionStorage       { return s.sessions }
+func (s *postgresTxStore) Audit() AuditStorage            { return s.audit }
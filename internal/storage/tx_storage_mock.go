@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/casanera/DlugoshSolutions/internal/models"
+)
+
+// MockStore является мок-реализацией Transactor для тестов. Транзакции
+// выполняются по одной (как при SERIALIZABLE), ошибка fn возвращает
+// хранилища в состояние до транзакции
+type MockStore struct {
+	Users       *MockUserStorage
+	Roles       *MockRoleStorage
+	Credentials *MockCredentialStorage
+	Sessions    *MockSessionStorage
+	Audit       *MockAuditStorage
+	// SerializationFailures - сколько следующих фиксаций завершатся ошибкой
+	// сериализации; изменения при этом откатываются, как в PostgreSQL
+	SerializationFailures int
+	MaxRetries            int
+	Calls                 int // Сколько раз вызывалась fn, включая повторы
+
+	mu sync.Mutex
+}
+
+func NewMockStore() *MockStore {
+	users := NewMockUserStorage()
+	users.Audit = NewMockAuditStorage()
+	return &MockStore{
+		Users:       users,
+		Roles:       NewMockRoleStorage(),
+		Credentials: NewMockCredentialStorage(users),
+		Sessions:    NewMockSessionStorage(),
+		Audit:       users.Audit,
+		MaxRetries:  DefaultTxRetries,
+	}
+}
+
+func (m *MockStore) WithTx(ctx context.Context, opts TxOptions, fn func(tx Store) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err := retryTx(ctx, m.MaxRetries, nil, func() error {
+		m.Calls++
+		restore := m.snapshot()
+		if err := fn(mockTxStore{m}); err != nil {
+			restore()
+			return err
+		}
+		if m.SerializationFailures > 0 {
+			m.SerializationFailures--
+			restore()
+			return ErrSerialization
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("мок: WithTx: %w", err)
+	}
+	return nil
+}
+
+// snapshot запоминает состояние хранилищ и возвращает функцию его восстановления
+func (m *MockStore) snapshot() (restore func()) {
+	restores := []func(){m.Users.snapshot(), m.Roles.snapshot(), m.Credentials.snapshot(), m.Sessions.snapshot()}
+	if m.Audit != m.Users.Audit {
+		restores = append(restores, m.Audit.snapshot())
+	}
+	return func() {
+		for _, r := range restores {
+			r()
+		}
+	}
+}
+
+type mockTxStore struct{ m *MockStore }
+
+func (s mockTxStore) Users() UserStorage             { return s.m.Users }
+func (s mockTxStore) Roles() RoleStorage             { return s.m.Roles }
+func (s mockTxStore) Credentials() CredentialStorage { return s.m.Credentials }
+func (s mockTxStore) Sessions() SessionStorage       { return s.m.Sessions }
+func (s mockTxStore) Audit() AuditStorage            { return s.m.Audit }
+
+func (m *MockUserStorage) snapshot() func() {
+	users := make(map[int64]*models.User, len(m.Users))
+	for id, u := range m.Users {
+		copied := *u
+		users[id] = &copied
+	}
+	nextID := m.NextID
+	restoreAudit := func() {}
+	if m.Audit != nil {
+		restoreAudit = m.Audit.snapshot()
+	}
+	return func() {
+		m.Users, m.NextID = users, nextID
+		restoreAudit()
+	}
+}
+
+func (m *MockAuditStorage) snapshot() func() {
+	n := len(m.Events)
+	return func() { m.Events = m.Events[:n] }
+}
+
+func (m *MockRoleStorage) snapshot() func() {
+	assigned := make(map[int64][]string, len(m.Assigned))
+	for id, roles := range m.Assigned {
+		assigned[id] = append([]string(nil), roles...)
+	}
+	return func() { m.Assigned = assigned }
+}
+
+func (m *MockCredentialStorage) snapshot() func() {
+	credentials := make(map[int64]*models.Credentials, len(m.Credentials))
+	for id, c := range m.Credentials {
+		copied := *c
+		credentials[id] = &copied
+	}
+	return func() { m.Credentials = credentials }
+}
+
+func (m *MockSessionStorage) snapshot() func() {
+	sessions := make(map[string]*models.Session, len(m.Sessions))
+	for hash, s := range m.Sessions {
+		copied := *s
+		sessions[hash] = &copied
+	}
+	return func() { m.Sessions = sessions }
+}
@@ -0,0 +1,251 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lib/pq"
+
+	"github.com/casanera/DlugoshSolutions/internal/models"
+)
+
+func TestRetryTx(t *testing.T) {
+	errOther := errors.New("нарушение ограничения")
+	serialization := &pq.Error{Code: pgSerializationFailure}
+	testCases := []struct {
+		name          string
+		retries       int
+		errs          []error // ошибки попыток по порядку; дальше - успех
+		cancel        bool    // отменить контекст после первой попытки
+		expectedCalls int
+		expectedErr   error
+	}{
+		{"Успех с первой попытки", 3, nil, false, 1, nil},
+		{"Другая ошибка не повторяется", 3, []error{errOther}, false, 1, errOther},
+		{"Ошибка 40001 повторяется", 3, []error{serialization, serialization}, false, 3, nil},
+		{"ErrSerialization повторяется", 3, []error{ErrSerialization}, false, 2, nil},
+		{"Повторы исчерпаны", 2, []error{serialization, serialization, serialization, serialization}, false, 3, ErrSerialization},
+		{"Без повторов", 0, []error{serialization}, false, 1, ErrSerialization},
+		{"Отмена контекста прекращает повторы", 3, []error{serialization, serialization}, true, 1, ErrSerialization},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			calls := 0
+			err := retryTx(ctx, tc.retries, nil, func() error {
+				calls++
+				if tc.cancel {
+					cancel()
+				}
+				if calls <= len(tc.errs) {
+					return tc.errs[calls-1]
+				}
+				return nil
+			})
+			if calls != tc.expectedCalls {
+				t.Errorf("Попыток %d, ожидалось %d", calls, tc.expectedCalls)
+			}
+			if !errors.Is(err, tc.expectedErr) || (tc.expectedErr == nil) != (err == nil) {
+				t.Fatalf("Ошибка %v, ожидалась %v", err, tc.expectedErr)
+			}
+			if errors.Is(err, ErrSerialization) && !errors.Is(err, ErrConflict) {
+				t.Error("ErrSerialization должна быть конфликтом")
+			}
+			var pqErr *pq.Error
+			if tc.expectedErr == ErrSerialization && len(tc.errs) > 0 && tc.errs[0] == serialization && !errors.As(err, &pqErr) {
+				t.Error("Исходная ошибка PostgreSQL потеряна")
+			}
+		})
+	}
+}
+
+func TestMockStoreWithTx(t *testing.T) {
+	newStore := func() *MockStore {
+		store := NewMockStore()
+		store.Users.Users[1] = &models.User{ID: 1, Name: "Alice", Email: "alice@example.com", Version: 1}
+		store.Users.NextID = 2
+		return store
+	}
+	create := func(tx Store) error {
+		_, err := tx.Users().CreateUser(context.Background(), &models.User{Name: "Bob", Email: "bob@example.com"})
+		return err
+	}
+	errFn := errors.New("ошибка unit of work")
+
+	testCases := []struct {
+		name           string
+		failures       int // SerializationFailures
+		fn             func(tx Store) error
+		expectedErr    error
+		expectedCalls  int
+		expectedUsers  int
+		expectedEvents int
+	}{
+		{"Фиксация", 0, create, nil, 1, 2, 1},
+		{"Ошибка fn откатывает изменения", 0, func(tx Store) error {
+			if err := create(tx); err != nil {
+				return err
+			}
+			tx.Users().DeleteUser(context.Background(), 1, 0)
+			return errFn
+		}, errFn, 1, 1, 0},
+		{"Повтор после ошибки сериализации", 2, create, nil, 3, 2, 1},
+		{"Повторы исчерпаны", DefaultTxRetries + 1, create, ErrSerialization, DefaultTxRetries + 1, 1, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newStore()
+			store.SerializationFailures = tc.failures
+			err := store.WithTx(context.Background(), TxOptions{}, tc.fn)
+			if !errors.Is(err, tc.expectedErr) || (tc.expectedErr == nil) != (err == nil) {
+				t.Fatalf("Ошибка %v, ожидалась %v", err, tc.expectedErr)
+			}
+			if store.Calls != tc.expectedCalls {
+				t.Errorf("Вызовов fn %d, ожидалось %d", store.Calls, tc.expectedCalls)
+			}
+			if len(store.Users.Users) != tc.expectedUsers || len(store.Audit.Events) != tc.expectedEvents {
+				t.Errorf("Пользователей %d, событий %d; ожидалось %d и %d",
+					len(store.Users.Users), len(store.Audit.Events), tc.expectedUsers, tc.expectedEvents)
+			}
+			if u := store.Users.Users[1]; u == nil || u.DeletedAt != nil {
+				t.Error("Откат не восстановил удаленного пользователя")
+			}
+		})
+	}
+}
+
+func TestPostgresStoreWithTx(t *testing.T) {
+	errFn := errors.New("ошибка unit of work")
+	testCases := []struct {
+		name        string
+		opts        TxOptions
+		commitErrs  []error
+		fn          func(tx Store) error
+		expectedErr error
+		expectedLog string
+	}{
+		{"Фиксация с параметрами транзакции", TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true}, nil,
+			func(tx Store) error { return nil }, nil,
+			"BEGIN serializable ro; COMMIT"},
+		{"Ошибка fn откатывает транзакцию", TxOptions{}, nil,
+			func(tx Store) error { return errFn }, errFn,
+			"BEGIN default rw; ROLLBACK"},
+		{"Ошибка сериализации при фиксации повторяет транзакцию", TxOptions{Isolation: sql.LevelRepeatableRead},
+			[]error{&pq.Error{Code: pgSerializationFailure}}, func(tx Store) error { return nil }, nil,
+			"BEGIN repeatable-read rw; COMMIT; BEGIN repeatable-read rw; COMMIT"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := &fakeConn{commitErrs: tc.commitErrs}
+			db := sql.OpenDB(conn)
+			defer db.Close()
+			err := NewPostgresStore(db).WithTx(context.Background(), tc.opts, tc.fn)
+			if !errors.Is(err, tc.expectedErr) || (tc.expectedErr == nil) != (err == nil) {
+				t.Fatalf("Ошибка %v, ожидалась %v", err, tc.expectedErr)
+			}
+			if got := conn.String(); got != tc.expectedLog {
+				t.Errorf("Команды %q, ожидались %q", got, tc.expectedLog)
+			}
+		})
+	}
+}
+
+func TestInSavepoint(t *testing.T) {
+	errOp := errors.New("дубликат email")
+	conn := &fakeConn{}
+	db := sql.OpenDB(conn)
+	defer db.Close()
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := inSavepoint(ctx, tx, func(tx *sql.Tx) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := inSavepoint(ctx, tx, func(tx *sql.Tx) error { return errOp }); !errors.Is(err, errOp) {
+		t.Fatalf("Ошибка %v, ожидалась %v", err, errOp)
+	}
+	tx.Commit()
+	expected := "BEGIN default rw; SAVEPOINT storage_op; RELEASE SAVEPOINT storage_op; " +
+		"SAVEPOINT storage_op; ROLLBACK TO SAVEPOINT storage_op; COMMIT"
+	if got := conn.String(); got != expected {
+		t.Errorf("Команды %q, ожидались %q", got, expected)
+	}
+}
+
+// fakeConn - соединение database/sql, которое только записывает команды.
+// Реализует и driver.Connector, чтобы открыть *sql.DB без регистрации драйвера
+type fakeConn struct {
+	mu         sync.Mutex
+	log        []string
+	commitErrs []error // ошибки следующих фиксаций
+}
+
+func (c *fakeConn) record(s string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.log = append(c.log, s)
+}
+
+func (c *fakeConn) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return strings.Join(c.log, "; ")
+}
+
+func (c *fakeConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c *fakeConn) Driver() driver.Driver                        { return fakeDriver{c} }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("fakeConn: Prepare не поддерживается")
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	mode := "rw"
+	if opts.ReadOnly {
+		mode = "ro"
+	}
+	level := strings.ToLower(strings.ReplaceAll(sql.IsolationLevel(opts.Isolation).String(), " ", "-"))
+	c.record(fmt.Sprintf("BEGIN %s %s", level, mode))
+	return fakeTx{c}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.record(query)
+	return driver.RowsAffected(0), nil
+}
+
+type fakeTx struct{ c *fakeConn }
+
+func (tx fakeTx) Commit() error {
+	tx.c.record("COMMIT")
+	tx.c.mu.Lock()
+	defer tx.c.mu.Unlock()
+	if len(tx.c.commitErrs) == 0 {
+		return nil
+	}
+	err := tx.c.commitErrs[0]
+	tx.c.commitErrs = tx.c.commitErrs[1:]
+	return err
+}
+
+func (tx fakeTx) Rollback() error {
+	tx.c.record("ROLLBACK")
+	return nil
+}
+
+type fakeDriver struct{ c *fakeConn }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return d.c, nil }
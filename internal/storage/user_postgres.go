@@ -1,67 +1,361 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
+	"time"
 
+	"github.com/lib/pq"
+
+	"github.com/casanera/DlugoshSolutions/internal/audit"
+	"github.com/casanera/DlugoshSolutions/internal/logging"
 	"github.com/casanera/DlugoshSolutions/internal/models"
 )
 
+// pgUniqueViolation - код ошибки PostgreSQL при нарушении ограничения UNIQUE
+const pgUniqueViolation = "23505"
+
+// DefaultQueryTimeout ограничивает длительность одного запроса к БД,
+// если вызывающий код не задал более короткий дедлайн
+const DefaultQueryTimeout = 5 * time.Second
+
+// UserStorage описывает хранилище пользователей.
+// Все методы принимают контекст запроса: при его отмене (клиент отключился,
+// истек дедлайн) выполнение запроса к БД прерывается
 type UserStorage interface {
-	CreateUser(user *models.User) (int64, error)
-	GetUserByID(id int64) (*models.User, error)
-	GetAllUsers() ([]models.User, error)
-	UpdateUser(user *models.User) error
-	DeleteUser(id int64) error
+	CreateUser(ctx context.Context, user *models.User) (int64, error)
+	// CreateUsers добавляет пользователей пакетом. Созданным задаются ID и
+	// Version; пользователь с занятым email (в том числе ранее в этом же
+	// пакете) пропускается, его ID остается 0
+	CreateUsers(ctx context.Context, users []*models.User) error
+	GetUserByID(ctx context.Context, id int64) (*models.User, error)
+	GetAllUsers(ctx context.Context) ([]models.User, error)
+	ListUsers(ctx context.Context, params ListParams) (*UserPage, error)
+	UpdateUser(ctx context.Context, user *models.User) error
+	PatchUser(ctx context.Context, id int64, changes UserChanges) (*models.User, error)
+	// DeleteUser помечает пользователя удаленным. version > 0 - ожидаемая текущая версия
+	DeleteUser(ctx context.Context, id int64, version int64) error
+	// GetUserIncludingDeleted получает пользователя по ID, даже если он удален
+	GetUserIncludingDeleted(ctx context.Context, id int64) (*models.User, error)
+	// RestoreUser снимает пометку об удалении. version > 0 - ожидаемая текущая версия
+	RestoreUser(ctx context.Context, id int64, version int64) (*models.User, error)
+	// PurgeDeletedUsers окончательно удаляет пользователей, удаленных раньше
+	// before, и возвращает их количество
+	PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error)
+}
+
+// userColumns - колонки, из которых собирается models.User (см. scanUser)
+const userColumns = "id, name, email, version, deleted_at"
+
+// notDeleted - условие на неудаленных пользователей. Удаленные видны только
+// через GetUserIncludingDeleted и фильтр IncludeDeleted
+const notDeleted = "deleted_at IS NULL"
+
+// rowScanner - общий интерфейс *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row rowScanner, u *models.User) error {
+	return row.Scan(&u.ID, &u.Name, &u.Email, &u.Version, &u.DeletedAt)
+}
+
+// Observer получает длительность и результат каждой операции хранилища
+// (например, для метрик). op - имя метода UserStorage
+type Observer interface {
+	ObserveOp(op string, d time.Duration, err error)
 }
 
 type PostgresUserStorage struct {
-	DB *sql.DB
+	DB           *sql.DB
+	QueryTimeout time.Duration // Дедлайн на один запрос; 0 - без дополнительного ограничения
+	Logger       *slog.Logger
+	Observer     Observer // Необязателен
+
+	tx *sql.Tx // задана у хранилища, полученного из WithTx
 }
 
 func NewPostgresUserStorage(db *sql.DB) *PostgresUserStorage {
-	return &PostgresUserStorage{DB: db}
+	return &PostgresUserStorage{DB: db, QueryTimeout: DefaultQueryTimeout, Logger: slog.Default()}
+}
+
+// finishOp вызывается через defer в конце каждой операции: передает ее
+// длительность в Observer и пишет запись в журнал. Успех и ожидаемые ошибки
+// (не найден, конфликт, валидация, отмена клиентом) пишутся с уровнем DEBUG -
+// их журналирует обработчик, таймаут - WARN, остальные ошибки - ERROR.
+// errp читается в момент выхода из метода
+func (s *PostgresUserStorage) finishOp(ctx context.Context, op string, start time.Time, errp *error, attrs ...slog.Attr) {
+	elapsed := time.Since(start)
+	if s.Observer != nil {
+		s.Observer.ObserveOp(op, elapsed, *errp)
+	}
+
+	logger := s.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	level := slog.LevelDebug
+	attrs = append(attrs, slog.String("op", op), slog.Duration("duration", elapsed))
+	if err := *errp; err != nil {
+		attrs = append(attrs, logging.Err(err))
+		var validationErr *ValidationError
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			level = slog.LevelWarn
+		case errors.Is(err, ErrNotFound), errors.Is(err, ErrConflict), errors.Is(err, ErrDuplicateEmail), errors.Is(err, ErrNotDeleted),
+			errors.Is(err, context.Canceled), errors.As(err, &validationErr):
+		default:
+			level = slog.LevelError
+		}
+	}
+	logger.LogAttrs(ctx, level, "запрос к хранилищу", attrs...)
+}
+
+// translateError заменяет ошибки драйвера на ошибки хранилища.
+// Единственный уникальный индекс в таблице users - на email неудаленных пользователей
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pgUniqueViolation {
+		return fmt.Errorf("%w (%s)", ErrDuplicateEmail, pqErr.Constraint)
+	}
+	return err
+}
+
+// withQueryTimeout навешивает на контекст запроса дедлайн timeout (0 - без дедлайна)
+func withQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// queryContext навешивает на контекст запроса дедлайн QueryTimeout
+func (s *PostgresUserStorage) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withQueryTimeout(ctx, s.QueryTimeout)
+}
+
+// conn возвращает транзакцию unit of work, если она задана, иначе пул соединений
+func (s *PostgresUserStorage) conn() dbtx {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.DB
+}
+
+// inTx выполняет fn в транзакции. Ошибка fn откатывает транзакцию.
+// Внутри WithTx fn выполняется в точке сохранения общей транзакции: ошибка
+// откатывает только изменения fn, а фиксирует их WithTx
+func (s *PostgresUserStorage) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if s.tx != nil {
+		return inSavepoint(ctx, s.tx, fn)
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("начало транзакции: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("фиксация транзакции: %w", err)
+	}
+	return nil
+}
+
+// lockUser читает пользователя и блокирует его строку до конца транзакции,
+// чтобы состояние "до" в журнале аудита совпало с тем, что изменяется.
+// version > 0 - ожидаемая текущая версия. Удаленный пользователь блокируется,
+// только если deleted равно true
+func lockUser(ctx context.Context, tx *sql.Tx, id, version int64, deleted bool) (*models.User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE id = $1 AND " + notDeleted + " FOR UPDATE"
+	if deleted {
+		query = "SELECT " + userColumns + " FROM users WHERE id = $1 FOR UPDATE"
+	}
+	user := &models.User{}
+	err := scanUser(tx.QueryRowContext(ctx, query, id), user)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, ErrNotFound
+	case err != nil:
+		return nil, err
+	case version > 0 && user.Version != version:
+		return nil, ErrVersionMismatch
+	}
+	return user, nil
+}
+
+// recordUserChange пишет изменение пользователя в журнал аудита в транзакции tx
+func recordUserChange(ctx context.Context, tx *sql.Tx, action string, id int64, before, after *models.User) error {
+	e, err := userEvent(ctx, action, id, before, after)
+	if err != nil {
+		return err
+	}
+	return insertAuditEvent(ctx, tx, e)
 }
 
 // CreateUser добавляет нового пользователя в базу данных
 // Возвращает ID созданного пользователя или ошибку
-func (s *PostgresUserStorage) CreateUser(user *models.User) (int64, error) {
-	query := "INSERT INTO users (name, email) VALUES ($1, $2) RETURNING id"
-	var id int64
-	err := s.DB.QueryRow(query, user.Name, user.Email).Scan(&id)
+func (s *PostgresUserStorage) CreateUser(ctx context.Context, user *models.User) (id int64, err error) {
+	defer s.finishOp(ctx, "CreateUser", time.Now(), &err)
+	if err := ValidateUser(user); err != nil {
+		return 0, fmt.Errorf("storage.CreateUser: %w", err)
+	}
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	var version int64
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		query := "INSERT INTO users (name, email) VALUES ($1, $2) RETURNING id, version"
+		if err := tx.QueryRowContext(ctx, query, user.Name, user.Email).Scan(&id, &version); err != nil {
+			return translateError(err)
+		}
+		return recordUserChange(ctx, tx, "users.create", id, nil, &models.User{ID: id, Name: user.Name, Email: user.Email, Version: version})
+	})
 	if err != nil {
 		return 0, fmt.Errorf("storage.CreateUser: %w", err)
 	}
+	user.Version = version
 	return id, nil
 }
 
-// GetUserByID получает пользователя по ID
-func (s *PostgresUserStorage) GetUserByID(id int64) (*models.User, error) {
-	query := "SELECT id, name, email FROM users WHERE id = $1"
+// createChunkSize - строк в одном INSERT при пакетном создании. На строку
+// приходится 2 параметра, а на событие аудита - 8; PostgreSQL принимает не
+// больше 65535 параметров в запросе
+const createChunkSize = 1000
+
+// CreateUsers вставляет пользователей многострочными INSERT по createChunkSize
+// строк. Занятые email пропускаются через ON CONFLICT DO NOTHING, поэтому
+// дубликат не прерывает транзакцию. Дедлайн QueryTimeout действует на каждую порцию
+func (s *PostgresUserStorage) CreateUsers(ctx context.Context, users []*models.User) (err error) {
+	defer s.finishOp(ctx, "CreateUsers", time.Now(), &err, slog.Int("count", len(users)))
+	for _, u := range users {
+		if err := ValidateUser(u); err != nil {
+			return fmt.Errorf("storage.CreateUsers: %w", err)
+		}
+	}
+
+	// Из повторяющихся в пакете email создается только первый
+	seen := make(map[string]bool, len(users))
+	batch := make([]*models.User, 0, len(users))
+	for _, u := range users {
+		u.ID, u.Version = 0, 0
+		if !seen[u.Email] {
+			seen[u.Email] = true
+			batch = append(batch, u)
+		}
+	}
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		for start := 0; start < len(batch); start += createChunkSize {
+			if err := s.insertUsers(ctx, tx, batch[start:min(start+createChunkSize, len(batch))]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		for _, u := range batch {
+			u.ID, u.Version = 0, 0
+		}
+		return fmt.Errorf("storage.CreateUsers: %w", err)
+	}
+	return nil
+}
+
+// insertUsers вставляет одну порцию пользователей с уникальными email и
+// записывает их создание в журнал аудита
+func (s *PostgresUserStorage) insertUsers(ctx context.Context, tx *sql.Tx, users []*models.User) error {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	values := make([]string, 0, len(users))
+	args := make([]any, 0, 2*len(users))
+	byEmail := make(map[string]*models.User, len(users))
+	for _, u := range users {
+		args = append(args, u.Name, u.Email)
+		values = append(values, fmt.Sprintf("($%d, $%d)", len(args)-1, len(args)))
+		byEmail[u.Email] = u
+	}
+	// Условие WHERE выбирает частичный уникальный индекс users_email_active_key
+	query := "INSERT INTO users (name, email) VALUES " + strings.Join(values, ", ") +
+		" ON CONFLICT (email) WHERE " + notDeleted + " DO NOTHING RETURNING " + userColumns
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	var created []models.User
+	for rows.Next() {
+		var u models.User
+		if err := scanUser(rows, &u); err != nil {
+			rows.Close()
+			return fmt.Errorf("ошибка сканирования строки: %w", err)
+		}
+		created = append(created, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка после итерации: %w", err)
+	}
+
+	events := make([]audit.Event, 0, len(created))
+	for i := range created {
+		u := byEmail[created[i].Email]
+		u.ID, u.Version = created[i].ID, created[i].Version
+		e, err := userEvent(ctx, "users.create", u.ID, nil, &created[i])
+		if err != nil {
+			return err
+		}
+		events = append(events, e)
+	}
+	return insertAuditEvents(ctx, tx, events)
+}
+
+// GetUserByID получает пользователя по ID. Удаленный пользователь не находится
+func (s *PostgresUserStorage) GetUserByID(ctx context.Context, id int64) (user *models.User, err error) {
+	defer s.finishOp(ctx, "GetUserByID", time.Now(), &err, slog.Int64("user_id", id))
+	return s.getUser(ctx, "storage.GetUserByID", "SELECT "+userColumns+" FROM users WHERE id = $1 AND "+notDeleted, id)
+}
+
+func (s *PostgresUserStorage) GetUserIncludingDeleted(ctx context.Context, id int64) (user *models.User, err error) {
+	defer s.finishOp(ctx, "GetUserIncludingDeleted", time.Now(), &err, slog.Int64("user_id", id))
+	return s.getUser(ctx, "storage.GetUserIncludingDeleted", "SELECT "+userColumns+" FROM users WHERE id = $1", id)
+}
+
+func (s *PostgresUserStorage) getUser(ctx context.Context, op, query string, id int64) (*models.User, error) {
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
 	user := &models.User{}
-	err := s.DB.QueryRow(query, id).Scan(&user.ID, &user.Name, &user.Email)
+	err := scanUser(s.conn().QueryRowContext(ctx, query, id), user)
 	if err != nil {
-		if err == sql.ErrNoRows { // спец ошибка, если запись не найдена
-			return nil, fmt.Errorf("storage.GetUserByID: пользователь не найден: %w", err)
+		if errors.Is(err, sql.ErrNoRows) { // спец ошибка, если запись не найдена
+			return nil, fmt.Errorf("%s: ID %d: %w", op, id, ErrNotFound)
 		}
-		return nil, fmt.Errorf("storage.GetUserByID: %w", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 	return user, nil
 }
 
-// получает всех пользователей.
-func (s *PostgresUserStorage) GetAllUsers() ([]models.User, error) {
-	query := "SELECT id, name, email FROM users ORDER BY id ASC"
-	rows, err := s.DB.Query(query)
+// получает всех неудаленных пользователей.
+func (s *PostgresUserStorage) GetAllUsers(ctx context.Context) (users []models.User, err error) {
+	defer s.finishOp(ctx, "GetAllUsers", time.Now(), &err)
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	query := "SELECT " + userColumns + " FROM users WHERE " + notDeleted + " ORDER BY id ASC"
+	rows, err := s.conn().QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("storage.GetAllUsers: %w", err)
 	}
 	defer rows.Close()
 
-	var users []models.User
 	for rows.Next() {
 		var u models.User
-		if err := rows.Scan(&u.ID, &u.Name, &u.Email); err != nil {
+		if err := scanUser(rows, &u); err != nil {
 			return nil, fmt.Errorf("storage.GetAllUsers: ошибка сканирования строки: %w", err)
 		}
 		users = append(users, u)
@@ -74,34 +368,300 @@ func (s *PostgresUserStorage) GetAllUsers() ([]models.User, error) {
 	return users, nil
 }
 
-func (s *PostgresUserStorage) UpdateUser(user *models.User) error {
-	query := "UPDATE users SET name = $1, email = $2 WHERE id = $3"
-	result, err := s.DB.Exec(query, user.Name, user.Email, user.ID)
+// escapeLike экранирует спецсимволы шаблона LIKE, чтобы пользовательский ввод
+// сравнивался буквально
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// whereClause строит условие WHERE по фильтру. Значения передаются только
+// через параметры запроса; args дополняется, нумерация продолжается с len(args)+1
+func whereClause(f UserFilter, args []any) (string, []any) {
+	var conds []string
+	if !f.IncludeDeleted {
+		conds = append(conds, notDeleted)
+	}
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.Email != "" {
+		add("email = $%d", f.Email)
+	}
+	if f.EmailPrefix != "" {
+		add("email LIKE $%d", escapeLike(f.EmailPrefix)+"%")
+	}
+	if f.EmailSuffix != "" {
+		add("email LIKE $%d", "%"+escapeLike(f.EmailSuffix))
+	}
+	if f.NameContains != "" {
+		add("name ILIKE $%d", "%"+escapeLike(f.NameContains)+"%")
+	}
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// orderClause строит ORDER BY из белого списка полей. id добавляется
+// последним, чтобы порядок был однозначным при совпадающих значениях
+func orderClause(sort []SortField, reverse bool) string {
+	var parts []string
+	hasID := false
+	for _, f := range sort {
+		desc := f.Desc != reverse
+		dir := "ASC"
+		if desc {
+			dir = "DESC"
+		}
+		parts = append(parts, SortableFields[f.Field]+" "+dir)
+		hasID = hasID || f.Field == "id"
+	}
+	if !hasID {
+		dir := "ASC"
+		if reverse {
+			dir = "DESC"
+		}
+		parts = append(parts, "id "+dir)
+	}
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
+
+// ListUsers возвращает страницу пользователей, подходящих под фильтр.
+// Запрашивается на одну строку больше Limit, чтобы узнать, есть ли следующая страница
+func (s *PostgresUserStorage) ListUsers(ctx context.Context, params ListParams) (page *UserPage, err error) {
+	defer s.finishOp(ctx, "ListUsers", time.Now(), &err)
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	where, args := whereClause(params.Filter, nil)
+
+	page = &UserPage{}
+	if err := s.conn().QueryRowContext(ctx, "SELECT count(*) FROM users"+where, args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("storage.ListUsers: подсчет пользователей: %w", err)
+	}
+
+	keyset := ""
+	reverse := false
+	switch {
+	case params.After > 0:
+		args = append(args, params.After)
+		keyset = fmt.Sprintf("id > $%d", len(args))
+	case params.Before > 0:
+		// Идем назад от курсора, затем разворачиваем результат
+		args = append(args, params.Before)
+		keyset = fmt.Sprintf("id < $%d", len(args))
+		reverse = true
+	}
+	if keyset != "" {
+		if where == "" {
+			where = " WHERE " + keyset
+		} else {
+			where += " AND " + keyset
+		}
+	}
+
+	args = append(args, params.Limit+1, params.Offset)
+	query := "SELECT " + userColumns + " FROM users" + where + orderClause(params.Sort, reverse) +
+		fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := s.conn().QueryContext(ctx, query, args...)
 	if err != nil {
+		return nil, fmt.Errorf("storage.ListUsers: %w", err)
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0, params.Limit+1)
+	for rows.Next() {
+		var u models.User
+		if err := scanUser(rows, &u); err != nil {
+			return nil, fmt.Errorf("storage.ListUsers: ошибка сканирования строки: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("storage.ListUsers: ошибка после итерации: %w", err)
+	}
+
+	fillPage(page, users, params)
+	return page, nil
+}
+
+// UpdateUser перезаписывает имя и email пользователя. Если user.Version > 0,
+// обновление выполняется только при совпадении версии (compare-and-swap).
+// После успешного обновления user.Version содержит новую версию
+func (s *PostgresUserStorage) UpdateUser(ctx context.Context, user *models.User) (err error) {
+	defer s.finishOp(ctx, "UpdateUser", time.Now(), &err, slog.Int64("user_id", user.ID))
+	if err := ValidateUser(user); err != nil {
 		return fmt.Errorf("storage.UpdateUser: %w", err)
 	}
-	rowsAffected, err := result.RowsAffected()
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	var version int64
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockUser(ctx, tx, user.ID, user.Version, false)
+		if err != nil {
+			return err
+		}
+		query := "UPDATE users SET name = $1, email = $2, version = version + 1 WHERE id = $3 RETURNING version"
+		if err := tx.QueryRowContext(ctx, query, user.Name, user.Email, user.ID).Scan(&version); err != nil {
+			return translateError(err)
+		}
+		return recordUserChange(ctx, tx, "users.update", user.ID, before,
+			&models.User{ID: user.ID, Name: user.Name, Email: user.Email, Version: version})
+	})
 	if err != nil {
-		return fmt.Errorf("storage.UpdateUser: не удалось получить количество измененных строк: %w", err)
-	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("storage.UpdateUser: пользователь с ID %d не найден для обновления", user.ID)
+		return fmt.Errorf("storage.UpdateUser: ID %d: %w", user.ID, err)
 	}
+	user.Version = version
 	return nil
 }
 
-func (s *PostgresUserStorage) DeleteUser(id int64) error {
-	query := "DELETE FROM users WHERE id = $1"
-	result, err := s.DB.Exec(query, id)
-	if err != nil {
-		return fmt.Errorf("storage.DeleteUser: %w", err)
+// PatchUser обновляет только переданные в changes колонки и возвращает
+// пользователя в актуальном состоянии
+func (s *PostgresUserStorage) PatchUser(ctx context.Context, id int64, changes UserChanges) (user *models.User, err error) {
+	defer s.finishOp(ctx, "PatchUser", time.Now(), &err, slog.Int64("user_id", id))
+	if err := ValidateChanges(changes); err != nil {
+		return nil, fmt.Errorf("storage.PatchUser: %w", err)
+	}
+	if changes.IsEmpty() {
+		user, err := s.GetUserByID(ctx, id)
+		if err == nil && changes.Version > 0 && user.Version != changes.Version {
+			err = fmt.Errorf("storage.PatchUser: ID %d: %w", id, ErrVersionMismatch)
+		}
+		return user, err
+	}
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	var (
+		sets []string
+		args []any
+	)
+	if changes.Name != nil {
+		args = append(args, *changes.Name)
+		sets = append(sets, fmt.Sprintf("name = $%d", len(args)))
 	}
-	rowsAffected, err := result.RowsAffected()
+	if changes.Email != nil {
+		args = append(args, *changes.Email)
+		sets = append(sets, fmt.Sprintf("email = $%d", len(args)))
+	}
+	args = append(args, id)
+	query := fmt.Sprintf("UPDATE users SET %s, version = version + 1 WHERE id = $%d RETURNING %s",
+		strings.Join(sets, ", "), len(args), userColumns)
+
+	user = &models.User{}
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockUser(ctx, tx, id, changes.Version, false)
+		if err != nil {
+			return err
+		}
+		if err := scanUser(tx.QueryRowContext(ctx, query, args...), user); err != nil {
+			return translateError(err)
+		}
+		return recordUserChange(ctx, tx, "users.patch", id, before, user)
+	})
 	if err != nil {
-		return fmt.Errorf("storage.DeleteUser: не удалось получить количество удаленных строк: %w", err)
+		return nil, fmt.Errorf("storage.PatchUser: ID %d: %w", id, err)
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("storage.DeleteUser: пользователь с ID %d не найден для удаления", id)
+	return user, nil
+}
+
+// DeleteUser помечает пользователя удаленным и завершает его сессии. Строка
+// остается в таблице до PurgeDeletedUsers, ее email можно занять снова
+func (s *PostgresUserStorage) DeleteUser(ctx context.Context, id int64, version int64) (err error) {
+	defer s.finishOp(ctx, "DeleteUser", time.Now(), &err, slog.Int64("user_id", id))
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockUser(ctx, tx, id, version, false)
+		if err != nil {
+			return err
+		}
+		after := &models.User{}
+		query := "UPDATE users SET deleted_at = now(), version = version + 1 WHERE id = $1 RETURNING " + userColumns
+		if err := scanUser(tx.QueryRowContext(ctx, query, id), after); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE user_id = $1", id); err != nil {
+			return err
+		}
+		return recordUserChange(ctx, tx, "users.delete", id, before, after)
+	})
+	if err != nil {
+		return fmt.Errorf("storage.DeleteUser: ID %d: %w", id, err)
 	}
 	return nil
 }
+
+// RestoreUser снимает пометку об удалении и возвращает пользователя.
+// Если email за время удаления занял другой пользователь, возвращается ErrDuplicateEmail
+func (s *PostgresUserStorage) RestoreUser(ctx context.Context, id int64, version int64) (user *models.User, err error) {
+	defer s.finishOp(ctx, "RestoreUser", time.Now(), &err, slog.Int64("user_id", id))
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	user = &models.User{}
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockUser(ctx, tx, id, version, true)
+		if err != nil {
+			return err
+		}
+		if before.DeletedAt == nil {
+			return ErrNotDeleted
+		}
+		query := "UPDATE users SET deleted_at = NULL, version = version + 1 WHERE id = $1 RETURNING " + userColumns
+		if err := scanUser(tx.QueryRowContext(ctx, query, id), user); err != nil {
+			return translateError(err)
+		}
+		return recordUserChange(ctx, tx, "users.restore", id, before, user)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage.RestoreUser: ID %d: %w", id, err)
+	}
+	return user, nil
+}
+
+// PurgeDeletedUsers окончательно удаляет пользователей, удаленных раньше
+// before, вместе с их ролями, паролями и сессиями (ON DELETE CASCADE).
+// Каждое удаление записывается в журнал аудита, история пользователя сохраняется
+func (s *PostgresUserStorage) PurgeDeletedUsers(ctx context.Context, before time.Time) (n int64, err error) {
+	defer s.finishOp(ctx, "PurgeDeletedUsers", time.Now(), &err)
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
+
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, "DELETE FROM users WHERE deleted_at < $1 RETURNING "+userColumns, before)
+		if err != nil {
+			return err
+		}
+		var purged []models.User
+		for rows.Next() {
+			var u models.User
+			if err := scanUser(rows, &u); err != nil {
+				rows.Close()
+				return fmt.Errorf("ошибка сканирования строки: %w", err)
+			}
+			purged = append(purged, u)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("ошибка после итерации: %w", err)
+		}
+		// Запросы в транзакции выполняются по одному, поэтому события
+		// пишутся после того, как прочитан весь результат DELETE
+		for i := range purged {
+			if err := recordUserChange(ctx, tx, "users.purge", purged[i].ID, &purged[i], nil); err != nil {
+				return err
+			}
+		}
+		n = int64(len(purged))
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("storage.PurgeDeletedUsers: %w", err)
+	}
+	return n, nil
+}
@@ -1,7 +1,11 @@
 package storage
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/casanera/DlugoshSolutions/internal/models"
 )
@@ -11,10 +15,13 @@ type MockUserStorage struct {
 	Users         map[int64]*models.User // хранилище пользователей в памяти для мока
 	NextID        int64                  // Для генерации ID
 	ReturnError   error                  // Какую ошибку возвращать
+	Delay         time.Duration          // Искусственная задержка, имитирующая медленный запрос к БД
 	UpdateCalled  bool                   // Флаг, что метод UpdateUser был вызван
 	DeleteCalled  bool                   // Флаг, что метод DeleteUser был вызван
+	PatchArg      *UserChanges           // Аргумент, с которым был вызван PatchUser
 	GetByIDArg    int64                  // Аргумент, с которым был вызван GetUserByID
 	CreateUserArg *models.User           // Аргумент, с которым был вызван CreateUser
+	Audit         *MockAuditStorage      // Журнал изменений; nil - изменения не журналируются
 }
 
 // создает новый экземпляр MockUserStorage.
@@ -25,64 +32,392 @@ func NewMockUserStorage() *MockUserStorage {
 	}
 }
 
-func (m *MockUserStorage) CreateUser(user *models.User) (int64, error) {
+// wait имитирует выполнение запроса: выдерживает Delay и прерывается,
+// если контекст отменен раньше, как это делает драйвер БД
+func (m *MockUserStorage) wait(ctx context.Context) error {
+	if m.Delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(m.Delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// emailTaken сообщает, занят ли email другим неудаленным пользователем
+// (аналог уникального индекса в БД)
+func (m *MockUserStorage) emailTaken(email string, exceptID int64) bool {
+	for id, u := range m.Users {
+		if id != exceptID && u.DeletedAt == nil && u.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// active возвращает неудаленного пользователя
+func (m *MockUserStorage) active(id int64) (*models.User, bool) {
+	user, exists := m.Users[id]
+	if !exists || user.DeletedAt != nil {
+		return nil, false
+	}
+	return user, true
+}
+
+// record пишет изменение в Audit до применения к Users: ошибка журнала
+// отменяет изменение, как откат транзакции в PostgresUserStorage
+func (m *MockUserStorage) record(ctx context.Context, action string, id int64, before, after *models.User) error {
+	if m.Audit == nil {
+		return nil
+	}
+	e, err := userEvent(ctx, action, id, before, after)
+	if err != nil {
+		return err
+	}
+	return m.Audit.Record(ctx, e)
+}
+
+func (m *MockUserStorage) CreateUser(ctx context.Context, user *models.User) (int64, error) {
 	m.CreateUserArg = user // Сохраняем аргумент для проверки в тесте
+	if err := m.wait(ctx); err != nil {
+		return 0, fmt.Errorf("мок: CreateUser: %w", err)
+	}
 	if m.ReturnError != nil {
 		return 0, m.ReturnError
 	}
+	if err := ValidateUser(user); err != nil {
+		return 0, fmt.Errorf("мок: CreateUser: %w", err)
+	}
 	if user.Name == "error_user" {
 		return 0, fmt.Errorf("мок: ошибка при создании error_user")
 	}
+	if m.emailTaken(user.Email, 0) {
+		return 0, fmt.Errorf("мок: CreateUser: %w", ErrDuplicateEmail)
+	}
 	newID := m.NextID
+	if err := m.record(ctx, "users.create", newID, nil, &models.User{ID: newID, Name: user.Name, Email: user.Email, Version: 1}); err != nil {
+		return 0, fmt.Errorf("мок: CreateUser: %w", err)
+	}
 	m.NextID++
 	user.ID = newID
+	user.Version = 1
 	m.Users[newID] = user
 	return newID, nil
 }
 
-func (m *MockUserStorage) GetUserByID(id int64) (*models.User, error) {
+func (m *MockUserStorage) CreateUsers(ctx context.Context, users []*models.User) error {
+	if err := m.wait(ctx); err != nil {
+		return fmt.Errorf("мок: CreateUsers: %w", err)
+	}
+	if m.ReturnError != nil {
+		return m.ReturnError
+	}
+	for _, u := range users {
+		if err := ValidateUser(u); err != nil {
+			return fmt.Errorf("мок: CreateUsers: %w", err)
+		}
+	}
+	for _, u := range users {
+		u.ID, u.Version = 0, 0
+		if m.emailTaken(u.Email, 0) {
+			continue
+		}
+		stored := *u
+		stored.ID, stored.Version = m.NextID, 1
+		if err := m.record(ctx, "users.create", stored.ID, nil, &stored); err != nil {
+			return fmt.Errorf("мок: CreateUsers: %w", err)
+		}
+		m.NextID++
+		m.Users[stored.ID] = &stored
+		u.ID, u.Version = stored.ID, stored.Version
+	}
+	return nil
+}
+
+func (m *MockUserStorage) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
 	m.GetByIDArg = id // Сохраняем аргумент
+	if err := m.wait(ctx); err != nil {
+		return nil, fmt.Errorf("мок: GetUserByID: %w", err)
+	}
+	if m.ReturnError != nil {
+		return nil, m.ReturnError
+	}
+	user, exists := m.active(id)
+	if !exists {
+		return nil, fmt.Errorf("мок: GetUserByID: ID %d: %w", id, ErrNotFound)
+	}
+	return user, nil
+}
+
+func (m *MockUserStorage) GetUserIncludingDeleted(ctx context.Context, id int64) (*models.User, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, fmt.Errorf("мок: GetUserIncludingDeleted: %w", err)
+	}
 	if m.ReturnError != nil {
 		return nil, m.ReturnError
 	}
 	user, exists := m.Users[id]
 	if !exists {
-		return nil, fmt.Errorf("storage.GetUserByID: пользователь не найден")
+		return nil, fmt.Errorf("мок: GetUserIncludingDeleted: ID %d: %w", id, ErrNotFound)
 	}
 	return user, nil
 }
 
-func (m *MockUserStorage) GetAllUsers() ([]models.User, error) {
+func (m *MockUserStorage) GetAllUsers(ctx context.Context) ([]models.User, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, fmt.Errorf("мок: GetAllUsers: %w", err)
+	}
 	if m.ReturnError != nil {
 		return nil, m.ReturnError
 	}
 	var usersList []models.User
 	for _, user := range m.Users {
-		usersList = append(usersList, *user)
+		if user.DeletedAt == nil {
+			usersList = append(usersList, *user)
+		}
 	}
 	return usersList, nil
 }
 
-func (m *MockUserStorage) UpdateUser(user *models.User) error {
+// matchesFilter вычисляет UserFilter в памяти так же, как это делает SQL в PostgresUserStorage
+func matchesFilter(u models.User, f UserFilter) bool {
+	switch {
+	case !f.IncludeDeleted && u.DeletedAt != nil:
+		return false
+	case f.Email != "" && u.Email != f.Email:
+		return false
+	case f.EmailPrefix != "" && !strings.HasPrefix(u.Email, f.EmailPrefix):
+		return false
+	case f.EmailSuffix != "" && !strings.HasSuffix(u.Email, f.EmailSuffix):
+		return false
+	case f.NameContains != "" && !strings.Contains(strings.ToLower(u.Name), strings.ToLower(f.NameContains)):
+		return false
+	}
+	return true
+}
+
+// sortUsers упорядочивает пользователей по полям сортировки с id в конце
+func sortUsers(users []models.User, fields []SortField) {
+	sort.SliceStable(users, func(i, j int) bool {
+		a, b := users[i], users[j]
+		for _, f := range fields {
+			var cmp int
+			switch f.Field {
+			case "id":
+				cmp = cmpInt64(a.ID, b.ID)
+			case "name":
+				cmp = strings.Compare(a.Name, b.Name)
+			case "email":
+				cmp = strings.Compare(a.Email, b.Email)
+			}
+			if cmp != 0 {
+				return (cmp < 0) != f.Desc
+			}
+		}
+		return a.ID < b.ID
+	})
+}
+
+func cmpInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (m *MockUserStorage) ListUsers(ctx context.Context, params ListParams) (*UserPage, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, fmt.Errorf("мок: ListUsers: %w", err)
+	}
+	if m.ReturnError != nil {
+		return nil, m.ReturnError
+	}
+
+	all := make([]models.User, 0, len(m.Users))
+	for _, user := range m.Users {
+		if matchesFilter(*user, params.Filter) {
+			all = append(all, *user)
+		}
+	}
+	sortUsers(all, params.Sort)
+
+	// Та же выборка "Limit+1 строк", что и в PostgresUserStorage
+	var selected []models.User
+	switch {
+	case params.After > 0:
+		for _, u := range all {
+			if u.ID > params.After && len(selected) <= params.Limit {
+				selected = append(selected, u)
+			}
+		}
+	case params.Before > 0:
+		for i := len(all) - 1; i >= 0; i-- {
+			if all[i].ID < params.Before && len(selected) <= params.Limit {
+				selected = append(selected, all[i])
+			}
+		}
+	default:
+		for i := params.Offset; i < len(all) && len(selected) <= params.Limit; i++ {
+			selected = append(selected, all[i])
+		}
+	}
+
+	page := &UserPage{Total: int64(len(all))}
+	fillPage(page, selected, params)
+	return page, nil
+}
+
+func (m *MockUserStorage) UpdateUser(ctx context.Context, user *models.User) error {
 	m.UpdateCalled = true // Фиксируем вызов
+	if err := m.wait(ctx); err != nil {
+		return fmt.Errorf("мок: UpdateUser: %w", err)
+	}
 	if m.ReturnError != nil {
 		return m.ReturnError
 	}
-	if _, exists := m.Users[user.ID]; !exists {
-		return fmt.Errorf("мок: пользователь с ID %d не найден для обновления", user.ID)
+	if err := ValidateUser(user); err != nil {
+		return fmt.Errorf("мок: UpdateUser: %w", err)
+	}
+	current, exists := m.active(user.ID)
+	if !exists {
+		return fmt.Errorf("мок: UpdateUser: ID %d: %w", user.ID, ErrNotFound)
+	}
+	if user.Version > 0 && user.Version != current.Version {
+		return fmt.Errorf("мок: UpdateUser: ID %d: %w", user.ID, ErrVersionMismatch)
+	}
+	if m.emailTaken(user.Email, user.ID) {
+		return fmt.Errorf("мок: UpdateUser: %w", ErrDuplicateEmail)
+	}
+	stored := *user
+	stored.Version = current.Version + 1
+	if err := m.record(ctx, "users.update", user.ID, current, &stored); err != nil {
+		return fmt.Errorf("мок: UpdateUser: %w", err)
 	}
-	m.Users[user.ID] = user
+	user.Version = stored.Version
+	m.Users[user.ID] = &stored
 	return nil
 }
 
-func (m *MockUserStorage) DeleteUser(id int64) error {
+func (m *MockUserStorage) PatchUser(ctx context.Context, id int64, changes UserChanges) (*models.User, error) {
+	m.PatchArg = &changes // Сохраняем аргумент
+	if err := m.wait(ctx); err != nil {
+		return nil, fmt.Errorf("мок: PatchUser: %w", err)
+	}
+	if m.ReturnError != nil {
+		return nil, m.ReturnError
+	}
+	if err := ValidateChanges(changes); err != nil {
+		return nil, fmt.Errorf("мок: PatchUser: %w", err)
+	}
+	user, exists := m.active(id)
+	if !exists {
+		return nil, fmt.Errorf("мок: PatchUser: ID %d: %w", id, ErrNotFound)
+	}
+	if changes.Version > 0 && changes.Version != user.Version {
+		return nil, fmt.Errorf("мок: PatchUser: ID %d: %w", id, ErrVersionMismatch)
+	}
+	if changes.IsEmpty() {
+		current := *user
+		return &current, nil
+	}
+	if changes.Email != nil && m.emailTaken(*changes.Email, id) {
+		return nil, fmt.Errorf("мок: PatchUser: %w", ErrDuplicateEmail)
+	}
+	updated := *user
+	updated.Version++
+	if changes.Name != nil {
+		updated.Name = *changes.Name
+	}
+	if changes.Email != nil {
+		updated.Email = *changes.Email
+	}
+	if err := m.record(ctx, "users.patch", id, user, &updated); err != nil {
+		return nil, fmt.Errorf("мок: PatchUser: %w", err)
+	}
+	m.Users[id] = &updated
+	return &updated, nil
+}
+
+func (m *MockUserStorage) DeleteUser(ctx context.Context, id int64, version int64) error {
 	m.DeleteCalled = true // Фиксируем вызов
+	if err := m.wait(ctx); err != nil {
+		return fmt.Errorf("мок: DeleteUser: %w", err)
+	}
 	if m.ReturnError != nil {
 		return m.ReturnError
 	}
-	if _, exists := m.Users[id]; !exists {
-		return fmt.Errorf("мок: пользователь с ID %d не найден для удаления", id)
+	user, exists := m.active(id)
+	if !exists {
+		return fmt.Errorf("мок: DeleteUser: ID %d: %w", id, ErrNotFound)
 	}
-	delete(m.Users, id)
+	if version > 0 && version != user.Version {
+		return fmt.Errorf("мок: DeleteUser: ID %d: %w", id, ErrVersionMismatch)
+	}
+	deleted := *user
+	deleted.Version++
+	now := time.Now()
+	deleted.DeletedAt = &now
+	if err := m.record(ctx, "users.delete", id, user, &deleted); err != nil {
+		return fmt.Errorf("мок: DeleteUser: %w", err)
+	}
+	m.Users[id] = &deleted
 	return nil
 }
+
+func (m *MockUserStorage) RestoreUser(ctx context.Context, id int64, version int64) (*models.User, error) {
+	if err := m.wait(ctx); err != nil {
+		return nil, fmt.Errorf("мок: RestoreUser: %w", err)
+	}
+	if m.ReturnError != nil {
+		return nil, m.ReturnError
+	}
+	user, exists := m.Users[id]
+	if !exists {
+		return nil, fmt.Errorf("мок: RestoreUser: ID %d: %w", id, ErrNotFound)
+	}
+	if version > 0 && version != user.Version {
+		return nil, fmt.Errorf("мок: RestoreUser: ID %d: %w", id, ErrVersionMismatch)
+	}
+	if user.DeletedAt == nil {
+		return nil, fmt.Errorf("мок: RestoreUser: ID %d: %w", id, ErrNotDeleted)
+	}
+	if m.emailTaken(user.Email, id) {
+		return nil, fmt.Errorf("мок: RestoreUser: %w", ErrDuplicateEmail)
+	}
+	restored := *user
+	restored.Version++
+	restored.DeletedAt = nil
+	if err := m.record(ctx, "users.restore", id, user, &restored); err != nil {
+		return nil, fmt.Errorf("мок: RestoreUser: %w", err)
+	}
+	m.Users[id] = &restored
+	return &restored, nil
+}
+
+func (m *MockUserStorage) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	if err := m.wait(ctx); err != nil {
+		return 0, fmt.Errorf("мок: PurgeDeletedUsers: %w", err)
+	}
+	if m.ReturnError != nil {
+		return 0, m.ReturnError
+	}
+	var n int64
+	for id, user := range m.Users {
+		if user.DeletedAt == nil || !user.DeletedAt.Before(before) {
+			continue
+		}
+		if err := m.record(ctx, "users.purge", id, user, nil); err != nil {
+			return n, fmt.Errorf("мок: PurgeDeletedUsers: %w", err)
+		}
+		delete(m.Users, id)
+		n++
+	}
+	return n, nil
+}
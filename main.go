@@ -1,163 +1,260 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
-	"strings"
 	"time"
 
 	_ "github.com/lib/pq" // Драйвер PostgreSQL
 
+	"github.com/casanera/DlugoshSolutions/db/migrations"
+	"github.com/casanera/DlugoshSolutions/internal/audit"
+	"github.com/casanera/DlugoshSolutions/internal/auth"
+	"github.com/casanera/DlugoshSolutions/internal/config"
 	"github.com/casanera/DlugoshSolutions/internal/handlers"
+	"github.com/casanera/DlugoshSolutions/internal/health"
+	"github.com/casanera/DlugoshSolutions/internal/logging"
+	"github.com/casanera/DlugoshSolutions/internal/metrics"
+	"github.com/casanera/DlugoshSolutions/internal/middleware"
+	"github.com/casanera/DlugoshSolutions/internal/migrate"
 	"github.com/casanera/DlugoshSolutions/internal/storage"
 )
 
 var db *sql.DB // Глобальная переменная для хранения объекта подключения к БД
 
-func routeHandler(userH *handlers.UserHandler) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Входящий запрос (через routeHandler): Метод=%s, Путь=%s, RemoteAddr=%s", r.Method, r.URL.Path, r.RemoteAddr) // Добавлен идентификатор
-
-		// Обработка API эндпоинтов для пользователей
-		if strings.HasPrefix(r.URL.Path, "/api/v1/users") {
-			pathRemainder := strings.TrimPrefix(r.URL.Path, "/api/v1/users")
-			isSpecificUser := pathRemainder != "" && pathRemainder != "/"
-
-			switch r.Method {
-			case http.MethodGet:
-				userH.GetUserHandler(w, r)
-			case http.MethodPost:
-				if !isSpecificUser || pathRemainder == "/" {
-					userH.CreateUserHandler(w, r)
-				} else {
-					log.Printf("Некорректный POST запрос на %s", r.URL.Path)
-					http.Error(w, "Метод POST применим только к /api/v1/users", http.StatusMethodNotAllowed)
-				}
-			case http.MethodPut:
-				// PUT запросы для обновления пользователя требуют ID
-				if isSpecificUser {
-					userH.UpdateUserHandler(w, r)
-				} else {
-					log.Printf("PUT запрос без ID пользователя на %s", r.URL.Path)
-					http.Error(w, "Для PUT запроса требуется ID пользователя в пути (например, /api/v1/users/123)", http.StatusBadRequest)
-				}
-			case http.MethodDelete:
-				// DELETE запросы для удаления пользователя требуют ID
-				if isSpecificUser {
-					userH.DeleteUserHandler(w, r)
-				} else {
-					log.Printf("DELETE запрос без ID пользователя на %s", r.URL.Path)
-					http.Error(w, "Для DELETE запроса требуется ID пользователя в пути (например, /api/v1/users/123)", http.StatusBadRequest)
-				}
-			default:
-				log.Printf("Метод %s не разрешен для %s", r.Method, r.URL.Path)
-				http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
-			}
-			return
+// poolSaturationThreshold - доля занятых соединений, при которой /readyz
+// сообщает о перегрузке пула
+const poolSaturationThreshold = 0.9
+
+// fatal пишет ошибку в журнал и завершает процесс
+func fatal(logger *slog.Logger, msg string, attrs ...any) {
+	logger.Error(msg, attrs...)
+	os.Exit(1)
+}
+
+// connectDB открывает подключение к PostgreSQL и дожидается готовности БД.
+// Результат сохраняется в глобальную переменную db
+func connectDB(cfg config.DatabaseConfig, logger *slog.Logger) {
+	logger.Info("подключение к PostgreSQL")
+	var err error
+	// Открываем соединение с базой данных и присваиваем его глобальной переменной db
+	db, err = sql.Open("postgres", cfg.DSN())
+	if err != nil {
+		fatal(logger, "ошибка sql.Open для PostgreSQL", logging.Err(err))
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+
+	// пытаемся подключиться к БД несколько раз с задержкой,
+	// так как контейнер с БД может стартовать медленнее, чем приложение
+	maxRetries := cfg.ConnectRetries
+	for i := 0; i < maxRetries; i++ {
+		err = db.Ping()
+		if err == nil {
+			logger.Info("подключение к PostgreSQL установлено", slog.Int("attempt", i+1))
+			break
 		}
-		log.Printf("routeHandler: Маршрут не найден для: %s (это неожиданно, если не /api/)", r.URL.Path)
-		http.NotFound(w, r)
+		logger.Warn("БД недоступна, повтор после паузы",
+			slog.Int("attempt", i+1), slog.Int("max_attempts", maxRetries),
+			slog.Duration("delay", cfg.ConnectRetryDelay), logging.Err(err))
+		time.Sleep(cfg.ConnectRetryDelay)
+	}
+
+	if err != nil {
+		fatal(logger, "не удалось подключиться к PostgreSQL, завершение работы", slog.Int("attempts", maxRetries), logging.Err(err))
 	}
 }
 
-// homeHandler больше не будет напрямую обрабатывать "/", так как это делает FileServer.
-func homeHandler(w http.ResponseWriter, r *http.Request) {
-	if db == nil {
-		log.Println("Ошибка в homeHandler: подключение к БД (db) равно nil")
-		http.Error(w, "Внутренняя ошибка сервера: подключение к БД не инициализировано.", http.StatusInternalServerError)
+func main() {
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		// Логгер еще не настроен - пишем через логгер по умолчанию
+		fatal(slog.Default(), "ошибка конфигурации, завершение работы", logging.Err(err))
+	}
+	if cfg.PrintConfig {
+		fmt.Print(cfg.Redacted())
 		return
 	}
-	err := db.Ping()
+	logger, err := logging.New(os.Stderr, cfg.Log.Level, cfg.Log.Format)
 	if err != nil {
-		log.Printf("Ошибка Ping к БД в homeHandler: %v", err)
-		http.Error(w, "Внутренняя ошибка сервера: не удалось подключиться к БД. "+err.Error(), http.StatusInternalServerError)
-		return
+		fatal(slog.Default(), "ошибка настройки журнала", logging.Err(err))
 	}
-	fmt.Fprintf(w, "Статус сервера: ОК. Подключение к PostgreSQL: ОК. Фронтенд доступен по корневому пути '/'. API на '/api/v1/users'.")
-}
+	// Пакеты, которые пишут через log или slog по умолчанию, попадают в тот же журнал
+	slog.SetDefault(logger)
+	logger.Info("запуск приложения")
+	logger.Info("действующая конфигурация", slog.String("config", cfg.Redacted()))
 
-func main() {
-	log.Println("Запуск приложения...")
-
-	// Получаем конфигурацию для подключения к БД из переменных окружения
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
-
-	if dbHost == "" || dbPort == "" || dbUser == "" || dbPassword == "" || dbName == "" {
-		missingVars := []string{}
-		if dbHost == "" {
-			missingVars = append(missingVars, "DB_HOST")
-		}
-		if dbPort == "" {
-			missingVars = append(missingVars, "DB_PORT")
-		}
-		if dbUser == "" {
-			missingVars = append(missingVars, "DB_USER")
+	// Подкоманда: myapp [флаги] token keygen|issue (БД не нужна)
+	if len(cfg.Args) > 0 && cfg.Args[0] == "token" {
+		if err := runTokenCommand(cfg.Auth, cfg.Args[1:], os.Stdout); err != nil {
+			fatal(logger, "ошибка команды token", logging.Err(err))
 		}
-		if dbPassword == "" {
-			missingVars = append(missingVars, "DB_PASSWORD")
-		}
-		if dbName == "" {
-			missingVars = append(missingVars, "DB_NAME")
-		}
-		log.Fatalf("Критической(-ие) переменной(-ые) окружения для БД не установлена(-ы): %s. Завершение работы.", strings.Join(missingVars, ", "))
+		return
+	}
+	keySet, err := loadKeySet(cfg.Auth)
+	if err != nil {
+		fatal(logger, "ошибка загрузки ключей JWT", logging.Err(err))
+	}
+	jwksHandler, err := auth.JWKSHandler(keySet)
+	if err != nil {
+		fatal(logger, "ошибка публикации ключей JWT", logging.Err(err))
 	}
+	logger.Info("ключи JWT загружены", slog.Int("keys", len(keySet.Keys)), slog.Bool("hs256", cfg.Auth.JWTSecret != ""))
 
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
+	connectDB(cfg.Database, logger)
 
-	log.Println("Попытка подключения к PostgreSQL...")
-	var err error
-	// Открываем соединение с базой данных и присваиваем его глобальной переменной db
-	db, err = sql.Open("postgres", connStr)
+	migrator, err := migrate.New(db, migrations.FS)
 	if err != nil {
-		log.Fatalf("Ошибка при вызове sql.Open для PostgreSQL: %v", err)
+		fatal(logger, "ошибка загрузки миграций", logging.Err(err))
 	}
+	migrator.Logger = logger.With(slog.String("component", "migrate"))
 
-	// пытаемся подключиться к БД несколько раз с задержкой,
-	// так как контейнер с БД может стартовать медленнее, чем приложение
-	maxRetries := 15
-	for i := 0; i < maxRetries; i++ {
-		log.Printf("Проверка соединения с БД (попытка %d/%d)...", i+1, maxRetries)
-		err = db.Ping()
-		if err == nil {
-			log.Println("Успешное подключение к PostgreSQL!")
-			break
+	// Подкоманда: myapp [флаги] migrate up|down [N]|status
+	if len(cfg.Args) > 0 && cfg.Args[0] == "migrate" {
+		if err := runMigrateCommand(context.Background(), migrator, cfg.Args[1:], logger); err != nil {
+			fatal(logger, "ошибка миграции", logging.Err(err))
 		}
-		log.Printf("Не удалось подключиться к БД: %v. Ожидание 5 секунд перед следующей попыткой...", err)
-		time.Sleep(5 * time.Second)
+		return
 	}
 
-	if err != nil {
-		log.Fatalf("Не удалось установить соединение с PostgreSQL после %d попыток: %v. Завершение работы.", maxRetries, err)
+	ensureSchema(context.Background(), migrator, cfg.Migrations.OnStart, logger)
+
+	keyStorage := storage.NewPostgresAPIKeyStorage(db)
+	keyStorage.QueryTimeout = cfg.Database.QueryTimeout
+	keyStorage.Logger = logger.With(slog.String("component", "storage"))
+
+	roleStorage := storage.NewPostgresRoleStorage(db)
+	roleStorage.QueryTimeout = cfg.Database.QueryTimeout
+	roleStorage.Logger = logger.With(slog.String("component", "storage"))
+
+	credentialStorage := storage.NewPostgresCredentialStorage(db)
+	credentialStorage.QueryTimeout = cfg.Database.QueryTimeout
+	credentialStorage.Logger = logger.With(slog.String("component", "storage"))
+
+	sessionStorage := storage.NewPostgresSessionStorage(db)
+	sessionStorage.QueryTimeout = cfg.Database.QueryTimeout
+	sessionStorage.Logger = logger.With(slog.String("component", "storage"))
+
+	// Многошаговые изменения выполняются в одной транзакции через store.WithTx
+	store := storage.NewPostgresStore(db)
+	store.Roles = roleStorage
+	store.Credentials = credentialStorage
+	store.Sessions = sessionStorage
+	store.Logger = logger.With(slog.String("component", "storage"))
+
+	// Подкоманда: myapp [флаги] passwd USER_ID < пароль
+	if len(cfg.Args) > 0 && cfg.Args[0] == "passwd" {
+		if err := runPasswdCommand(context.Background(), store, cfg.Args[1:], os.Stdin, os.Stdout); err != nil {
+			fatal(logger, "ошибка команды passwd", logging.Err(err))
+		}
+		return
 	}
 
+	// Подкоманда: myapp [флаги] import [-dry-run] ФАЙЛ|-
+	if len(cfg.Args) > 0 && cfg.Args[0] == "import" {
+		users := storage.NewPostgresUserStorage(db)
+		users.QueryTimeout = cfg.Database.QueryTimeout
+		users.Logger = logger.With(slog.String("component", "storage"))
+		auditStorage := storage.NewPostgresAuditStorage(db)
+		auditStorage.QueryTimeout = cfg.Database.QueryTimeout
+		store.Users, store.Audit = users, auditStorage
+		if err := runImportCommand(context.Background(), store, cfg.Args[1:], os.Stdin, os.Stdout); err != nil {
+			fatal(logger, "ошибка команды import", logging.Err(err))
+		}
+		return
+	}
+
+	// Подкоманда: myapp [флаги] role list|show|grant|revoke
+	if len(cfg.Args) > 0 && cfg.Args[0] == "role" {
+		if err := runRoleCommand(context.Background(), roleStorage, cfg.Args[1:], os.Stdout); err != nil {
+			fatal(logger, "ошибка команды role", logging.Err(err))
+		}
+		return
+	}
+
+	// Подкоманда: myapp [флаги] apikey create|list|revoke
+	if len(cfg.Args) > 0 && cfg.Args[0] == "apikey" {
+		if err := runAPIKeyCommand(context.Background(), keyStorage, cfg.Args[1:], os.Stdout); err != nil {
+			fatal(logger, "ошибка команды apikey", logging.Err(err))
+		}
+		return
+	}
+
+	reg := metrics.NewRegistry()
+	metrics.RegisterDBStats(reg, db)
+
 	userStorage := storage.NewPostgresUserStorage(db)
+	userStorage.Observer = metrics.NewStorageMetrics(reg)
+	userStorage.QueryTimeout = cfg.Database.QueryTimeout
+	userStorage.Logger = logger.With(slog.String("component", "storage"))
 	userHandler := handlers.NewUserHandler(userStorage)
-	mux := http.NewServeMux()
-	mux.HandleFunc("/api/", routeHandler(userHandler))
-	staticFileServer := http.FileServer(http.Dir("./static"))
-	// Регистрируем FileServer для обработки всех запросов к корневому пути "/" и его подпутям
-	mux.Handle("/", staticFileServer)
-	mux.HandleFunc("/status", homeHandler)
-	appPort := os.Getenv("APP_PORT")
-	if appPort == "" {
-		appPort = "8080" // Порт по умолчанию
-		log.Printf("Переменная окружения APP_PORT не установлена, используется порт по умолчанию: %s", appPort)
-	}
-	log.Printf("Сервер backend (с CRUD и фронтендом) запускается на порту :%s", appPort)
-	log.Printf("API пользователей доступно по /api/v1/users (обрабатывается через routeHandler)")
-	log.Printf("Статические файлы (фронтенд) раздаются из папки ./static и доступны по адресу: http://localhost:%s/", appPort)
-	log.Printf("Для проверки статуса (если раскомментирован /status): http://localhost:%s/status", appPort)
-
-	// Вместо `http.ListenAndServe(":"+appPort, nil)` используем `mux`.
-	if err := http.ListenAndServe(":"+appPort, mux); err != nil {
-		log.Fatalf("Ошибка при запуске HTTP-сервера: %v", err)
+	userHandler.Logger = logger.With(slog.String("component", "handlers"))
+	// Изменения пользователей хранилище записывает в audit_events само; отказы
+	// в доступе и попытки входа попадают туда же и в журнал приложения
+	auditStorage := storage.NewPostgresAuditStorage(db)
+	auditStorage.QueryTimeout = cfg.Database.QueryTimeout
+	auditStorage.Logger = logger.With(slog.String("component", "storage"))
+	store.Users = userStorage
+	store.Audit = auditStorage
+	userHandler.Audit = audit.Multi{audit.NewLogRecorder(logger.With(slog.String("component", "audit"))), auditStorage}
+	auditHandler := handlers.NewAuditHandler(userHandler, auditStorage)
+	sessions := auth.NewSessionManager(sessionStorage)
+	sessions.IdleTimeout = cfg.Auth.SessionIdleTimeout
+	sessions.AbsoluteTimeout = cfg.Auth.SessionAbsoluteTimeout
+	sessions.Secure = cfg.Auth.SessionCookieSecure
+	authHandler := handlers.NewAuthHandler(userHandler, credentialStorage, sessions)
+	authHandler.MaxAttempts = cfg.Auth.LoginMaxAttempts
+	authHandler.Lockout = cfg.Auth.LoginLockout
+	authLogger := logger.With(slog.String("component", "auth"))
+	tokens := &auth.Verifier{
+		Secret:   []byte(cfg.Auth.JWTSecret),
+		Keys:     keySet,
+		Issuer:   cfg.Auth.JWTIssuer,
+		Audience: cfg.Auth.JWTAudience,
+		Leeway:   cfg.Auth.JWTLeeway,
 	}
+	// Права пользователя берутся из его ролей; обработчики проверяют их сами
+	api := middleware.Chain(apiRoutes(userHandler, authHandler, auditHandler, store),
+		auth.Authenticate(auth.RequireAPIKey(keyStorage, authLogger), auth.RequireBearer(tokens, authLogger),
+			auth.RequireSession(sessions, authLogger)),
+		auth.LoadRoles(roleStorage, authLogger))
+	hc := health.New(cfg.HTTP.ReadinessTimeout)
+	hc.Add("postgres", health.PingDB(db))
+	hc.Add("migrations", func(ctx context.Context) error {
+		pending, err := migrator.Pending(ctx)
+		if err == nil && pending > 0 {
+			err = fmt.Errorf("не применено миграций: %d", pending)
+		}
+		return err
+	})
+	hc.Add("db_pool", health.PoolSaturation(db, poolSaturationThreshold))
+	rt := rootRoutes(api, authHandler, jwksHandler, hc, reg.Handler())
+
+	// RequestID снаружи, чтобы идентификатор был и в журнале доступа, и в логе паники;
+	// Recover внутри AccessLog и Metrics, чтобы итоговый статус 500 попал и в журнал, и в метрики
+	httpLogger := logger.With(slog.String("component", "http"))
+	handler := middleware.Chain(rt,
+		middleware.RequestID,
+		middleware.AccessLog(httpLogger),
+		middleware.Metrics(metrics.NewHTTPMetrics(reg)),
+		middleware.Recover(httpLogger))
+	// Удаленные пользователи восстанавливаются до истечения срока хранения,
+	// затем удаляются окончательно
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	defer stopPurge()
+	purgeDone := make(chan struct{})
+	go func() {
+		defer close(purgeDone)
+		runPurgeJob(purgeCtx, userStorage, cfg.Users, logger.With(slog.String("component", "purge")))
+	}()
+
+	srv := newHTTPServer(fmt.Sprintf(":%d", cfg.HTTP.Port), handler, cfg.HTTP)
+	runServer(srv, cfg.HTTP, hc, logger, func() {
+		// Очистка не должна обращаться к пулу после db.Close: отменяем ее
+		// и ждем, пока текущий запрос к БД завершится
+		stopPurge()
+		<-purgeDone
+	})
 }
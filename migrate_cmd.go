@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/casanera/DlugoshSolutions/internal/logging"
+	"github.com/casanera/DlugoshSolutions/internal/migrate"
+)
+
+// runMigrateCommand выполняет подкоманду migrate: up, down [N] или status
+func runMigrateCommand(ctx context.Context, m *migrate.Migrator, args []string, logger *slog.Logger) error {
+	if len(args) == 0 {
+		return fmt.Errorf("использование: migrate up|down [N]|status")
+	}
+	switch args[0] {
+	case "up":
+		n, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		logger.Info("миграции применены", slog.Int("applied", n))
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				return fmt.Errorf("количество шагов отката должно быть положительным числом, получено %q", args[1])
+			}
+		}
+		n, err := m.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		logger.Info("миграции откачены", slog.Int("reverted", n))
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			state := "не применена"
+			if st.Applied {
+				state = "применена " + st.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(os.Stdout, "%03d_%-30s %s\n", st.Version, st.Name, state)
+		}
+	default:
+		return fmt.Errorf("неизвестная подкоманда migrate %q: ожидается up, down или status", args[0])
+	}
+	return nil
+}
+
+// ensureSchema приводит схему БД к актуальной версии перед запуском сервера.
+// При выключенном onStart миграции не применяются, и сервер отказывается
+// стартовать, если схема отстает
+func ensureSchema(ctx context.Context, m *migrate.Migrator, onStart bool, logger *slog.Logger) {
+	if onStart {
+		n, err := m.Up(ctx)
+		if err != nil {
+			fatal(logger, "не удалось применить миграции при запуске", logging.Err(err))
+		}
+		logger.Info("схема БД актуальна", slog.Int("applied", n))
+		return
+	}
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		fatal(logger, "не удалось проверить состояние миграций", logging.Err(err))
+	}
+	if pending > 0 {
+		fatal(logger, "схема БД отстает: выполните `migrate up` или включите MIGRATE_ON_START", slog.Int("pending", pending))
+	}
+	logger.Info("схема БД актуальна")
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/casanera/DlugoshSolutions/internal/auth"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+const passwdUsage = "использование: passwd USER_ID (пароль читается из первой строки stdin)"
+
+// runPasswdCommand задает пароль пользователя. Пароль читается из stdin,
+// а не из аргументов, чтобы не попасть в историю команд и список процессов.
+// Открытые сессии пользователя завершаются в той же транзакции
+func runPasswdCommand(ctx context.Context, store storage.Transactor, args []string, in io.Reader, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New(passwdUsage)
+	}
+	userID, err := parseUserID(args[0])
+	if err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("чтение пароля: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if err := auth.ValidatePassword(password); err != nil {
+		return err
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	err = store.WithTx(ctx, storage.TxOptions{}, func(tx storage.Store) error {
+		if err := tx.Credentials().SetPassword(ctx, userID, hash); err != nil {
+			return err
+		}
+		return tx.Sessions().DeleteUserSessions(ctx, userID, "")
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Пароль пользователя %d задан, его сессии завершены\n", userID)
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/casanera/DlugoshSolutions/internal/audit"
+	"github.com/casanera/DlugoshSolutions/internal/config"
+	"github.com/casanera/DlugoshSolutions/internal/logging"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+// purgeActor - субъект окончательных удалений в журнале аудита
+const purgeActor = "system:purge"
+
+// runPurgeJob раз в PurgeInterval окончательно удаляет пользователей, удаленных
+// больше Retention назад. Первая проверка выполняется сразу при запуске.
+// Ошибка одной проверки не останавливает задачу: следующая попробует снова
+func runPurgeJob(ctx context.Context, users storage.UserStorage, cfg config.UsersConfig, logger *slog.Logger) {
+	ctx = audit.WithActor(ctx, purgeActor)
+	ticker := time.NewTicker(cfg.PurgeInterval)
+	defer ticker.Stop()
+	for {
+		n, err := users.PurgeDeletedUsers(ctx, time.Now().Add(-cfg.Retention))
+		switch {
+		case err != nil && ctx.Err() == nil:
+			logger.Error("не удалось окончательно удалить пользователей", logging.Err(err))
+		case n > 0:
+			logger.Info("удаленные пользователи удалены окончательно",
+				slog.Int64("count", n), slog.Duration("retention", cfg.Retention))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+const roleUsage = "использование: role list | role show USER_ID | role grant USER_ID РОЛЬ | role revoke USER_ID РОЛЬ"
+
+// runRoleCommand выполняет подкоманду role: просмотр ролей и их назначение
+// пользователям. Изменения действуют со следующего запроса пользователя
+func runRoleCommand(ctx context.Context, roles storage.RoleStorage, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(roleUsage)
+	}
+	switch args[0] {
+	case "list":
+		list, err := roles.ListRoles(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "РОЛЬ\tРАЗРЕШЕНИЯ\tОПИСАНИЕ")
+		for _, r := range list {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Name, strings.Join(r.Permissions, ","), r.Description)
+		}
+		return tw.Flush()
+	case "show":
+		if len(args) != 2 {
+			return errors.New(roleUsage)
+		}
+		userID, err := parseUserID(args[1])
+		if err != nil {
+			return err
+		}
+		assigned, err := roles.UserRoles(ctx, userID)
+		if err != nil {
+			return err
+		}
+		perms, err := roles.UserPermissions(ctx, userID)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Роли: %s\nРазрешения: %s\n", strings.Join(assigned, ", "), strings.Join(perms, ", "))
+	case "grant", "revoke":
+		if len(args) != 3 {
+			return errors.New(roleUsage)
+		}
+		userID, err := parseUserID(args[1])
+		if err != nil {
+			return err
+		}
+		if args[0] == "grant" {
+			if err := roles.GrantRole(ctx, userID, args[2]); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Пользователю %d назначена роль %s\n", userID, args[2])
+		} else {
+			if err := roles.RevokeRole(ctx, userID, args[2]); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "У пользователя %d снята роль %s\n", userID, args[2])
+		}
+	default:
+		return fmt.Errorf("неизвестная подкоманда role %q: %s", args[0], roleUsage)
+	}
+	return nil
+}
+
+func parseUserID(s string) (int64, error) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("некорректный ID пользователя %q", s)
+	}
+	return id, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/casanera/DlugoshSolutions/internal/handlers"
+	"github.com/casanera/DlugoshSolutions/internal/health"
+	"github.com/casanera/DlugoshSolutions/internal/router"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+// apiRoutes собирает маршруты /api/. Они доступны только с действующим
+// API-ключом, JWT или сессией: аутентификацию добавляет вызывающий
+func apiRoutes(userHandler *handlers.UserHandler, authHandler *handlers.AuthHandler, auditHandler *handlers.AuditHandler, store storage.Transactor) *router.Router {
+	api := router.New()
+	api.Resource("/api/v1/users", userHandler.Resource())
+	api.HandleFunc(http.MethodPost, "/api/v1/users/{id}", userHandler.RestoreRoute()) // POST /api/v1/users/{id}:restore
+	api.HandleFunc(http.MethodPost, "/api/v1/users:batch", handlers.NewBatchHandler(userHandler, store).BatchRoute())
+	api.HandleFunc(http.MethodPost, "/api/v1/users/import", handlers.NewImportHandler(userHandler, store).ImportRoute())
+	api.HandleFunc(http.MethodPut, "/api/v1/users/{id}/password", authHandler.PasswordRoute())
+	api.HandleFunc(http.MethodGet, "/api/v1/auth/me", authHandler.MeHandler)
+	api.HandleFunc(http.MethodGet, "/api/v1/users/{id}/history", auditHandler.HistoryRoute())
+	api.HandleFunc(http.MethodGet, "/api/v1/audit", auditHandler.ListRoute())
+	// Неизвестные пути под /api/ отвечают 404 в формате problem+json, а не страницей FileServer
+	api.Mount("/api/", http.HandlerFunc(router.NotFound))
+	return api
+}
+
+// rootRoutes собирает все маршруты сервера; api - маршруты /api/ вместе с аутентификацией
+func rootRoutes(api http.Handler, authHandler *handlers.AuthHandler, jwks http.Handler, hc *health.Health, metricsHandler http.Handler) *router.Router {
+	rt := router.New()
+	rt.Mount("/api/", api)
+	// Вход и выход - вне /api/ с аутентификацией: более точные шаблоны ServeMux
+	// имеют приоритет над поддеревом /api/
+	rt.HandleFunc(http.MethodPost, "/api/v1/auth/login", authHandler.LoginHandler)
+	rt.HandleFunc(http.MethodPost, "/api/v1/auth/logout", authHandler.LogoutHandler)
+	// Открытые части собственных ключей, которыми сервис подписывает токены
+	rt.Handle(http.MethodGet, "/.well-known/jwks.json", jwks)
+	// /healthz - процесс жив; /readyz - зависимости доступны и остановка не началась.
+	// /status оставлен для совместимости и работает как /readyz
+	rt.HandleFunc(http.MethodGet, "/healthz", hc.LivenessHandler)
+	rt.HandleFunc(http.MethodGet, "/readyz", hc.ReadinessHandler)
+	rt.HandleFunc(http.MethodGet, "/status", hc.ReadinessHandler)
+	rt.Handle(http.MethodGet, "/metrics", metricsHandler)
+	staticFileServer := http.FileServer(http.Dir("./static"))
+	// Регистрируем FileServer для обработки всех запросов к корневому пути "/" и его подпутям
+	rt.Mount("/", staticFileServer)
+	return rt
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/casanera/DlugoshSolutions/internal/auth"
+	"github.com/casanera/DlugoshSolutions/internal/handlers"
+	"github.com/casanera/DlugoshSolutions/internal/health"
+	"github.com/casanera/DlugoshSolutions/internal/models"
+	"github.com/casanera/DlugoshSolutions/internal/storage"
+)
+
+// TestRoutes собирает полную таблицу маршрутов, как main: конфликт шаблонов
+// ServeMux - паника при регистрации - должен падать здесь, а не при запуске
+func TestRoutes(t *testing.T) {
+	store := storage.NewMockStore()
+	store.Users.Users[1] = &models.User{ID: 1, Name: "Alice", Email: "alice@example.com", Version: 1}
+	store.Users.NextID = 2
+	userHandler := handlers.NewUserHandler(store.Users)
+	userHandler.Audit = store.Audit
+	authHandler := handlers.NewAuthHandler(userHandler, store.Credentials, auth.NewSessionManager(store.Sessions))
+	auditHandler := handlers.NewAuditHandler(userHandler, store.Audit)
+
+	admin := &auth.Principal{Kind: auth.KindAPIKey, ID: "1",
+		Scopes: []string{auth.PermUsersRead, auth.PermUsersWrite, auth.PermUsersDelete}}
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiRoutes(userHandler, authHandler, auditHandler, store).ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), admin)))
+	})
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	rt := rootRoutes(api, authHandler, ok, health.New(time.Second), ok)
+
+	testCases := []struct {
+		method, target, body string
+		expectedStatus       int
+	}{
+		{http.MethodGet, "/api/v1/users/1", "", http.StatusOK},
+		{http.MethodPost, "/api/v1/users/import", "name,email\nBob,bob@example.com\n", http.StatusOK},
+		{http.MethodPost, "/api/v1/users:batch", `{"operations":[{"op":"delete","id":1}]}`, http.StatusOK},
+		{http.MethodPost, "/api/v1/users/1:restore", "", http.StatusOK},
+		{http.MethodOptions, "/api/v1/users/import", "", http.StatusNoContent},
+		{http.MethodGet, "/api/v1/users/import", "", http.StatusBadRequest}, // GET /api/v1/users/{id}
+		{http.MethodGet, "/api/v1/unknown", "", http.StatusNotFound},
+		{http.MethodGet, "/healthz", "", http.StatusOK},
+		{http.MethodGet, "/api/v1/auth/login", "", http.StatusMethodNotAllowed},
+	}
+	for _, tc := range testCases {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "text/csv")
+		rt.ServeHTTP(rr, req)
+		if rr.Code != tc.expectedStatus {
+			t.Errorf("%s %s: статус %d, ожидался %d. Тело: %s", tc.method, tc.target, rr.Code, tc.expectedStatus, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/casanera/DlugoshSolutions/internal/config"
+	"github.com/casanera/DlugoshSolutions/internal/health"
+	"github.com/casanera/DlugoshSolutions/internal/logging"
+)
+
+// newHTTPServer создает сервер с таймаутами, чтобы медленные или зависшие
+// клиенты не удерживали соединения бесконечно
+func newHTTPServer(addr string, handler http.Handler, cfg config.HTTPConfig) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// runServer запускает сервер и блокируется до SIGINT/SIGTERM. После сигнала
+// /readyz начинает отвечать 503, через ShutdownDelay сервер перестает
+// принимать соединения, дожидается завершения текущих запросов в пределах
+// ShutdownTimeout, вызывает beforeDBClose (остановка фоновых задач, которым
+// нужна БД) и закрывает подключение к БД
+func runServer(srv *http.Server, cfg config.HTTPConfig, hc *health.Health, logger *slog.Logger, beforeDBClose func()) {
+	shutdownTimeout := cfg.ShutdownTimeout
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("HTTP-сервер запущен",
+			slog.String("addr", srv.Addr),
+			slog.Duration("read_header_timeout", srv.ReadHeaderTimeout),
+			slog.Duration("read_timeout", srv.ReadTimeout),
+			slog.Duration("write_timeout", srv.WriteTimeout),
+			slog.Duration("idle_timeout", srv.IdleTimeout))
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			fatal(logger, "ошибка при запуске HTTP-сервера", logging.Err(err))
+		}
+		return
+	case <-ctx.Done():
+	}
+	stop() // Повторный сигнал завершит процесс немедленно
+
+	hc.SetShuttingDown()
+	logger.Info("получен сигнал завершения, останавливаем сервер",
+		slog.Duration("shutdown_delay", cfg.ShutdownDelay), slog.Duration("shutdown_timeout", shutdownTimeout))
+	if cfg.ShutdownDelay > 0 {
+		// Пока идет пауза, запросы обслуживаются, а /readyz уже сообщает об остановке
+		time.Sleep(cfg.ShutdownDelay)
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("не все запросы завершились вовремя, принудительно закрываем соединения", logging.Err(err))
+		srv.Close()
+	} else {
+		logger.Info("все текущие запросы завершены", slog.Duration("duration", time.Since(start)))
+	}
+
+	if beforeDBClose != nil {
+		beforeDBClose()
+	}
+	if db != nil {
+		if err := db.Close(); err != nil {
+			logger.Error("ошибка при закрытии подключения к БД", logging.Err(err))
+		} else {
+			logger.Info("подключение к БД закрыто")
+		}
+	}
+	logger.Info("сервер остановлен")
+}
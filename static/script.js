@@ -1,24 +1,122 @@
 const API_BASE_URL = '/api/v1/users'; // Относительный путь, т.к. будем раздавать с того же сервера
+const AUTH_URL = '/api/v1/auth';
 
 // Получаем ссылки на элементы DOM
 const userForm = document.getElementById('userForm');
 const userIdInput = document.getElementById('userId');
+const userVersionInput = document.getElementById('userVersion');
 const nameInput = document.getElementById('name');
 const emailInput = document.getElementById('email');
 const usersTableBody = document.getElementById('usersTableBody');
 const clearFormButton = document.getElementById('clearFormButton');
+const prevPageButton = document.getElementById('prevPageButton');
+const nextPageButton = document.getElementById('nextPageButton');
+const totalCount = document.getElementById('totalCount');
+const apiKeyForm = document.getElementById('apiKeyForm');
+const apiKeyInput = document.getElementById('apiKey');
+const loginForm = document.getElementById('loginForm');
+const loginEmailInput = document.getElementById('loginEmail');
+const loginPasswordInput = document.getElementById('loginPassword');
+const sessionInfo = document.getElementById('sessionInfo');
+const sessionUser = document.getElementById('sessionUser');
+const logoutButton = document.getElementById('logoutButton');
+
+const API_KEY_STORAGE = 'apiKey'; // Ключ хранится в localStorage браузера администратора
 
 let isEditing = false; 
+let currentPageUrl = API_BASE_URL; // Текущая страница списка (ссылки берутся из заголовка Link)
+let pageLinks = {};
+let me = null; // Текущий субъект из /api/v1/auth/me: разрешения и ID пользователя
 
+// Разбирает заголовок Link (RFC 8288) в объект { rel: url }
+function parseLinkHeader(header) {
+    const links = {};
+    if (!header) {
+        return links;
+    }
+    header.split(',').forEach(part => {
+        const match = part.match(/<([^>]+)>;\s*rel="([^"]+)"/);
+        if (match) {
+            links[match[2]] = match[1];
+        }
+    });
+    return links;
+}
 
-// Функция для получения всех пользователей
-async function fetchUsers() {
+// Читает значение cookie по имени
+function getCookie(name) {
+    const prefix = `${name}=`;
+    const cookie = document.cookie.split('; ').find(c => c.startsWith(prefix));
+    return cookie ? decodeURIComponent(cookie.slice(prefix.length)) : '';
+}
+
+// Выполняет запрос к API с ключом из поля "API-ключ" (заголовок X-API-Key).
+// Без ключа запрос идет с cookie сессии; изменяющим запросам нужен CSRF-токен
+function apiFetch(url, options = {}) {
+    const headers = { ...(options.headers || {}) };
+    const apiKey = localStorage.getItem(API_KEY_STORAGE);
+    if (apiKey) {
+        headers['X-API-Key'] = apiKey;
+    }
+    const method = (options.method || 'GET').toUpperCase();
+    const csrfToken = getCookie('csrf_token');
+    if (csrfToken && !['GET', 'HEAD', 'OPTIONS'].includes(method)) {
+        headers['X-CSRF-Token'] = csrfToken;
+    }
+    return fetch(url, { ...options, headers });
+}
+
+// Проверяет разрешение текущего субъекта; ownerId - владелец записи для разрешений вида perm:self
+function can(perm, ownerId) {
+    if (!me) {
+        return false;
+    }
+    if (me.permissions.includes(perm)) {
+        return true;
+    }
+    return ownerId !== undefined && me.user_id === Number(ownerId) && me.permissions.includes(`${perm}:self`);
+}
+
+// Извлекает описание ошибки из ответа API (application/problem+json, RFC 7807)
+async function readProblem(response) {
+    const text = await response.text();
+    let message = response.statusText;
+    if (text) {
+        try {
+            const problem = JSON.parse(text);
+            message = problem.detail || problem.title || message;
+            if (Array.isArray(problem.errors) && problem.errors.length > 0) {
+                const fields = problem.errors.map(e => `${e.field}: ${e.message}`).join('; ');
+                message = `${message} (${fields})`;
+            }
+        } catch (e) {
+            message = text;
+        }
+    }
+    if (response.status === 401) {
+        message = `${message}. Войдите или укажите действующий API-ключ`;
+    }
+    if (response.status === 412) {
+        message = 'пользователь был изменен другим администратором, обновите список и повторите';
+    }
+    return new Error(`Ошибка HTTP ${response.status}: ${message}`);
+}
+
+
+// Функция для получения страницы пользователей
+async function fetchUsers(url = currentPageUrl) {
     try {
-        const response = await fetch(API_BASE_URL);
+        const response = await apiFetch(url);
         if (!response.ok) {
-            throw new Error(`Ошибка HTTP: ${response.status} ${response.statusText}`);
+            throw await readProblem(response);
         }
         const users = await response.json();
+        currentPageUrl = url;
+        pageLinks = parseLinkHeader(response.headers.get('Link'));
+        prevPageButton.disabled = !pageLinks.prev;
+        nextPageButton.disabled = !pageLinks.next;
+        const total = response.headers.get('X-Total-Count');
+        totalCount.textContent = total !== null ? `Всего: ${total}` : '';
         displayUsers(users || []);
     } catch (error) {
         console.error('Ошибка при загрузке пользователей:', error);
@@ -26,10 +124,59 @@ async function fetchUsers() {
     }
 }
 
+// Загружает только собственную запись - для пользователей без права на список
+async function fetchOwnUser() {
+    try {
+        const response = await apiFetch(`${API_BASE_URL}/${me.user_id}`);
+        if (!response.ok) {
+            throw await readProblem(response);
+        }
+        prevPageButton.disabled = true;
+        nextPageButton.disabled = true;
+        totalCount.textContent = '';
+        displayUsers([await response.json()]);
+    } catch (error) {
+        console.error('Ошибка при загрузке пользователя:', error);
+        usersTableBody.innerHTML = `<tr><td colspan="4" style="color:red; text-align:center;">Не удалось загрузить данные: ${error.message}</td></tr>`;
+    }
+}
+
+// Загружает текущего субъекта и показывает только доступные ему действия
+async function loadSession() {
+    me = null;
+    try {
+        const response = await apiFetch(`${AUTH_URL}/me`);
+        if (response.ok) {
+            me = await response.json();
+        }
+    } catch (error) {
+        console.error('Ошибка при получении текущего пользователя:', error);
+    }
+    const loggedIn = me !== null && me.kind === 'session';
+    loginForm.style.display = loggedIn ? 'none' : 'flex';
+    sessionInfo.style.display = loggedIn ? 'flex' : 'none';
+    sessionUser.textContent = loggedIn ? `Вы вошли как пользователь ${me.user_id}` : '';
+    userForm.style.display = can('users:write') ? 'block' : 'none';
+}
+
+// Обновляет таблицу в соответствии с правами текущего субъекта
+async function refresh(url) {
+    await loadSession();
+    if (!me) {
+        fetchUsers(url); // Покажет ошибку 401 с подсказкой
+    } else if (can('users:read')) {
+        fetchUsers(url);
+    } else if (me.user_id) {
+        fetchOwnUser();
+    } else {
+        usersTableBody.innerHTML = '<tr><td colspan="4">Недостаточно прав для просмотра пользователей.</td></tr>';
+    }
+}
+
 // Функция для создания пользователя
 async function createUser(user) {
     try {
-        const response = await fetch(API_BASE_URL, {
+        const response = await apiFetch(API_BASE_URL, {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json',
@@ -37,8 +184,7 @@ async function createUser(user) {
             body: JSON.stringify(user),
         });
         if (!response.ok) {
-            const errorData = await response.json().catch(() => ({ message: response.statusText }));
-            throw new Error(`Ошибка HTTP ${response.status}: ${errorData.message || response.statusText}`);
+            throw await readProblem(response);
         }
         return await response.json();
     } catch (error) {
@@ -49,18 +195,18 @@ async function createUser(user) {
 }
 
 // Функция для обновления пользователя
-async function updateUser(id, user) {
+async function updateUser(id, version, user) {
     try {
-        const response = await fetch(`${API_BASE_URL}/${id}`, {
+        const response = await apiFetch(`${API_BASE_URL}/${id}`, {
             method: 'PUT',
             headers: {
                 'Content-Type': 'application/json',
+                'If-Match': `"v${version}"`, // Не перезаписываем чужие изменения
             },
             body: JSON.stringify(user),
         });
         if (!response.ok) {
-            const errorData = await response.json().catch(() => ({ message: response.statusText }));
-            throw new Error(`Ошибка HTTP ${response.status}: ${errorData.message || response.statusText}`);
+            throw await readProblem(response);
         }
         return await response.json();
     } catch (error) {
@@ -70,10 +216,13 @@ async function updateUser(id, user) {
     }
 }
 
-async function deleteUser(id) {
+async function deleteUser(id, version) {
     try {
-        const response = await fetch(`${API_BASE_URL}/${id}`, {
+        const response = await apiFetch(`${API_BASE_URL}/${id}`, {
             method: 'DELETE',
+            headers: {
+                'If-Match': `"v${version}"`,
+            },
         });
 
         // Успешное удаление часто возвращает 204 No Content
@@ -82,17 +231,7 @@ async function deleteUser(id) {
         }
 
         if (!response.ok) { // response.ok это true для статусов 200-299
-            const errorText = await response.text(); 
-            let errorMessage = response.statusText;
-            if (errorText) {
-                try {
-                    const errorData = JSON.parse(errorText);
-                    errorMessage = errorData.message || errorText;
-                } catch (e) {
-                    errorMessage = errorText; 
-                }
-            }
-            throw new Error(`Ошибка HTTP ${response.status}: ${errorMessage}`);
+            throw await readProblem(response);
         }
         return true; 
 
@@ -119,8 +258,8 @@ function displayUsers(users) {
             <td>${user.name}</td>
             <td>${user.email}</td>
             <td class="actions">
-                <button class="edit-btn" data-id="${user.id}" data-name="${user.name}" data-email="${user.email}">Редактировать</button>
-                <button class="delete-btn" data-id="${user.id}">Удалить</button>
+                ${can('users:write', user.id) ? `<button class="edit-btn" data-id="${user.id}" data-version="${user.version}" data-name="${user.name}" data-email="${user.email}">Редактировать</button>` : ''}
+                ${can('users:delete') ? `<button class="delete-btn" data-id="${user.id}" data-version="${user.version}">Удалить</button>` : ''}
             </td>
         `;
     });
@@ -144,14 +283,14 @@ userForm.addEventListener('submit', async (event) => {
     let result;
 
     if (isEditing && id) {
-        result = await updateUser(id, userData);
+        result = await updateUser(id, userVersionInput.value, userData);
     } else {
         result = await createUser(userData);
     }
 
     if (result) {
         resetForm();
-        fetchUsers(); // Обновляем список пользователей
+        refresh(); // Обновляем список пользователей
     }
 });
 
@@ -164,7 +303,9 @@ usersTableBody.addEventListener('click', async (event) => {
         const name = target.dataset.name;
         const email = target.dataset.email;
 
+        userForm.style.display = 'block'; // Форма скрыта у тех, кто может править только себя
         userIdInput.value = id;
+        userVersionInput.value = target.dataset.version;
         nameInput.value = name;
         emailInput.value = email;
         isEditing = true;
@@ -176,14 +317,27 @@ usersTableBody.addEventListener('click', async (event) => {
     if (target.classList.contains('delete-btn')) {
         const id = target.dataset.id;
         if (confirm(`Вы уверены, что хотите удалить пользователя с ID ${id}?`)) {
-            const success = await deleteUser(id);
+            const success = await deleteUser(id, target.dataset.version);
             if (success) {
-                fetchUsers(); // Обновляем список
+                refresh(); // Обновляем список
             }
         }
     }
 });
 
+// Навигация по страницам списка
+prevPageButton.addEventListener('click', () => {
+    if (pageLinks.prev) {
+        fetchUsers(pageLinks.prev);
+    }
+});
+
+nextPageButton.addEventListener('click', () => {
+    if (pageLinks.next) {
+        fetchUsers(pageLinks.next);
+    }
+});
+
 // сброс формы
 clearFormButton.addEventListener('click', () => {
     resetForm();
@@ -193,13 +347,54 @@ clearFormButton.addEventListener('click', () => {
 function resetForm() {
     userForm.reset();
     userIdInput.value = '';
+    userVersionInput.value = '';
     isEditing = false;
     clearFormButton.style.display = 'none';
     userForm.querySelector('button[type="submit"]').textContent = 'Сохранить';
+    userForm.style.display = can('users:write') ? 'block' : 'none';
 }
 
 
+// Сохранение API-ключа и перезагрузка списка с ним
+apiKeyForm.addEventListener('submit', (event) => {
+    event.preventDefault();
+    const apiKey = apiKeyInput.value.trim();
+    if (apiKey) {
+        localStorage.setItem(API_KEY_STORAGE, apiKey);
+    } else {
+        localStorage.removeItem(API_KEY_STORAGE);
+    }
+    refresh(API_BASE_URL);
+});
+
+// Вход по email и паролю: сервер устанавливает cookie сессии и CSRF-токена
+loginForm.addEventListener('submit', async (event) => {
+    event.preventDefault();
+    try {
+        const response = await fetch(`${AUTH_URL}/login`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ email: loginEmailInput.value.trim(), password: loginPasswordInput.value }),
+        });
+        if (!response.ok) {
+            throw await readProblem(response);
+        }
+        loginForm.reset();
+        refresh(API_BASE_URL);
+    } catch (error) {
+        console.error('Ошибка входа:', error);
+        alert(`Не удалось войти: ${error.message}`);
+    }
+});
+
+logoutButton.addEventListener('click', async () => {
+    await apiFetch(`${AUTH_URL}/logout`, { method: 'POST' });
+    resetForm();
+    refresh(API_BASE_URL);
+});
+
 // Загружаем пользователей при первой загрузке страницы
 document.addEventListener('DOMContentLoaded', () => {
-    fetchUsers();
+    apiKeyInput.value = localStorage.getItem(API_KEY_STORAGE) || '';
+    refresh();
 });
\ No newline at end of file
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/casanera/DlugoshSolutions/internal/auth"
+	"github.com/casanera/DlugoshSolutions/internal/config"
+)
+
+const tokenUsage = "использование: token keygen [-alg EdDSA|RS256] [-kid ID] | token issue -sub SUBJECT [-uid USER_ID] [-name ИМЯ] [-scopes a,b] [-aud AUD] [-ttl 1h]"
+
+// loadKeySet читает ключи JWT из JWT_JWKS_FILE. Без файла набор пустой:
+// принимаются только токены HS256, если задан JWT_SECRET
+func loadKeySet(cfg config.AuthConfig) (*auth.KeySet, error) {
+	if cfg.JWKSFile == "" {
+		return &auth.KeySet{}, nil
+	}
+	return auth.LoadKeySet(cfg.JWKSFile)
+}
+
+// runTokenCommand выполняет подкоманду token: keygen добавляет собственный
+// ключ сервиса в JWKS-файл, issue выпускает токен. БД для них не нужна
+func runTokenCommand(cfg config.AuthConfig, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(tokenUsage)
+	}
+	keys, err := loadKeySet(cfg)
+	if errors.Is(err, fs.ErrNotExist) {
+		keys, err = &auth.KeySet{}, nil // keygen создаст файл
+	}
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "keygen":
+		flags := flag.NewFlagSet("token keygen", flag.ContinueOnError)
+		alg := flags.String("alg", auth.AlgEdDSA, "алгоритм подписи: EdDSA или RS256")
+		kid := flags.String("kid", "", "идентификатор ключа (по умолчанию - отпечаток)")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if cfg.JWKSFile == "" {
+			return errors.New("token keygen: не задан JWT_JWKS_FILE")
+		}
+		key, err := auth.GenerateKey(*alg, *kid)
+		if err != nil {
+			return err
+		}
+		// Новый ключ добавляется в конец: им подписываются новые токены,
+		// а прежние ключи остаются для проверки уже выпущенных
+		keys.Keys = append(keys.Keys, key)
+		data, err := keys.MarshalPrivate()
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(cfg.JWKSFile, data); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Ключ %s (%s) добавлен в %s. Перезапустите сервер, чтобы он начал его использовать\n", key.ID, key.Alg, cfg.JWKSFile)
+	case "issue":
+		flags := flag.NewFlagSet("token issue", flag.ContinueOnError)
+		sub := flags.String("sub", "", "субъект токена (обязательно)")
+		name := flags.String("name", "", "имя субъекта для журналов")
+		uid := flags.Int64("uid", 0, "ID пользователя: права токена определяются его ролями")
+		scopes := flags.String("scopes", "", "разрешения через запятую, например users:read,users:write")
+		aud := flags.String("aud", cfg.JWTAudience, "получатель токена (aud)")
+		ttl := flags.Duration("ttl", cfg.JWTTokenTTL, "срок действия токена")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *sub == "" || *ttl <= 0 || *uid < 0 {
+			return fmt.Errorf("token issue: нужно указать -sub, -ttl должен быть положительным, -uid - неотрицательным")
+		}
+
+		now := time.Now()
+		claims := &auth.Claims{
+			Issuer:    cfg.JWTIssuer,
+			Subject:   *sub,
+			Name:      *name,
+			UserID:    *uid,
+			Scope:     strings.Join(auth.ParseScopes(*scopes), " "),
+			IssuedAt:  auth.NewNumericDate(now),
+			ExpiresAt: auth.NewNumericDate(now.Add(*ttl)),
+		}
+		if *aud != "" {
+			claims.Audience = auth.Audience{*aud}
+		}
+		var token string
+		if key := keys.SigningKey(); key != nil {
+			token, err = key.Sign(claims)
+		} else {
+			token, err = auth.SignHS256(claims, []byte(cfg.JWTSecret))
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, token)
+	default:
+		return fmt.Errorf("неизвестная подкоманда token %q: %s", args[0], tokenUsage)
+	}
+	return nil
+}
+
+// writeFileAtomic записывает файл с правами 0600 через временный файл,
+// чтобы сбой посередине не оставил испорченный JWKS
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("запись %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("запись %s: %w", path, err)
+	}
+	return nil
+}